@@ -0,0 +1,490 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// settings shared by archive and extract
+type archiveOptions struct {
+	Include patternList
+	Exclude patternList
+	Flatten bool
+	// counts the bytes of file contents added, if set
+	Progress *progress
+}
+
+// one entry of a tar or zip archive
+type archiveEntry struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Mode    fs.FileMode `json:"-"`
+	Perm    string      `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mod_time"`
+	Link    string      `json:"link,omitempty"`
+}
+
+// kinds of archive entries
+const (
+	entryDir      = "dir"
+	entryFile     = "file"
+	entrySymlink  = "symlink"
+	entryHardlink = "hardlink"
+)
+
+// the ls-style mode string of an entry
+func entryPerm(entry archiveEntry) string {
+	switch entry.Type {
+	case entryDir:
+		return (entry.Mode | fs.ModeDir).String()
+	case entrySymlink:
+		return (entry.Mode | fs.ModeSymlink).String()
+	}
+	return entry.Mode.String()
+}
+
+// the codec an archive name asks for, or nil for a plain .tar or a .zip
+func archiveCodec(name string) (codec, error) {
+	if strings.HasSuffix(name, ".tgz") {
+		return gzipCodec{}, nil
+	}
+	if strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".zip") {
+		return nil, nil
+	}
+	c := codecForExt(name)
+	if c == nil || !strings.HasSuffix(strings.TrimSuffix(name, c.Ext()), ".tar") {
+		return nil, fmt.Errorf("cannot tell the archive format of %s (use .zip, .tar, .tar.gz, .tgz, .tar.zst or .tar.xz)", name)
+	}
+	return c, nil
+}
+
+// walk the given paths and call add with the name each file gets in the
+// archive; each path is stored under its base name, or every file directly
+// at the top with flatten
+func walkArchiveInput(paths []string, o archiveOptions, add func(name string, path string, info fs.FileInfo) error) error {
+	seen := map[string]string{}
+	for _, root := range paths {
+		parent := filepath.Dir(filepath.Clean(root))
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(parent, path)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if !selected(name, d.IsDir(), o.Include, o.Exclude) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if o.Flatten {
+				if d.IsDir() {
+					return nil
+				}
+				name = d.Name()
+				if other, ok := seen[name]; ok {
+					return fmt.Errorf("%s and %s would both be stored as %s", other, path, name)
+				}
+				seen[name] = path
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			printVerbose("adding %s\n", name)
+			return add(name, path, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write the given paths into a tar stream
+func writeTar(w io.Writer, paths []string, o archiveOptions) (int, error) {
+	tw := tar.NewWriter(w)
+	count := 0
+	err := walkArchiveInput(paths, o, func(name string, path string, info fs.FileInfo) error {
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			var err error
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		count++
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, throttle(o.Progress.reader(interruptible(cmdCtx, file))))
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, tw.Close()
+}
+
+// create an archive file from the given paths in the format its name asks for
+func createArchive(dest string, paths []string, o archiveOptions) (int, error) {
+	c, err := archiveCodec(dest)
+	if err != nil {
+		return 0, err
+	}
+	write := writeTar
+	if strings.HasSuffix(dest, ".zip") {
+		write = writeZip
+	}
+
+	pr, pw := io.Pipe()
+	var count int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var w io.Writer = pw
+		var zw io.WriteCloser
+		if c != nil {
+			var err error
+			if zw, err = c.NewWriter(pw, 0); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			w = zw
+		}
+		n, err := write(w, paths, o)
+		if err == nil && zw != nil {
+			err = zw.Close()
+		}
+		count = n
+		pw.CloseWithError(err)
+	}()
+	err = writeFileAtomic(dest, pr)
+	pr.CloseWithError(err)
+	<-done
+	return count, err
+}
+
+// resolve an archive entry name inside dir, rejecting absolute names, ..
+// parts and symlinks that would land outside it
+func entryTarget(dir string, name string) (string, error) {
+	target, err := fileops.SafeJoin(dir, name)
+	if errors.Is(err, fileops.ErrEscape) {
+		return "", fmt.Errorf("refusing path %q that escapes the target directory", name)
+	}
+	return target, err
+}
+
+// call fn for every entry of a tar archive, with a reader over its contents
+func eachTarEntry(path string, fn func(archiveEntry, io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if !strings.HasSuffix(path, ".tar") {
+		c, err := detectCodec(path)
+		if err != nil {
+			return err
+		}
+		zr, err := c.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := archiveEntry{
+			Name:    strings.TrimSuffix(header.Name, "/"),
+			Mode:    fs.FileMode(header.Mode).Perm(),
+			Size:    header.Size,
+			ModTime: header.ModTime,
+			Link:    header.Linkname,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entry.Type = entryDir
+		case tar.TypeReg:
+			entry.Type = entryFile
+		case tar.TypeSymlink:
+			entry.Type = entrySymlink
+		case tar.TypeLink:
+			entry.Type = entryHardlink
+		default:
+			// devices, fifos and the like are not restored
+			continue
+		}
+		entry.Perm = entryPerm(entry)
+		if err := fn(entry, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// call fn for every entry of a tar or zip archive
+func eachArchiveEntry(path string, fn func(archiveEntry, io.Reader) error) error {
+	if isZip(path) {
+		return eachZipEntry(path, fn)
+	}
+	return eachTarEntry(path, fn)
+}
+
+// create one archive entry under dir; directory times are left to the caller
+func restoreEntry(dir string, entry archiveEntry, r io.Reader) error {
+	target, err := entryTarget(dir, entry.Name)
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	switch entry.Type {
+	case entryDir:
+		return fsys.MkdirAll(target, entry.Mode|0700)
+	case entryFile:
+		// an entry replaces a symlink in its place, as tar does, rather
+		// than writing through it
+		if isSymlink(target) {
+			if err := fsys.Remove(target); err != nil {
+				return err
+			}
+		}
+		if err := writeFileAtomic(target, r); err != nil {
+			return err
+		}
+		if err := fsys.Chmod(target, entry.Mode); err != nil {
+			return err
+		}
+		return fsys.Chtimes(target, entry.ModTime, entry.ModTime)
+	case entrySymlink:
+		// a link pointing outside dir could be used to write outside it later
+		linked := entry.Link
+		if !filepath.IsAbs(linked) {
+			linked = path.Join(path.Dir(entry.Name), filepath.ToSlash(linked))
+		}
+		if _, err := entryTarget(dir, linked); err != nil {
+			return fmt.Errorf("refusing symlink %s -> %s: %w", entry.Name, entry.Link, err)
+		}
+		fsys.Remove(target)
+		return fsys.Symlink(entry.Link, target)
+	case entryHardlink:
+		source, err := entryTarget(dir, entry.Link)
+		if err != nil {
+			return err
+		}
+		fsys.Remove(target)
+		return fsys.Link(source, target)
+	}
+	return nil
+}
+
+// unpack an archive into dir, keeping modes and modification times
+func extractArchive(archive string, dir string, o archiveOptions) (int, error) {
+	if err := fsys.MkdirAll(dir, 0755); err != nil && !opts.DryRun {
+		return 0, err
+	}
+
+	// directory times are set last, since extracting into them changes them
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+	seen := map[string]string{}
+	count := 0
+	err := eachArchiveEntry(archive, func(entry archiveEntry, r io.Reader) error {
+		if !selected(entry.Name, entry.Type == entryDir, o.Include, o.Exclude) {
+			return nil
+		}
+		if o.Flatten {
+			if entry.Type == entryDir {
+				return nil
+			}
+			base := path.Base(entry.Name)
+			if other, ok := seen[base]; ok {
+				return fmt.Errorf("%s and %s would both be extracted as %s", other, entry.Name, base)
+			}
+			seen[base] = entry.Name
+			entry.Name = base
+		}
+		target, err := entryTarget(dir, entry.Name)
+		if err != nil {
+			return err
+		}
+		count++
+		if opts.DryRun {
+			printPlan(opResult{Op: "extract", Path: entry.Name, Dest: target, Bytes: entry.Size, Overwrite: exists(target), DryRun: true})
+			return nil
+		}
+		if entry.Type == entryDir {
+			dirs = append(dirs, dirTime{target, entry.ModTime})
+		}
+		if entry.Type != entryDir && exists(target) {
+			if err := auditChange(auditRecord{Op: "overwrite", Path: archive, Dest: target}, "", target); err != nil {
+				return fmt.Errorf("writing audit log: %w", err)
+			}
+		}
+		printVerbose("extracting %s\n", target)
+		return restoreEntry(dir, entry, r)
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		fsys.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime)
+	}
+	return count, err
+}
+
+// list the entries of an archive without extracting it
+func listArchive(archive string, o archiveOptions) ([]archiveEntry, error) {
+	entries := []archiveEntry{}
+	err := eachArchiveEntry(archive, func(entry archiveEntry, _ io.Reader) error {
+		if selected(entry.Name, entry.Type == entryDir, o.Include, o.Exclude) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// register the flags shared by archive and extract
+func addArchiveFlags(flags *flag.FlagSet, o *archiveOptions) {
+	flags.Var(&o.Include, "include", "Only take files matching this pattern (repeatable)")
+	flags.Var(&o.Exclude, "exclude", "Leave out files and directories matching this pattern (repeatable)")
+	flags.BoolVar(&o.Flatten, "flatten", false, "Drop directories and keep every file at the top level")
+	addBwlimitFlag(flags)
+}
+
+// pack files and directories into an archive
+func runArchive(args []string) error {
+	flags := newFlagSet("archive")
+	// the ignore patterns from the config file are always left out
+	o := archiveOptions{Exclude: append(patternList(nil), cfg.Ignore...)}
+	addArchiveFlags(flags, &o)
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	dest := flags.Arg(0)
+	paths, err := expandPaths(flags.Args()[1:])
+	if err != nil {
+		return fail("creating archive", err)
+	}
+	if err := confine(dest); err != nil {
+		return fail("creating archive", err)
+	}
+	if _, err := archiveCodec(dest); err != nil {
+		return usageError("creating archive", err)
+	}
+	if opts.DryRun {
+		for _, path := range paths {
+			plan, err := planCopy(path, dest, true, false)
+			if err != nil {
+				return fail("creating archive", err)
+			}
+			plan.Op = "archive"
+			printPlan(plan)
+		}
+		return nil
+	}
+
+	o.Progress = startProgress("archive", totalSize(paths...))
+	count, err := createArchive(dest, paths, o)
+	o.Progress.finish()
+	if err != nil {
+		return fail("creating archive", err)
+	}
+	printDone(opResult{Op: "archive", Path: dest}, tr("Archived %d entries into %s", count, dest))
+	return nil
+}
+
+// unpack an archive, or list what is in it
+func runExtract(args []string) error {
+	flags := newFlagSet("extract")
+	var o archiveOptions
+	addArchiveFlags(flags, &o)
+	list := flags.Bool("list", false, "List the entries instead of extracting them")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	archive, dir := flags.Arg(0), "."
+	if flags.NArg() == 2 {
+		dir = flags.Arg(1)
+	}
+	if err := confine(archive, dir); err != nil {
+		return fail("extracting archive", err)
+	}
+	if *list {
+		entries, err := listArchive(archive, o)
+		if err != nil {
+			return fail("listing archive", err)
+		}
+		if opts.JSON {
+			printJSON(entries)
+			return nil
+		}
+		for _, e := range entries {
+			name := e.Name
+			if e.Link != "" {
+				name += " -> " + e.Link
+			}
+			fmt.Printf("%s %10d %s %s\n", e.Perm, e.Size, e.ModTime.Format(time.DateTime), name)
+		}
+		return nil
+	}
+
+	count, err := extractArchive(archive, dir, o)
+	if err != nil {
+		return fail("extracting archive", err)
+	}
+	if !opts.DryRun {
+		printDone(opResult{Op: "extract", Path: archive, Dest: dir}, tr("Extracted %d entries from %s into %s", count, archive, dir))
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// an entry of a test archive: a file with Body, a directory, a symlink or
+// a hard link to Link
+type testEntry struct {
+	Name string
+	Type byte // one of the tar type flags
+	Body string
+	Link string
+}
+
+func writeTestTar(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.Name, Typeflag: e.Type, Linkname: e.Link, Mode: 0644, Size: int64(len(e.Body))}
+		if e.Type == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// zip has no hard links, so those entries are left out
+func writeTestZip(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zw := zip.NewWriter(file)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.Name, Method: zip.Deflate}
+		body := e.Body
+		switch e.Type {
+		case tar.TypeDir:
+			header.Name += "/"
+			header.SetMode(fs.ModeDir | 0755)
+		case tar.TypeSymlink:
+			header.SetMode(fs.ModeSymlink | 0777)
+			body = e.Link
+		case tar.TypeLink:
+			continue
+		default:
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractStaysInside(t *testing.T) {
+	// overwrites are audited, which must not touch the real data directory
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		// a symlink already in the target directory, pointing outside it
+		existingLink string
+		wantErr      bool
+		tarOnly      bool
+		// files that must hold this content in the target directory afterwards
+		want map[string]string
+	}{
+		{
+			name:    "dot dot",
+			entries: []testEntry{{Name: "../evil", Body: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "dot dot inside a name",
+			entries: []testEntry{{Name: "sub/../../evil", Body: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{Name: "OUTSIDE/evil", Body: "x"}},
+			wantErr: true,
+		},
+		{
+			name: "absolute symlink then a write through it",
+			entries: []testEntry{
+				{Name: "link", Type: tar.TypeSymlink, Link: "OUTSIDE"},
+				{Name: "link/evil", Body: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative symlink then a write through it",
+			entries: []testEntry{
+				{Name: "link", Type: tar.TypeSymlink, Link: "../outside"},
+				{Name: "link/evil", Body: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			// sub/up/.. looks like sub but is the parent of the target
+			name: "symlink through a symlink that escapes",
+			entries: []testEntry{
+				{Name: "sub", Type: tar.TypeDir},
+				{Name: "sub/up", Type: tar.TypeSymlink, Link: ".."},
+				{Name: "esc", Type: tar.TypeSymlink, Link: "sub/up/.."},
+				{Name: "esc/outside/evil", Body: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			name:         "symlink already on disk",
+			existingLink: "pre",
+			entries:      []testEntry{{Name: "pre/evil", Body: "x"}},
+			wantErr:      true,
+		},
+		{
+			name:         "file over a symlink already on disk",
+			existingLink: "pre",
+			entries:      []testEntry{{Name: "pre", Body: "x"}},
+			wantErr:      true,
+		},
+		{
+			name: "symlink inside",
+			entries: []testEntry{
+				{Name: "sub", Type: tar.TypeDir},
+				{Name: "link", Type: tar.TypeSymlink, Link: "sub"},
+				{Name: "link/file", Body: "inside"},
+			},
+			want: map[string]string{"sub/file": "inside"},
+		},
+		{
+			name: "file replaces a symlink from the archive",
+			entries: []testEntry{
+				{Name: "target", Body: "kept"},
+				{Name: "link", Type: tar.TypeSymlink, Link: "target"},
+				{Name: "link", Body: "replaced"},
+			},
+			want: map[string]string{"target": "kept", "link": "replaced"},
+		},
+		{
+			name:    "hard link that escapes",
+			entries: []testEntry{{Name: "hard", Type: tar.TypeLink, Link: "../outside/secret"}},
+			wantErr: true,
+			tarOnly: true,
+		},
+		{
+			name:    "hard link to an absolute path",
+			entries: []testEntry{{Name: "hard", Type: tar.TypeLink, Link: "OUTSIDE/secret"}},
+			wantErr: true,
+			tarOnly: true,
+		},
+		{
+			name: "hard link inside",
+			entries: []testEntry{
+				{Name: "file", Body: "shared"},
+				{Name: "hard", Type: tar.TypeLink, Link: "file"},
+			},
+			want:    map[string]string{"file": "shared", "hard": "shared"},
+			tarOnly: true,
+		},
+	}
+	formats := []struct {
+		ext   string
+		write func(*testing.T, string, []testEntry)
+	}{{".tar", writeTestTar}, {".zip", writeTestZip}}
+
+	for _, format := range formats {
+		for _, tt := range tests {
+			if tt.tarOnly && format.ext != ".tar" {
+				continue
+			}
+			t.Run(format.ext+"/"+tt.name, func(t *testing.T) {
+				base := t.TempDir()
+				dir := filepath.Join(base, "dest")
+				outside := filepath.Join(base, "outside")
+				for _, d := range []string{dir, outside} {
+					if err := os.Mkdir(d, 0755); err != nil {
+						t.Fatal(err)
+					}
+				}
+				secret := filepath.Join(outside, "secret")
+				if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if tt.existingLink != "" {
+					if err := os.Symlink(outside, filepath.Join(dir, tt.existingLink)); err != nil {
+						t.Skipf("cannot create symlinks: %v", err)
+					}
+				}
+				entries := make([]testEntry, len(tt.entries))
+				for i, e := range tt.entries {
+					// OUTSIDE stands for the absolute path of the directory
+					// the archive must not reach
+					if rest, ok := strings.CutPrefix(e.Name, "OUTSIDE"); ok {
+						e.Name = outside + rest
+					}
+					if rest, ok := strings.CutPrefix(e.Link, "OUTSIDE"); ok {
+						e.Link = outside + rest
+					}
+					entries[i] = e
+				}
+				archive := filepath.Join(base, "test"+format.ext)
+				format.write(t, archive, entries)
+
+				_, err := extractArchive(archive, dir, archiveOptions{})
+				if tt.wantErr && err == nil {
+					t.Errorf("extract succeeded, want an error")
+				}
+				if !tt.wantErr && err != nil {
+					t.Errorf("extract: %v", err)
+				}
+
+				// nothing outside the target directory may change
+				found, err := os.ReadDir(outside)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(found) != 1 {
+					t.Errorf("outside directory holds %d entries, want only the secret", len(found))
+				}
+				if data, err := os.ReadFile(secret); err != nil || string(data) != "secret" {
+					t.Errorf("secret = %q, %v; want it unchanged", data, err)
+				}
+				for name, content := range tt.want {
+					data, err := os.ReadFile(filepath.Join(dir, name))
+					if err != nil || string(data) != content {
+						t.Errorf("%s = %q, %v; want %q", name, data, err, content)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"cmdline/fileops"
+)
+
+// write to a file through a temporary file in the same directory that is
+// synced and renamed over the destination, so readers never see a partial file
+func writeFileAtomic(path string, r io.Reader) error {
+	return fileops.Write(cmdCtx, fsys, path, r, fileops.WriteOptions{Atomic: true})
+}
+
+// reader over an in-memory buffer, for writing generated content atomically
+func bytesReader(data []byte) io.Reader {
+	return bytes.NewReader(data)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// a file or tree as it was just before a destructive change
+type fileState struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"` // regular files only
+	Mode   string `json:"mode"`
+}
+
+// one line of the audit log, written before a delete, overwrite, rename,
+// shred, chmod or chown is carried out
+type auditRecord struct {
+	Time     time.Time  `json:"time"`
+	User     string     `json:"user"`
+	Host     string     `json:"host,omitempty"`
+	Op       string     `json:"op"`
+	Path     string     `json:"path"`
+	Dest     string     `json:"dest,omitempty"`
+	Before   *fileState `json:"before,omitempty"`   // path
+	Replaced *fileState `json:"replaced,omitempty"` // dest, when it already existed
+	Mode     string     `json:"mode,omitempty"`     // new permission bits, for chmod
+	Owner    string     `json:"owner,omitempty"`    // new owner, for chown
+}
+
+// audit log used unless the config file or FILEUTIL_AUDIT_LOG names another
+func auditLogPath() (string, error) {
+	if cfg.AuditLog != "" {
+		return cfg.AuditLog, nil
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// the state of a path, with a checksum of its contents when it is a regular file
+func captureState(path string) (*fileState, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &fileState{Size: info.Size(), Mode: fmt.Sprintf("%04o", uint32(info.Mode().Perm()))}
+	switch {
+	case info.IsDir():
+		if state.Size, err = treeSize(path); err != nil {
+			return nil, err
+		}
+	case info.Mode().IsRegular():
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, interruptible(cmdCtx, file)); err != nil {
+			return nil, err
+		}
+		state.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	}
+	return state, nil
+}
+
+// name of the user running the command, or the numeric id when it has none
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(os.Getuid())
+}
+
+// fill in who and when, capture the state of before and, if it exists,
+// of replaced, and append the record. This runs before the change is made,
+// and an operation whose record cannot be written does not run
+func auditChange(record auditRecord, before string, replaced string) error {
+	if opts.DryRun {
+		return nil
+	}
+	record.Time, record.User = time.Now(), currentUser()
+	record.Host, _ = os.Hostname()
+	var err error
+	if record.Path, err = filepath.Abs(record.Path); err != nil {
+		return err
+	}
+	if record.Dest != "" {
+		if record.Dest, err = filepath.Abs(record.Dest); err != nil {
+			return err
+		}
+	}
+	if before != "" {
+		if record.Before, err = captureState(before); err != nil {
+			return err
+		}
+	}
+	if replaced != "" {
+		if record.Replaced, err = captureState(replaced); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return appendAudit(record)
+}
+
+// append a record to the audit log, which is only ever opened for appending
+func appendAudit(record auditRecord) error {
+	path, err := auditLogPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// audit the journaled operations that destroy data: deletes, renames, and
+// writes and copies over an existing file
+func auditJournaled(op string, path string, dest string) error {
+	switch op {
+	case "delete", "trash":
+		return auditChange(auditRecord{Op: op, Path: path}, path, "")
+	case "rename":
+		return auditChange(auditRecord{Op: op, Path: path, Dest: dest}, path, dest)
+	case "write", "symlink", "hardlink":
+		if exists(path) {
+			return auditChange(auditRecord{Op: "overwrite", Path: path}, path, "")
+		}
+	case "copy":
+		if exists(dest) {
+			return auditChange(auditRecord{Op: "overwrite", Path: path, Dest: dest}, "", dest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// how the previous version of an overwritten file is kept
+type backupOptions struct {
+	Enabled bool
+	Suffix  string
+	Dir     string
+}
+
+// register the backup flags shared by write, copy and rename
+func addBackupFlags(flags *flag.FlagSet) *backupOptions {
+	b := &backupOptions{}
+	flags.BoolVar(&b.Enabled, "backup", false, "Save an existing destination before it is replaced")
+	flags.StringVar(&b.Suffix, "backup-suffix", ".bak", "Suffix appended to backup file names")
+	flags.StringVar(&b.Dir, "backup-dir", "", "Directory to store backups in instead of next to the file")
+	return b
+}
+
+// copy an existing regular file aside before it is overwritten and return
+// the backup path; nothing is done when the destination does not exist
+func backupFile(path string, b *backupOptions) (string, error) {
+	if !b.Enabled {
+		return "", nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := confine(b.Dir); err != nil {
+		return "", err
+	}
+	backup := path + b.Suffix
+	if b.Dir != "" {
+		if err := fsys.MkdirAll(b.Dir, 0755); err != nil {
+			return "", err
+		}
+		backup = filepath.Join(b.Dir, filepath.Base(path)+b.Suffix)
+	}
+	if err := copyFile(path, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// add the backup location to a success message when one was made
+func withBackup(message string, backup string) string {
+	if backup == "" {
+		return message
+	}
+	return message + tr(" (backup saved to %s)", backup)
+}
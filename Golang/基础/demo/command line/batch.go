@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// one operation of a batch file
+type batchStep struct {
+	Line int      `json:"line"`
+	Args []string `json:"args"`
+}
+
+// outcome of one step, for the summary
+type batchResult struct {
+	Step    int    `json:"step"`
+	Line    int    `json:"line"`
+	Command string `json:"command"`
+	Status  string `json:"status"` // ok, failed, skipped, or undone after a failed transaction
+	Error   string `json:"error,omitempty"`
+}
+
+// commands a transaction may run: they only read, or record every change
+// they make in the journal so it can be rolled back
+var transactionSafe = map[string]bool{
+	"read": true, "list": true, "stat": true, "type": true, "wc": true, "hash": true, "find": true, "grep": true,
+	"tree": true, "du": true, "diff": true, "diff-dir": true, "readlink": true, "resolve": true, "verify": true,
+	"write": true, "append": true, "concat": true, "replace": true, "convert": true, "encode": true, "decode": true, "sort": true, "merge": true, "copy": true, "move": true, "rename": true,
+	"delete": true, "clean": true, "mkdir": true, "symlink": true, "hardlink": true, "dedupe": true,
+	"compress": true, "decompress": true, "encrypt": true, "decrypt": true,
+}
+
+// how new flag sets handle bad flags; a batch turns the exit into a panic it
+// recovers from, so one bad step does not end the whole run
+var flagErrorHandling = flag.ExitOnError
+
+// read the steps of a batch file. Files ending in .yaml, .yml or .json hold a
+// list whose items are command lines or lists of arguments; any other file
+// has one command line per line, with # comments and shell-style quoting
+func readBatch(path string) ([]batchStep, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return parseBatchYAML(r)
+	}
+	return parseBatchLines(r)
+}
+
+// parse one command line per line of text
+func parseBatchLines(r io.Reader) ([]batchStep, error) {
+	var steps []batchStep
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		args, err := splitCommandLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(args) > 0 {
+			steps = append(steps, batchStep{Line: line, Args: args})
+		}
+	}
+	return steps, scanner.Err()
+}
+
+// parse a YAML or JSON list of steps
+func parseBatchYAML(r io.Reader) ([]batchStep, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	list := doc.Content[0]
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: a batch file must be a list of steps", list.Line)
+	}
+	var steps []batchStep
+	for _, item := range list.Content {
+		step := batchStep{Line: item.Line}
+		switch item.Kind {
+		case yaml.ScalarNode:
+			args, err := splitCommandLine(item.Value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", item.Line, err)
+			}
+			step.Args = args
+		case yaml.SequenceNode:
+			if err := item.Decode(&step.Args); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("line %d: a step must be a command line or a list of arguments", item.Line)
+		}
+		if len(step.Args) > 0 {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// split a command line into words the way a POSIX shell would for plain
+// words, 'single' and "double" quotes and backslash escapes; # starts a comment
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '#' && !inWord:
+			return args, nil
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+			}
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte(`"\$`+"`", line[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if i == len(line) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// join arguments into a command line, quoting those that need it
+func joinCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t'\"\\#$`") {
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// run one step as if it were its own invocation: the global options, the
+// settings flags leave behind and any -timeout of the step are reset afterwards
+func runBatchStep(args []string) (err error) {
+	savedOpts, savedCtx, savedTuning, savedLimiter := opts, cmdCtx, copyTuning, bwLimiter
+	timers := len(timeoutTimers)
+	defer func() {
+		opts, cmdCtx, copyTuning, bwLimiter = savedOpts, savedCtx, savedTuning, savedLimiter
+		stopTimeouts(timers)
+		if r := recover(); r != nil {
+			// flag sets panic with the parse error, already shown with the usage
+			parseErr, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			if errors.Is(parseErr, flag.ErrHelp) {
+				err = nil
+				return
+			}
+			err = usageError("parsing options", parseErr)
+		}
+	}()
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		return usageError("running step", fmt.Errorf("unknown command %q", args[0]))
+	}
+	return runCommand(cmd, args[1:])
+}
+
+// check that every step of a transaction can be rolled back
+func checkTransaction(steps []batchStep) error {
+	if opts.NoJournal {
+		return errors.New("-transaction needs the journal, so it cannot be used with -no-journal")
+	}
+	for _, step := range steps {
+		if !transactionSafe[step.Args[0]] {
+			return fmt.Errorf("line %d: %s does not record its changes in the journal, so it cannot run in a transaction", step.Line, step.Args[0])
+		}
+		for _, arg := range step.Args[1:] {
+			switch strings.TrimLeft(arg, "-") {
+			case "no-journal", "shred", "trash", "resume":
+				// trashed and shredded data and resumed copies are not journaled for undo
+				return fmt.Errorf("line %d: %s cannot be rolled back, so it cannot run in a transaction", step.Line, arg)
+			}
+		}
+	}
+	return nil
+}
+
+// undo the operations the transaction journaled, newest first; returns
+// how many were undone
+func rollback(t *batchTransaction) (int, error) {
+	ours := map[string]bool{}
+	for _, id := range t.ids {
+		ours[id] = true
+	}
+	pending, err := undoableEntries()
+	if err != nil {
+		return 0, err
+	}
+	undone := 0
+	var errs []error
+	for _, entry := range pending {
+		if !ours[entry.ID] {
+			continue
+		}
+		if err := undoEntry(entry); err != nil {
+			errs = append(errs, fmt.Errorf("undoing %s of %s: %w", entry.Op, entry.Path, err))
+			continue
+		}
+		undone++
+	}
+	return undone, errors.Join(errs...)
+}
+
+// run the operations listed in a file
+func runBatch(args []string) error {
+	flags := newFlagSet("batch")
+	onError := flags.String("on-error", "stop", "What to do when a step fails: stop or continue")
+	transaction := flags.Bool("transaction", false, "Apply all steps or none: on the first failure, undo what earlier steps did through the journal; steps are not staged, so their changes are visible until then")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if *onError != "stop" && *onError != "continue" {
+		return usageError("running batch", fmt.Errorf("-on-error must be stop or continue"))
+	}
+	if err := confine(flags.Arg(0)); err != nil {
+		return fail("reading batch file", err)
+	}
+	steps, err := readBatch(flags.Arg(0))
+	if err != nil {
+		return usageError("reading batch file", err)
+	}
+	if *transaction {
+		if *onError == "continue" {
+			return usageError("running batch", errors.New("-transaction stops at the first failure, so it cannot be used with -on-error continue"))
+		}
+		if err := checkTransaction(steps); err != nil {
+			return usageError("running batch", err)
+		}
+		activeTransaction = &batchTransaction{}
+		defer func() { activeTransaction = nil }()
+	}
+
+	defer func(saved flag.ErrorHandling) { flagErrorHandling = saved }(flagErrorHandling)
+	flagErrorHandling = flag.PanicOnError
+	results := make([]batchResult, len(steps))
+	failed := 0
+	stopped := false
+	for i, step := range steps {
+		results[i] = batchResult{Step: i + 1, Line: step.Line, Command: joinCommandLine(step.Args), Status: "skipped"}
+		if stopped {
+			continue
+		}
+		err := canceled(cmdCtx)
+		if err == nil {
+			err = runBatchStep(step.Args)
+		}
+		if err != nil {
+			// a bare errUsage means the usage text has already been shown
+			if err != errUsage {
+				printError(err)
+			}
+			results[i].Status, results[i].Error = "failed", err.Error()
+			failed++
+			stopped = *onError == "stop" || isCanceled(err)
+			continue
+		}
+		results[i].Status = "ok"
+	}
+
+	var rollbackErr error
+	if *transaction && failed > 0 && !opts.DryRun {
+		undone, err := rollback(activeTransaction)
+		rollbackErr = err
+		for i := range results {
+			if results[i].Status == "ok" {
+				results[i].Status = "undone"
+			}
+		}
+		if !opts.JSON {
+			printInfo("Rolled back %d operations\n", undone)
+		}
+	}
+
+	if opts.JSON {
+		printJSON(results)
+	} else {
+		printInfo("\nBatch summary:\n")
+		for _, r := range results {
+			line := fmt.Sprintf("  %3d  %-7s  %s", r.Step, r.Status, r.Command)
+			if r.Error != "" {
+				line += "  (" + r.Error + ")"
+			}
+			printInfo("%s\n", line)
+		}
+	}
+	if rollbackErr != nil {
+		return fail("rolling back batch", rollbackErr)
+	}
+	if failed > 0 {
+		return fail("running batch", fmt.Errorf("%d of %d steps failed", failed, len(steps)))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// make a journaled write of content to path
+func journaledWrite(t *testing.T, path string, content string) {
+	t.Helper()
+	entry, err := journalPrepare("write", path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journalFinish(entry, os.WriteFile(path, []byte(content), 0644)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// a rollback undoes what the transaction did, and leaves alone what other
+// processes journaled meanwhile
+func TestRollbackUndoesOnlyItsOwnOperations(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Cleanup(func() { activeTransaction = nil })
+	dir := t.TempDir()
+	ours := filepath.Join(dir, "ours")
+	other := filepath.Join(dir, "other")
+	for _, path := range []string{ours, other} {
+		if err := os.WriteFile(path, []byte("before"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx := &batchTransaction{}
+	activeTransaction = tx
+	journaledWrite(t, ours, "transaction")
+	// as if another process wrote: its entry is not the transaction's
+	activeTransaction = nil
+	journaledWrite(t, other, "other process")
+	activeTransaction = tx
+
+	undone, err := rollback(tx)
+	if err != nil || undone != 1 {
+		t.Fatalf("rollback = %d, %v; want 1 operation undone", undone, err)
+	}
+	if got := readString(t, ours); got != "before" {
+		t.Errorf("transaction's file = %q, want it rolled back", got)
+	}
+	if got := readString(t, other); got != "other process" {
+		t.Errorf("other process's file = %q, want it left alone", got)
+	}
+}
+
+// a step that would go unjournaled, as it is over journal_max_copy, fails
+// the transaction instead of running without a way back
+func TestTransactionRefusesUnjournaledSteps(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	savedCfg := cfg
+	t.Cleanup(func() { cfg = savedCfg })
+	cfg.journalMaxCopy = 4
+
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big")
+	if err := os.WriteFile(big, []byte("more than four bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	steps := filepath.Join(dir, "steps.txt")
+	if err := os.WriteFile(steps, []byte("write -content new "+big+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runBatch([]string{"-transaction", steps}); err == nil {
+		t.Errorf("batch succeeded, want the step to fail")
+	}
+	if got := readString(t, big); got != "more than four bytes" {
+		t.Errorf("file = %q, want it unchanged", got)
+	}
+	if activeTransaction != nil {
+		t.Errorf("transaction still active after the batch")
+	}
+}
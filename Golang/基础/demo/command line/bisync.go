@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// what both sides of a two-way sync looked like after the previous run
+type bisyncState struct {
+	Files map[string]bisyncFile `json:"files"`
+}
+
+// a file both sides agreed on after the previous run
+type bisyncFile struct {
+	Size   int64     `json:"size"`
+	MtimeA time.Time `json:"mtime_a"`
+	MtimeB time.Time `json:"mtime_b"`
+}
+
+// one change made, or a conflict found, by a two-way sync
+type bisyncAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// default location of the state file for a pair of directories
+func defaultBisyncState(a string, b string) (string, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return "", err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return "", err
+	}
+	dir, err := journalDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(absA + "\x00" + absB))
+	return filepath.Join(filepath.Dir(dir), "sync", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// load the state of the previous run; a missing file means no previous run
+func loadBisyncState(path string) (bisyncState, error) {
+	state := bisyncState{Files: map[string]bisyncFile{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("bad sync state %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]bisyncFile{}
+	}
+	return state, nil
+}
+
+// save the state for the next run
+func saveBisyncState(path string, state bisyncState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, bytesReader(data))
+}
+
+// regular files under root, keyed by relative path
+func regularFiles(root string) (map[string]fs.FileInfo, error) {
+	files := map[string]fs.FileInfo{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// report whether a side changed a file since the recorded state
+func changedSince(info fs.FileInfo, size int64, mtime time.Time) bool {
+	return info.Size() != size || info.ModTime().Sub(mtime).Abs() >= mtimeTolerance
+}
+
+// propagate changes between a and b in both directions; conflicts are
+// resolved by prefer (newer, a or b, meaning src or dst) or reported and left alone when it is empty
+func bisync(a string, b string, state bisyncState, prefer string, dryRun bool) ([]bisyncAction, bisyncState, error) {
+	filesA, err := regularFiles(a)
+	if err != nil {
+		return nil, state, err
+	}
+	filesB, err := regularFiles(b)
+	if err != nil {
+		return nil, state, err
+	}
+
+	names := map[string]bool{}
+	for name := range filesA {
+		names[name] = true
+	}
+	for name := range filesB {
+		names[name] = true
+	}
+	for name := range state.Files {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var actions []bisyncAction
+	next := bisyncState{Files: map[string]bisyncFile{}}
+	for _, name := range sorted {
+		infoA, inA := filesA[name]
+		infoB, inB := filesB[name]
+		prev, known := state.Files[name]
+		// names from the state file are checked like those found on disk
+		pathA, err := fileops.SafeJoin(a, name)
+		if err != nil {
+			return nil, state, err
+		}
+		pathB, err := fileops.SafeJoin(b, name)
+		if err != nil {
+			return nil, state, err
+		}
+
+		changedA := inA && (!known || changedSince(infoA, prev.Size, prev.MtimeA))
+		changedB := inB && (!known || changedSince(infoB, prev.Size, prev.MtimeB))
+
+		var action bisyncAction
+		switch {
+		case inA && inB:
+			same, err := sameContent(pathA, infoA, pathB, infoB, true)
+			if err != nil {
+				return nil, state, err
+			}
+			switch {
+			case same:
+				next.Files[name] = bisyncFile{infoA.Size(), infoA.ModTime(), infoB.ModTime()}
+				continue
+			case changedA && !changedB:
+				action = bisyncAction{"copy-to-dst", name, ""}
+			case changedB && !changedA:
+				action = bisyncAction{"copy-to-src", name, ""}
+			default:
+				action = resolveConflict(name, "changed on both sides", infoA, infoB, prefer)
+			}
+		case inA:
+			switch {
+			case !known:
+				action = bisyncAction{"copy-to-dst", name, ""}
+			case changedA:
+				action = resolveConflict(name, "changed in src, deleted in dst", infoA, nil, prefer)
+			default:
+				action = bisyncAction{"delete-from-src", name, ""}
+			}
+		case inB:
+			switch {
+			case !known:
+				action = bisyncAction{"copy-to-src", name, ""}
+			case changedB:
+				action = resolveConflict(name, "deleted in src, changed in dst", nil, infoB, prefer)
+			default:
+				action = bisyncAction{"delete-from-dst", name, ""}
+			}
+		default:
+			continue
+		}
+		actions = append(actions, action)
+		if dryRun || action.Action == "conflict" {
+			if known && action.Action == "conflict" {
+				next.Files[name] = prev
+			}
+			continue
+		}
+
+		if err := applyBisyncAction(action, pathA, pathB); err != nil {
+			return actions, state, err
+		}
+		if info, err := os.Stat(pathA); err == nil {
+			next.Files[name] = bisyncFile{info.Size(), info.ModTime(), info.ModTime()}
+		}
+	}
+	return actions, next, nil
+}
+
+// pick a winner for a conflict, or report it when no policy is set
+func resolveConflict(name string, detail string, infoA fs.FileInfo, infoB fs.FileInfo, prefer string) bisyncAction {
+	winner := prefer
+	if prefer == "newer" {
+		switch {
+		case infoA == nil:
+			winner = "b"
+		case infoB == nil:
+			winner = "a"
+		case infoA.ModTime().After(infoB.ModTime()):
+			winner = "a"
+		default:
+			winner = "b"
+		}
+	}
+	switch {
+	case winner == "a" && infoA != nil:
+		return bisyncAction{"copy-to-dst", name, detail + ", keeping src"}
+	case winner == "a":
+		return bisyncAction{"delete-from-dst", name, detail + ", keeping src"}
+	case winner == "b" && infoB != nil:
+		return bisyncAction{"copy-to-src", name, detail + ", keeping dst"}
+	case winner == "b":
+		return bisyncAction{"delete-from-src", name, detail + ", keeping dst"}
+	}
+	return bisyncAction{"conflict", name, detail}
+}
+
+// copy or delete one file as decided by bisync, keeping modification
+// times; what is deleted or overwritten is audited first
+func applyBisyncAction(action bisyncAction, pathA string, pathB string) error {
+	var record auditRecord
+	var before, replaced string
+	switch action.Action {
+	case "copy-to-dst":
+		record, replaced = auditRecord{Op: "overwrite", Path: pathA, Dest: pathB}, pathB
+	case "copy-to-src":
+		record, replaced = auditRecord{Op: "overwrite", Path: pathB, Dest: pathA}, pathA
+	case "delete-from-src":
+		record, before = auditRecord{Op: "delete", Path: pathA}, pathA
+	case "delete-from-dst":
+		record, before = auditRecord{Op: "delete", Path: pathB}, pathB
+	}
+	if before != "" || replaced != "" && exists(replaced) {
+		if err := auditChange(record, before, replaced); err != nil {
+			return fmt.Errorf("writing audit log: %w", err)
+		}
+	}
+	switch action.Action {
+	case "copy-to-dst":
+		return copyKeepingTime(pathA, pathB)
+	case "copy-to-src":
+		return copyKeepingTime(pathB, pathA)
+	case "delete-from-src":
+		return fsys.Remove(pathA)
+	case "delete-from-dst":
+		return fsys.Remove(pathB)
+	}
+	return nil
+}
+
+// copy a file, creating parent directories and carrying over its modification time
+func copyKeepingTime(src string, dest string) error {
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := copyFile(src, dest); err != nil {
+		return err
+	}
+	return fsys.Chtimes(dest, info.ModTime(), info.ModTime())
+}
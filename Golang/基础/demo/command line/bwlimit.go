@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// largest read passed through the limiter at once, so throttled transfers
+// move in small steps instead of long bursts and pauses
+const throttleChunk = 32 * 1024
+
+// token bucket shared by every reader of one command, including parallel
+// copies: each read takes tokens for its bytes and sleeps off any shortfall
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// the limiter set with -bwlimit, or nil when transfers are not limited
+var bwLimiter *rateLimiter
+
+// a limiter for bytes per second, allowing a tenth of a second's worth at once
+func newRateLimiter(rate int64) *rateLimiter {
+	burst := max(float64(rate)/10, throttleChunk)
+	return &rateLimiter{rate: float64(rate), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// block until n more bytes fit in the rate
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// register -bwlimit, which sets the limiter for the whole command
+func addBwlimitFlag(flags *flag.FlagSet) {
+	flags.Func("bwlimit", "Limit reading to this rate, e.g. 10MB/s", func(text string) error {
+		rate, err := parseSize(strings.TrimSuffix(strings.ToLower(text), "/s"))
+		if err != nil {
+			return err
+		}
+		if rate <= 0 {
+			return fmt.Errorf("rate must be positive")
+		}
+		bwLimiter = newRateLimiter(rate)
+		return nil
+	})
+}
+
+// wrap r so reading from it keeps to -bwlimit
+func throttle(r io.Reader) io.Reader {
+	if bwLimiter == nil {
+		return r
+	}
+	return &throttledReader{r, bwLimiter}
+}
+
+// reader that waits on a rate limiter for every read
+type throttledReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (r *throttledReader) Read(buf []byte) (int, error) {
+	if len(buf) > throttleChunk {
+		buf = buf[:throttleChunk]
+	}
+	n, err := r.r.Read(buf)
+	r.l.wait(n)
+	return n, err
+}
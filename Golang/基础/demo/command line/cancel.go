@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cmdline/fileops"
+)
+
+// errInterrupted is the cause of cmdCtx being canceled by a signal
+var errInterrupted = errors.New("interrupted")
+
+// context of the running command, canceled on the first SIGINT or SIGTERM;
+// long operations stop at the next file or buffer, clean up and return its cause
+var cmdCtx = context.Background()
+
+// cancel cmdCtx on the first SIGINT or SIGTERM. Later signals are no longer
+// caught, so a second Ctrl-C kills the process at once
+func handleSignals() (stop func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			name := "SIGTERM"
+			if sig == os.Interrupt {
+				name = "SIGINT"
+			}
+			cancel(fmt.Errorf("%w by %s", errInterrupted, name))
+		case <-ctx.Done():
+		}
+	}()
+	cmdCtx = ctx
+	return func() {
+		signal.Stop(signals)
+		cancel(nil)
+	}
+}
+
+// the reason ctx was canceled, or nil while it is still running
+func canceled(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+// wrap r so reading from it fails once ctx is canceled
+func interruptible(ctx context.Context, r io.Reader) io.Reader {
+	return fileops.Reader(ctx, r)
+}
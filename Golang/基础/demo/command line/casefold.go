@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// destination paths seen during a copy or sync, keyed by their case-folded
+// form, to warn when two differ only in case on a file system that ignores
+// case: there the second would overwrite the first
+type caseCollisions struct {
+	mu   sync.Mutex
+	seen map[string]string
+}
+
+// start tracking paths written under dest; nil, which tracks nothing, when
+// the file system dest is on tells case apart
+func newCaseCollisions(dest string) *caseCollisions {
+	if !ignoresCase(dest) {
+		return nil
+	}
+	return &caseCollisions{seen: map[string]string{}}
+}
+
+// note a destination path, warning when an earlier one differs only in case
+func (c *caseCollisions) add(path string) {
+	if c == nil {
+		return
+	}
+	key := strings.ToLower(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	earlier, ok := c.seen[key]
+	if !ok {
+		c.seen[key] = path
+		return
+	}
+	if earlier != path {
+		logger().Warn("names differ only in case and will overwrite each other", "first", earlier, "second", path)
+	}
+}
+
+// report whether the file system holding path ignores case, by looking up
+// the nearest existing directory with the case of its name swapped; without
+// a letter to swap, Windows and macOS are assumed to ignore case
+func ignoresCase(path string) bool {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for {
+		info, err := os.Stat(dir)
+		if err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	for ; filepath.Dir(dir) != dir; dir = filepath.Dir(dir) {
+		base := filepath.Base(dir)
+		swapped := strings.Map(swapCase, base)
+		if swapped == base {
+			continue
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return false
+		}
+		other, err := os.Stat(filepath.Join(filepath.Dir(dir), swapped))
+		return err == nil && os.SameFile(info, other)
+	}
+	return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+}
+
+// the letter r in the other case
+func swapCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// computes the new permission bits of a file from its current ones
+type modeChange func(perm fs.FileMode, isDir bool) fs.FileMode
+
+// special bits that chmod keeps as they are
+const specialBits = fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// parse an octal mode such as 0644 or a symbolic one such as u+x,go-w or a=rX
+func parseModeChange(text string) (modeChange, error) {
+	if text != "" && strings.Trim(text, "0123456789") == "" {
+		mode, err := parseMode(text)
+		if err != nil {
+			return nil, err
+		}
+		return func(fs.FileMode, bool) fs.FileMode { return mode }, nil
+	}
+	return parseSymbolicMode(text)
+}
+
+// parse comma-separated clauses of the form [ugoa]*([-+=][rwxX]*)+;
+// with no u, g, o or a the clause applies to everyone
+func parseSymbolicMode(text string) (modeChange, error) {
+	type action struct {
+		who   fs.FileMode // mask of the affected bits
+		op    byte
+		perms string
+	}
+	var actions []action
+	for _, clause := range strings.Split(text, ",") {
+		i := 0
+		var who fs.FileMode
+		for ; i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0; i++ {
+			who |= map[byte]fs.FileMode{'u': 0o700, 'g': 0o070, 'o': 0o007, 'a': 0o777}[clause[i]]
+		}
+		if who == 0 {
+			who = 0o777
+		}
+		if i == len(clause) {
+			return nil, fmt.Errorf("%q is not a valid mode", text)
+		}
+		for i < len(clause) {
+			op := clause[i]
+			if op != '+' && op != '-' && op != '=' {
+				return nil, fmt.Errorf("%q is not a valid mode: expected +, - or = at %q", text, clause[i:])
+			}
+			i++
+			start := i
+			for ; i < len(clause) && strings.IndexByte("rwxX", clause[i]) >= 0; i++ {
+			}
+			if i < len(clause) && strings.IndexByte("+-=", clause[i]) < 0 {
+				return nil, fmt.Errorf("%q is not a valid mode: unknown permission %q", text, clause[i])
+			}
+			actions = append(actions, action{who, op, clause[start:i]})
+		}
+	}
+
+	return func(perm fs.FileMode, isDir bool) fs.FileMode {
+		for _, a := range actions {
+			var bits fs.FileMode
+			for _, p := range a.perms {
+				switch p {
+				case 'r':
+					bits |= 0o444
+				case 'w':
+					bits |= 0o222
+				case 'x':
+					bits |= 0o111
+				case 'X':
+					// execute only for directories and files someone can already execute
+					if isDir || perm&0o111 != 0 {
+						bits |= 0o111
+					}
+				}
+			}
+			bits &= a.who
+			switch a.op {
+			case '+':
+				perm |= bits
+			case '-':
+				perm &^= bits
+			case '=':
+				perm = perm&^a.who | bits
+			}
+		}
+		return perm
+	}, nil
+}
+
+// apply a mode change to one path and report what changed
+func chmodPath(path string, info fs.FileInfo, change modeChange) (opResult, error) {
+	old := info.Mode().Perm()
+	perm := change(old, info.IsDir())
+	result := opResult{Op: "chmod", Path: path, Mode: fmt.Sprintf("%04o", uint32(perm)), Skipped: perm == old}
+	if opts.DryRun || perm == old {
+		result.DryRun = opts.DryRun
+		return result, nil
+	}
+	if err := auditChange(auditRecord{Op: "chmod", Path: path, Mode: result.Mode}, path, ""); err != nil {
+		return result, fmt.Errorf("writing audit log: %w", err)
+	}
+	return result, fsys.Chmod(path, perm|info.Mode()&specialBits)
+}
+
+// change permission bits
+func runChmod(args []string) error {
+	flags := newFlagSet("chmod")
+	recursive := flags.Bool("recursive", false, "Change directories and everything under them")
+	fileMode := flags.String("file-mode", "", "Mode for files, instead of MODE (octal or symbolic)")
+	dirMode := flags.String("dir-mode", "", "Mode for directories, instead of MODE (octal or symbolic)")
+	interactive := flags.Bool("interactive", false, "With -recursive, ask before changing each directory tree")
+	flags.Parse(args)
+
+	// MODE may be left out when both -file-mode and -dir-mode are given
+	paths := flags.Args()
+	var forFiles, forDirs modeChange
+	var err error
+	if *fileMode == "" || *dirMode == "" {
+		if flags.NArg() < 2 {
+			flags.Usage()
+			return errUsage
+		}
+		if forFiles, err = parseModeChange(flags.Arg(0)); err != nil {
+			return usageError("parsing mode", err)
+		}
+		forDirs = forFiles
+		paths = paths[1:]
+	}
+	if *fileMode != "" {
+		if forFiles, err = parseModeChange(*fileMode); err != nil {
+			return usageError("parsing mode", err)
+		}
+	}
+	if *dirMode != "" {
+		if forDirs, err = parseModeChange(*dirMode); err != nil {
+			return usageError("parsing mode", err)
+		}
+	}
+	if len(paths) == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if paths, err = expandPaths(paths); err != nil {
+		return fail("changing mode", err)
+	}
+
+	apply := func(path string, info fs.FileInfo) error {
+		change := forFiles
+		if info.IsDir() {
+			change = forDirs
+		}
+		result, err := chmodPath(path, info, change)
+		if err != nil {
+			return err
+		}
+		switch {
+		case result.DryRun:
+			printDone(result, tr("Would change mode of %s from %04o to %s", path, uint32(info.Mode().Perm()), result.Mode))
+		case !result.Skipped:
+			printDone(result, tr("Mode of %s changed to %s", path, result.Mode))
+		}
+		return nil
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fail("changing mode", err)
+		}
+		if !*recursive || !info.IsDir() {
+			if err := apply(path, info); err != nil {
+				return fail("changing mode", err)
+			}
+			continue
+		}
+		if *interactive && !opts.DryRun && !confirm(tr("Change mode of %s and everything under it?", path)) {
+			printDone(opResult{Op: "chmod", Path: path, Skipped: true}, tr("Change cancelled."))
+			continue
+		}
+		// symlinks found while walking are left alone, as chmod -R does
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.Type()&fs.ModeSymlink != 0 {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return apply(p, info)
+		})
+		if err != nil {
+			return fail("changing mode", err)
+		}
+	}
+	return nil
+}
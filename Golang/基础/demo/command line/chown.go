@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// change the owner of one path; on a symlink, noDereference changes the link itself
+func chownPath(path string, uid int, gid int, noDereference bool) error {
+	if noDereference {
+		return fsys.Lchown(path, uid, gid)
+	}
+	return fsys.Chown(path, uid, gid)
+}
+
+// change file owner and group
+func runChown(args []string) error {
+	flags := newFlagSet("chown")
+	recursive := flags.Bool("recursive", false, "Change directories and everything under them")
+	noDereference := flags.Bool("no-dereference", false, "Change symlinks themselves instead of the files they point to")
+	interactive := flags.Bool("interactive", false, "With -recursive, ask before changing each directory tree")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+	spec := flags.Arg(0)
+	uid, gid, err := resolveOwner(spec)
+	if err != nil {
+		return usageError("changing owner", err)
+	}
+	paths, err := expandPaths(flags.Args()[1:])
+	if err != nil {
+		return fail("changing owner", err)
+	}
+
+	apply := func(path string) error {
+		result := opResult{Op: "chown", Path: path, Owner: spec, DryRun: opts.DryRun}
+		if opts.DryRun {
+			printDone(result, tr("Would change owner of %s to %s", path, spec))
+			return nil
+		}
+		if err := auditChange(auditRecord{Op: "chown", Path: path, Owner: spec}, path, ""); err != nil {
+			return fmt.Errorf("writing audit log: %w", err)
+		}
+		if err := chownPath(path, uid, gid, *noDereference); err != nil {
+			return err
+		}
+		printDone(result, tr("Owner of %s changed to %s", path, spec))
+		return nil
+	}
+	for _, path := range paths {
+		stat := os.Stat
+		if *noDereference {
+			stat = os.Lstat
+		}
+		info, err := stat(path)
+		if err != nil {
+			return fail("changing owner", err)
+		}
+		if !*recursive || !info.IsDir() {
+			if err := apply(path); err != nil {
+				return fail("changing owner", err)
+			}
+			continue
+		}
+		if *interactive && !opts.DryRun && !confirm(tr("Change owner of %s and everything under it to %s?", path, spec)) {
+			printDone(opResult{Op: "chown", Path: path, Skipped: true}, tr("Change cancelled."))
+			continue
+		}
+		// the walk never follows symlinks; they are changed themselves with
+		// -no-dereference and otherwise left alone, so files outside PATH are never touched
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type()&fs.ModeSymlink != 0 && !*noDereference {
+				return nil
+			}
+			return apply(p)
+		})
+		if err != nil {
+			return fail("changing owner", err)
+		}
+	}
+	return nil
+}
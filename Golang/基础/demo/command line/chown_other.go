@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"runtime"
+)
+
+// file ownership is not a user:group pair outside Unix
+func resolveOwner(spec string) (int, int, error) {
+	return 0, 0, fmt.Errorf("chown is not supported on %s; change ownership with the system tools (e.g. icacls)", runtime.GOOS)
+}
+
+// files have no numeric owner and group to preserve
+func ownerIDs(info fs.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// resolve USER, USER:GROUP, USER: (the user's login group) or :GROUP to
+// numeric ids; names and numbers are both accepted and -1 leaves an id unchanged
+func resolveOwner(spec string) (int, int, error) {
+	name, group, hasGroup := strings.Cut(spec, ":")
+	if name == "" && group == "" {
+		return 0, 0, fmt.Errorf("%q names neither a user nor a group", spec)
+	}
+	uid, gid := -1, -1
+	if name != "" {
+		u, err := user.Lookup(name)
+		if err != nil {
+			if _, numErr := strconv.Atoi(name); numErr != nil {
+				return 0, 0, fmt.Errorf("unknown user %q", name)
+			}
+			u = &user.User{Uid: name}
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		if hasGroup && group == "" {
+			if gid, err = strconv.Atoi(u.Gid); err != nil {
+				return 0, 0, fmt.Errorf("user %q has no login group", name)
+			}
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if _, numErr := strconv.Atoi(group); numErr != nil {
+				return 0, 0, fmt.Errorf("unknown group %q", group)
+			}
+			g = &user.Group{Gid: group}
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
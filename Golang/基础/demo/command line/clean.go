@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// which empty entries clean removes
+type cleanOptions struct {
+	Type      string // "f", "d" or "" for both
+	OlderThan time.Time
+}
+
+// what clean removed under one root, or would remove in a dry run
+type cleanResult struct {
+	Root   string   `json:"root"`
+	Files  []string `json:"files"`
+	Dirs   []string `json:"dirs"`
+	DryRun bool     `json:"dry_run,omitempty"`
+}
+
+// report whether an entry is old enough to go
+func (o cleanOptions) old(info fs.FileInfo) bool {
+	return o.OlderThan.IsZero() || info.ModTime().Before(o.OlderThan)
+}
+
+// remove empty files and directories under dir, deepest first, so a chain of
+// directories that only hold each other goes entirely. Reports whether dir is
+// left empty, or would be in a dry run. Symlinks and special files count as content
+func cleanDir(dir string, o cleanOptions, result *cleanResult) (bool, error) {
+	if err := canceled(cmdCtx); err != nil {
+		return false, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	empty := true
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		// the times are taken before cleaning, which changes a directory's
+		info, err := e.Info()
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case e.IsDir():
+			childEmpty, err := cleanDir(path, o, result)
+			if err != nil {
+				return false, err
+			}
+			if childEmpty && o.Type != "f" && o.old(info) {
+				if err := cleanRemove(path); err != nil {
+					return false, err
+				}
+				result.Dirs = append(result.Dirs, path)
+				continue
+			}
+		case info.Mode().IsRegular() && info.Size() == 0 && o.Type != "d" && o.old(info):
+			if err := cleanRemove(path); err != nil {
+				return false, err
+			}
+			result.Files = append(result.Files, path)
+			continue
+		}
+		empty = false
+	}
+	return empty, nil
+}
+
+// remove an empty file or directory through the journal, unless in a dry run
+func cleanRemove(path string) error {
+	if opts.DryRun {
+		return nil
+	}
+	return deleteJournaled(path, false)
+}
+
+// remove empty files and directories under each root
+func runClean(args []string) error {
+	flags := newFlagSet("clean")
+	var o cleanOptions
+	older := flags.String("older-than", "", "Only entries modified before this age or time, e.g. 30d")
+	flags.StringVar(&o.Type, "type", "", "Only empty files (f) or empty directories (d)")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if o.Type != "" && o.Type != "f" && o.Type != "d" {
+		return usageError("cleaning directory", fmt.Errorf("-type must be f or d"))
+	}
+	if *older != "" {
+		var err error
+		if o.OlderThan, err = parseTimeSpec(*older, time.Now()); err != nil {
+			return usageError("cleaning directory", err)
+		}
+	}
+
+	if err := confine(flags.Args()...); err != nil {
+		return fail("cleaning directory", err)
+	}
+	var results []cleanResult
+	for _, root := range flags.Args() {
+		result := cleanResult{Root: root, Files: []string{}, Dirs: []string{}, DryRun: opts.DryRun}
+		// the root itself is what is being groomed, so it stays even when emptied
+		_, err := cleanDir(root, o, &result)
+		results = append(results, result)
+		if !opts.JSON {
+			printCleanResult(result)
+		}
+		if err != nil {
+			return fail("cleaning directory", err)
+		}
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	return nil
+}
+
+// print what clean removed under one root
+func printCleanResult(result cleanResult) {
+	verb := tr("Removed")
+	if result.DryRun {
+		verb = tr("Would remove")
+	}
+	for _, path := range result.Files {
+		printInfo("%s empty file %s\n", verb, path)
+	}
+	for _, path := range result.Dirs {
+		printInfo("%s empty directory %s\n", verb, path)
+	}
+	printInfo("%s %d empty files and %d empty directories under %s\n", verb, len(result.Files), len(result.Dirs), result.Root)
+}
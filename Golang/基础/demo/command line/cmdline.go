@@ -3,288 +3,361 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
+
+	"cmdline/fileops"
 )
 
-// Command line arguments
-type CommandFlags struct {
-	Create  bool
-	Read    bool
-	Write   bool
-	Copy    bool
-	Delete  bool
-	List    bool
-	Rename  bool
-	Append  bool
-	Help    bool
-	Path    string
-	Content string
-	Dest    string
+// a subcommand and the function that runs it
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
 }
 
-func main() {
-	// initialize command line arguments
-	cmdFlags := parseFlags()
-
-	//display help message if -help flag is set
-	if cmdFlags.Help {
-		printHelp()
-		return
-	}
-
-	//execute command based on flags
-	switch {
-	case cmdFlags.Create:
-		// create a new file
-		if cmdFlags.Path == "" {
-			fmt.Println("Path is required for creating a file.")
-			return
-		}
-		if err := createFile(cmdFlags.Path); err != nil {
-			fmt.Printf("Error creating file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File created successfully: %s\n", cmdFlags.Path)
-		}
-	case cmdFlags.Read:
-		// read a file
-		if cmdFlags.Path == "" {
-			fmt.Println("Path is required for reading a file.")
-			return
-		}
-		content, err := readFile(cmdFlags.Path)
-		if err != nil {
-			fmt.Printf("Error reading file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File content:\n%s\n", content)
-		}
-	case cmdFlags.Write:
-		// write to a file
-		if cmdFlags.Path == "" {
-			fmt.Println("Path is required for writing to a file.")
-			return
-		}
-		err := writeFile(cmdFlags.Path, cmdFlags.Content)
-		if err != nil {
-			fmt.Printf("Error writing to file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File written successfully: %s\n", cmdFlags.Path)
-		}
-	case cmdFlags.Append:
-		// append to a file
-		if cmdFlags.Path == "" {
-			fmt.Println("Path is required for appending to a file.")
-			return
-		}
-		err := appendToFile(cmdFlags.Path, cmdFlags.Content)
-		if err != nil {
-			fmt.Printf("Error appending to file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File appended successfully: %s\n", cmdFlags.Path)
-		}
-	case cmdFlags.Copy:
-		// copy a file
-		if cmdFlags.Path == "" || cmdFlags.Dest == "" {
-			fmt.Println("Path and destination are required for copying a file.")
-			return
-		}
-		err := copyFile(cmdFlags.Path, cmdFlags.Dest)
-		if err != nil {
-			fmt.Printf("Error copying file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File copied successfully from %s to %s\n", cmdFlags.Path, cmdFlags.Dest)
-		}
-	case cmdFlags.Delete:
-		// delete a file
-		if cmdFlags.Path == "" {
-			fmt.Println("Path is required for deleting a file.")
-			return
-		}
-		err := deleteFile(cmdFlags.Path)
-		if err != nil {
-			fmt.Printf("Error deleting file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File deleted successfully: %s\n", cmdFlags.Path)
-		}
-	case cmdFlags.List:
-		// list files in a directory
-		if cmdFlags.Path == "" {
-			fmt.Println("Path is required for listing files in a directory.")
-			return
-		}
-		files, err := listFiles(cmdFlags.Path)
-		if err != nil {
-			fmt.Printf("Error listing files: %v\n", err)
-			return
-		} else {
-			fmt.Println("Files in directory:")
-			for _, file := range files {
-				fmt.Println(file)
-			}
-		}
-	case cmdFlags.Rename:
-		// rename a file
-		if cmdFlags.Path == "" || cmdFlags.Dest == "" {
-			fmt.Println("Path and destination are required for renaming a file.")
-			return
-		}
-		err := renameFile(cmdFlags.Path, cmdFlags.Dest)
-		if err != nil {
-			fmt.Printf("Error renaming file: %v\n", err)
-			return
-		} else {
-			fmt.Printf("File renamed successfully from %s to %s\n", cmdFlags.Path, cmdFlags.Dest)
-		}
-	default:
-		// if no flags are set, show help message
-		printHelp()
+// available subcommands, in the order they are shown in help
+var commands []command
 
+// the table is filled in init because the handlers refer back to it for usage text
+func init() {
+	commands = []command{
+		{"create", "create PATH", "Create a new file", runCreate},
+		{"read", "read [-stream] [-head N | -tail N] [-follow] [-hex] [-offset N] [-length N] [-pretty | -validate | -table [-rows N] [-columns LIST]] PATH...", "Read a file", runRead},
+		{"write", "write [-content TEXT] [-atomic=false] [-offset N [-length N]] [-backup] [-no-clobber|-interactive] PATH", "Write to a file", runWrite},
+		{"append", "append [-content TEXT] PATH", "Append to a file", runAppend},
+		{"concat", "concat [-separator TEXT | -newline] [-backup] SRC... DST", "Join files end to end into DST", runConcat},
+		{"copy", "copy [-recursive [-hardlinks] [-jobs N]] [-preserve LIST] [-resume] [-bwlimit RATE] [-reflink auto|always|never] [-sparse] [-preallocate=false] [-buffer-size SIZE] [-fsync] [-verify] [-backup] [-no-clobber|-update|-interactive] [-no-follow] [-include GLOB] [-exclude GLOB] [-no-ignore] SRC... DST", "Copy a file or directory", runCopy},
+		{"delete", "delete [-recursive] [-interactive|-force] [-trash | -shred [-passes N]] PATH...", "Delete a file or directory", runDelete},
+		{"list", "list [-long] [-human] [-recursive] [-sort KEY] [-ext EXT] [-no-hidden] [-follow] [-include GLOB] [-exclude GLOB] [-no-ignore] [options] DIR...", "List files in a directory", runList},
+		{"find", "find [-name GLOB] [-regex RE] [-type f|d] [-min-size N] [-max-size N] [-newer-than AGE] [-older-than AGE] [-include GLOB] [-exclude GLOB] [-no-ignore] DIR...", "Search for files by name, size and age", runFind},
+		{"grep", "grep [-i] [-n] [-recursive] [-context N] [-include GLOB] [-exclude GLOB] [-no-ignore] PATTERN PATH...", "Search file contents with a regular expression", runGrep},
+		{"replace", "replace [-in-place] [-no-backup] [-i] PATTERN REPLACEMENT PATH...", "Find and replace text with a regular expression", runReplace},
+		{"convert", "convert [-convert-eol lf|crlf] [-strip-bom] [-iconv [-from ENC] [-to ENC]] [-recursive] [-no-backup] [-include GLOB] [-exclude GLOB] [-no-ignore] PATH...", "Convert line endings, byte order marks and encodings of text files in place, skipping binary files", runConvert},
+		{"tree", "tree [-max-depth N] [-dirs-only] DIR...", "Show a directory hierarchy", runTree},
+		{"sync", "sync [-hash] [-delete-extra] [-jobs N] [-bwlimit RATE] [-reflink auto|always|never] [-sparse] [-preallocate=false] [-buffer-size SIZE] [-fsync] [-include GLOB] [-exclude GLOB] [-no-ignore] | [-two-way [-prefer newer|src|dst]] SRC DST", "Make DST mirror SRC", runSync},
+		{"diff", "diff [-context N] [-ignore-space] FILE1 FILE2", "Show line differences between two files as a unified diff", runDiff},
+		{"diff-dir", "diff-dir [-size-only] A B", "List files only in A, only in B, and files that differ", runDiffDir},
+		{"dedupe", "dedupe [-action report|delete|hardlink|quarantine] [-quarantine DIR] [-min-size N] DIR...", "Find duplicate files and optionally remove them", runDedupe},
+		{"clean", "clean [-type f|d] [-older-than AGE] DIR...", "Remove empty files and empty directory chains", runClean},
+		{"du", "du [-human] [-max-depth N] [-top N] [-include GLOB] [-exclude GLOB] [-no-ignore] DIR...", "Show disk usage per directory, largest first", runDu},
+		{"compress", "compress [-algo gzip|zstd|xz] [-level N] [-recursive] [-keep] [-force] PATH...", "Compress files, keeping their timestamps", runCompress},
+		{"encode", "encode [-algo base64|base64url|hex] [-wrap N] [-o FILE] [-force] [FILE]", "Encode a file or stdin as base64 or hex text", runEncode},
+		{"decode", "decode [-algo base64|base64url|hex] [-o FILE] [-force] [FILE]", "Decode base64 or hex text from a file or stdin", runDecode},
+		{"decompress", "decompress [-algo NAME] [-o FILE] [-recursive] [-keep] [-force] PATH...", "Decompress files, detecting their format", runDecompress},
+		{"archive", "archive [-include GLOB] [-exclude GLOB] [-flatten] [-bwlimit RATE] ARCHIVE PATH...", "Pack files into a .zip, .tar, .tar.gz, .tar.zst or .tar.xz archive", runArchive},
+		{"extract", "extract [-list] [-include GLOB] [-exclude GLOB] [-flatten] ARCHIVE [DIR]", "Unpack or list an archive, refusing entries that escape DIR", runExtract},
+		{"encrypt", "encrypt [-kdf scrypt|argon2] [-o FILE] [-passphrase-file FILE] [-remove] FILE", "Encrypt a file with AES-256-GCM and a passphrase", runEncrypt},
+		{"decrypt", "decrypt [-o FILE] [-passphrase-file FILE] [-remove] FILE", "Decrypt a file written by encrypt", runDecrypt},
+		{"manifest", "manifest [-o FILE] DIR", "Write a sha256sum-compatible SHA256SUMS file for a tree", runManifest},
+		{"check", "check [-manifest FILE] DIR", "Report files changed, missing or new since manifest", runCheck},
+		{"keygen", "keygen [-o NAME]", "Create an ed25519 key pair for sign and verify", runKeygen},
+		{"sign", "sign -key KEY PATH...", "Write detached ed25519 signatures (PATH.sig)", runSign},
+		{"verify", "verify -pub KEY [-sig FILE] PATH...", "Check files against their detached signatures", runVerify},
+		{"split", "split -size SIZE [-dir DIR] FILE", "Break a file into numbered chunks with a checksum file", runSplit},
+		{"join", "join [-o FILE] FILE", "Reassemble and verify a file broken up by split", runJoin},
+		{"watch", "watch [-recursive] [-include GLOB] [-debounce DURATION] [-hash-check] [-exec CMD [-throttle DURATION]] PATH", "Print create, modify, delete and rename events", runWatch},
+		{"move", "move [-reflink auto|always|never] [-sparse] [-preallocate=false] [-fsync] [-backup] [-no-clobber|-update|-interactive] SRC... DST", "Move files or directories, copying and verifying them across filesystems", runMove},
+		{"rename", "rename [-backup] [-no-clobber|-update|-interactive] SRC DST | rename -match RE -to TEMPLATE PATH... | rename -sanitize [-normalize nfc|nfd] [-replace-with TEXT] [-recursive] PATH...", "Rename a file", runRename},
+		{"restore", "restore [-list] ID|PATH...", "Restore files from the trash", runRestore},
+		{"empty-trash", "empty-trash [-force]", "Permanently delete everything in the trash", runEmptyTrash},
+		{"batch", "batch [-on-error stop|continue | -transaction] FILE", "Run the operations listed in FILE (- for stdin), one command line per line or as a YAML/JSON list", runBatch},
+		{"shell", "shell", "Run commands interactively with history, tab completion and a current directory", runREPL},
+		{"tui", "tui [LEFT [RIGHT]]", "Browse, view, copy, move, rename and delete files in a two-pane terminal file manager", runTUI},
+		{"completion", "completion bash|zsh|fish|powershell", "Print a shell completion script for commands, flags and paths", runCompletion},
+		{"version", "version", "Print the version, commit, build date and Go version", runVersion},
+		{"undo", "undo [-list] [ID] | -prune AGE | -purge", "Roll back the last operation or a journal entry, or forget old ones", runUndo},
+		{"stat", "stat [-follow] PATH...", "Show size, permissions, owner and timestamps", runStat},
+		{"sort", "sort [-n] [-r] [-u] [-memory SIZE] [-temp-dir DIR] [-o FILE] [-force] [PATH...]", "Sort the lines of files or stdin, spilling to temporary files when they do not fit in memory", runSort},
+		{"merge", "merge [-n] [-r] [-u] [-o FILE] [-force] PATH...", "Merge files whose lines are sorted already", runMerge},
+		{"wc", "wc [-l] [-w] [-c] [-m] [-L] [PATH...]", "Count lines, words, bytes, characters and the longest line of files or stdin", runWc},
+		{"type", "type PATH...", "Show the MIME type and kind of files, told by their contents", runType},
+		{"hash", "hash [-algo NAME] PATH...", "Print the checksum of files", runHash},
+		{"mkdir", "mkdir [-parents] [-mode MODE] PATH", "Create a directory", runMkdir},
+		{"mktemp", "mktemp [-prefix P] [-suffix S] [-dir DIR] [-cleanup DURATION] | -purge", "Create a uniquely named temporary file and print its path", runMktemp},
+		{"mktempdir", "mktempdir [-prefix P] [-suffix S] [-dir DIR] [-cleanup DURATION] | -purge", "Create a uniquely named temporary directory and print its path", runMktempdir},
+		{"symlink", "symlink [-force] TARGET LINK", "Create a symbolic link", runSymlink},
+		{"hardlink", "hardlink [-force] TARGET LINK", "Create a hard link to an existing file", runHardlink},
+		{"readlink", "readlink LINK...", "Print the target of symbolic links", runReadlink},
+		{"resolve", "resolve PATH...", "Print the absolute physical path with all symlinks resolved", runResolve},
+		{"touch", "touch [-mtime TIME | -reference FILE] [-no-create] PATH...", "Create files or update their access and modification times", runTouch},
+		{"chown", "chown [-recursive [-interactive]] [-no-dereference] USER[:GROUP] PATH...", "Change the owner and group of files (Unix only)", runChown},
+		{"chmod", "chmod [-recursive [-interactive]] [-file-mode MODE] [-dir-mode MODE] MODE PATH...", "Change permissions with an octal or symbolic (u+x,go-w) mode", runChmod},
 	}
 }
 
-// parse command line arguments
-func parseFlags() CommandFlags {
-	var cmdFlags CommandFlags
-
-	flag.BoolVar(&cmdFlags.Create, "create", false, "Create a new file")
-	flag.BoolVar(&cmdFlags.Read, "read", false, "Read a file")
-	flag.BoolVar(&cmdFlags.Write, "write", false, "Write to a file")
-	flag.BoolVar(&cmdFlags.Copy, "copy", false, "Copy a file")
-	flag.BoolVar(&cmdFlags.Delete, "delete", false, "Delete a file")
-	flag.BoolVar(&cmdFlags.List, "list", false, "List files in a directory")
-	flag.BoolVar(&cmdFlags.Rename, "rename", false, "Rename a file")
-	flag.BoolVar(&cmdFlags.Append, "append", false, "Append to a file")
-	flag.BoolVar(&cmdFlags.Help, "help", false, "Show help message")
-	flag.StringVar(&cmdFlags.Path, "path", "", "Path to the file or directory")
-	flag.StringVar(&cmdFlags.Content, "content", "", "Content to write to the file")
-	flag.StringVar(&cmdFlags.Dest, "dest", "", "Destination path for copy or rename")
-
-	flag.Parse()
-	return cmdFlags
+// options shared by every command
+type globalOptions struct {
+	JSON       bool
+	DryRun     bool
+	NoJournal  bool
+	NoProgress bool
+	Yes        bool
+	Verbose    bool
+	Quiet      bool
+	Color      colorMode
+	Format     outputFormat
+	Lang       language
+	LogLevel   slog.Level
+	LogFormat  logFormat
+	LogFile    string
+	ReadOnly   bool   // set only before the command, so batch and shell steps cannot drop it
+	Root       string // likewise; the resolved -root directory, or empty
 }
 
-// show help message
-func printHelp() {
-	helpText := `
-Usage: fileutil [options]
-Options:
-	-create   Create a new file		
-	-read     Read a file
-	-write    Write to a file
-	-copy     Copy a file
-	-delete   Delete a file
-	-list     List files in a directory
-	-rename   Rename a file
-	-append   Append to a file
-	-help     Show help message
-	-path     Path to the file or directory
-	-content  Content to write to the file
-	-dest    Destination path for copy or rename
+// global options, set either before the command name or among its flags
+var opts = globalOptions{LogLevel: slog.LevelWarn, LogFormat: "text"}
 
+// called with each flag set newFlagSet makes, so completion can find out a
+// command's flags
+var onNewFlagSet func(*flag.FlagSet)
 
-Examples:
-	fileutil -create -path /path/to/file.txt -content "Hello, World!"
-	fileutil -read -path /path/to/file.txt
-	fileutil -write -path /path/to/file.txt -content "New content"
-	fileutil -copy -path /path/to/file.txt -dest /path/to/copy.txt
-	fileutil -delete -path /path/to/file.txt
-	fileutil -list -path /path/to/directory
-	fileutil -rename -path /path/to/file.txt -dest /path/to/newfile.txt
-	fileutil -append -path /path/to/file.txt -content "Appended content"
-`
-	fmt.Println(helpText)
+// register the global options on a flag set
+func addGlobalFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&opts.JSON, "json", opts.JSON, "Emit results and errors as JSON")
+	flags.BoolVar(&opts.NoJournal, "no-journal", opts.NoJournal, "Do not record operations for undo")
+	flags.BoolVar(&opts.NoProgress, "no-progress", opts.NoProgress, "Do not show progress for long copy, sync, hash, compress and archive operations")
+	flags.BoolVar(&opts.DryRun, "dry-run", opts.DryRun, "Report what copy, delete, rename, write and append would do without changing anything")
+	flags.BoolVar(&opts.Yes, "yes", opts.Yes, "Answer yes to every confirmation prompt, for scripts")
+	flags.BoolVar(&opts.Verbose, "v", opts.Verbose, "Report each file a recursive copy, delete, archive or extract handles")
+	flags.BoolVar(&opts.Quiet, "q", opts.Quiet, "Print only errors and requested output, not success messages; overrides -v")
+	flags.Var(&opts.Format, "format", "Print each result of list, find, stat, hash and sync with this Go template, such as '{{.Name}} {{.Size}}'")
+	flags.Var(&opts.Color, "color", "Color listings, diffs and errors: auto, always or never (default from the config file, else auto)")
+	flags.Var(&opts.Lang, "lang", "Language of messages: en or zh (default from LC_ALL, LC_MESSAGES or LANG)")
+	flags.TextVar(&opts.LogLevel, "log-level", opts.LogLevel, "Log messages at this level and above to stderr: debug, info, warn or error")
+	flags.Var(&opts.LogFormat, "log-format", "Format of log messages: text or json")
+	flags.StringVar(&opts.LogFile, "log-file", opts.LogFile, "Also append log messages to this file")
+	addTimeoutFlag(flags)
 }
 
-// create a new file
-func createFile(path string) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
+func main() {
+	stop := handleSignals()
+	// the command runs on its own goroutine so -timeout can give up on it
+	// even when it is blocked for good
+	done := make(chan error, 1)
+	go func() { done <- run(os.Args[1:]) }()
+	var err error
+	select {
+	case err = <-done:
+	case cause := <-timeoutExpired:
+		err = fail("waiting for the operation to stop", cause)
 	}
-	defer file.Close()
-	return nil
-}
-
-// read a file
-func readFile(path string) (string, error) {
-	content, err := os.ReadFile(path)
+	stop()
 	if err != nil {
-		return "", err
+		// a bare errUsage means the usage text has already been shown
+		if err != errUsage {
+			printError(err)
+		}
+		os.Exit(exitCode(err))
 	}
-	return string(content), nil
 }
 
-// write to a file
-func writeFile(path string, content string) error {
-	return os.WriteFile(path, []byte(content), 0644)
-}
-
-// append to a file
-func appendToFile(path string, content string) error {
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+// parse the global options and dispatch to the named command
+func run(argv []string) error {
+	global := flag.NewFlagSet("fileutil", flag.ExitOnError)
+	global.Usage = printHelp
+	configPath := global.String("config", "", "Read defaults from this file instead of the user config file")
+	showVersion := global.Bool("version", false, "Print the version and build details and exit")
+	global.BoolVar(&opts.ReadOnly, "read-only", false, "Refuse every command that could change files, for auditing scripts")
+	root := global.String("root", "", "Confine every path to this directory, which relative paths start from")
+	addGlobalFlags(global)
+	global.Parse(argv)
+	if *root != "" {
+		if err := enterRoot(*root); err != nil {
+			return usageError("confining to root", err)
+		}
 	}
-	defer file.Close()
-
-	if _, err := file.WriteString(content); err != nil {
-		return err
+	if opts.ReadOnly {
+		fsys = fileops.ReadOnly(fsys)
+	}
+	if *showVersion {
+		return runVersion(nil)
+	}
+	if err := loadConfig(*configPath); err != nil {
+		return fail("loading config", err)
 	}
-	return nil
-}
 
-// copy a file
-func copyFile(src string, dest string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
+	args := global.Args()
+	if len(args) == 0 {
+		printHelp()
+		return nil
 	}
-	defer srcFile.Close()
 
-	destFile, err := os.Create(dest)
-	if err != nil {
-		return err
+	name := args[0]
+	if name == "help" {
+		if len(args) > 1 {
+			if cmd, ok := findCommand(args[1]); ok {
+				return cmd.run([]string{"-help"})
+			}
+		}
+		printHelp()
+		return nil
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, srcFile)
-	if err != nil {
-		return err
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Println(tr("Unknown command: %s", name))
+		printHelp()
+		return errUsage
 	}
-	return nil
+	return runCommand(cmd, args[1:])
 }
 
-// delete a file
-func deleteFile(path string) error {
-	return os.Remove(path)
+// look up a subcommand by name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
 }
 
-// list files in a directory
-func listFiles(path string) ([]string, error) {
-	var files []string
-
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, err
+// create the flag set for a subcommand with a usage line that matches help
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flagErrorHandling)
+	addGlobalFlags(flags)
+	if onNewFlagSet != nil {
+		onNewFlagSet(flags)
 	}
-	for _, entry := range entries {
-		fileInfo := entry.Name()
-		if entry.IsDir() {
-			fileInfo += "/"
+	flags.Usage = func() {
+		cmd, _ := findCommand(name)
+		fmt.Fprintf(flags.Output(), "%s fileutil %s\n\n%s\n", tr("Usage:"), cmd.usage, tr(cmd.summary))
+		if hasFlags(flags) {
+			fmt.Fprintln(flags.Output(), "\n"+tr("Options:"))
+			flags.VisitAll(func(f *flag.Flag) { f.Usage = tr(f.Usage) })
+			flags.PrintDefaults()
 		}
-		files = append(files, fileInfo)
 	}
+	return flags
+}
 
-	return files, nil
+// report whether a flag set defines any flags
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	flags.VisitAll(func(*flag.Flag) { found = true })
+	return found
 }
 
-// rename a file
-func renameFile(oldPath string, newPath string) error {
-	return os.Rename(oldPath, newPath)
+// show help message
+func printHelp() {
+	fmt.Println("\n" + tr("Usage:") + " fileutil [-version] [-config FILE] [-read-only] [-root DIR] [-json] [-v | -q] [-dry-run] [-yes] [-timeout DURATION] [-log-level LEVEL] [-lang LANG] COMMAND [options] [arguments]")
+	fmt.Println("\n" + tr("Commands:"))
+	for _, cmd := range commands {
+		fmt.Printf("\t%-12s %s\n", cmd.name, tr(cmd.summary))
+	}
+	fmt.Println()
+	fmt.Print(helpProse())
+	fmt.Println("\n" + tr("Examples:"))
+	fmt.Println(helpExamples)
 }
+
+// example command lines shown at the end of help in every language
+const helpExamples = `	fileutil create /path/to/file.txt
+	fileutil read /path/to/file.txt
+	fileutil read -tail 100 /var/log/app.log
+	fileutil read -follow /var/log/app.log
+	fileutil read -hex -offset 1M -length 256 disk.img
+	fileutil read -pretty config.yaml
+	fileutil read -validate "deploy/*.json"
+	fileutil read -table -rows 10 -columns name,email users.csv
+	fileutil write -content "New content" /path/to/file.txt
+	fileutil append -content "Appended content" /path/to/file.txt
+	some-command | fileutil write /path/to/output.txt
+	fileutil concat -newline "parts/*.sql" /path/to/all.sql
+	fileutil copy /path/to/file.txt /path/to/copy.txt
+	fileutil copy -recursive -verify /path/to/dir /path/to/copydir
+	fileutil copy "data/**/*.csv" /path/to/backup
+	fileutil delete /path/to/file.txt
+	fileutil delete "/path/to/logs/*.log"
+	fileutil delete -recursive -force /path/to/directory
+	fileutil -dry-run delete -recursive /path/to/directory
+	fileutil delete -trash /path/to/file.txt
+	fileutil delete -shred -passes 3 /path/to/credentials.json
+	fileutil restore /path/to/file.txt
+	fileutil undo
+	fileutil list /path/to/directory
+	fileutil list -long -human /path/to/directory
+	fileutil list -recursive -max-depth 2 -relative /path/to/directory
+	fileutil list -long -sort size -reverse -ext .log /path/to/directory
+	fileutil -json list /path/to/directory
+	fileutil list -format '{{.Name}}\t{{human .Size}}\t{{.ModTime.Format "2006-01-02"}}' /path/to/directory
+	fileutil hash -format '{{.Digest}} {{.Path}}' "dist/*"
+	fileutil grep -i -n -context 2 "timeout|refused" /var/log/app.log
+	fileutil -dry-run replace "port: (\d+)" "port: 8080" "config/*.yaml"
+	fileutil replace -in-place "http://" "https://" "docs/**/*.md"
+	fileutil convert -recursive -convert-eol lf -strip-bom /path/to/project
+	fileutil -dry-run convert -recursive -iconv /path/to/old-docs
+	fileutil tree -max-depth 2 /path/to/project
+	fileutil find -name "*.log" -min-size 10M -older-than 30d /var/log
+	fileutil sync -delete-extra /path/to/project /path/to/backup
+	fileutil sync -two-way -prefer newer /path/to/laptop /path/to/share
+	fileutil sync -bwlimit 10MB/s /path/to/project /mnt/nfs/backup
+	fileutil diff -context 5 /path/to/old.conf /path/to/new.conf
+	fileutil -color always diff /path/to/old.conf /path/to/new.conf | less -R
+	fileutil -json diff-dir /path/to/project /path/to/backup
+	fileutil dedupe -action hardlink -min-size 1M /path/to/photos
+	work=$(fileutil mktempdir -prefix build- -cleanup 24h)
+	fileutil batch -on-error continue deploy.yaml
+	fileutil batch -transaction migrate.txt
+	fileutil shell
+	fileutil tui ~/Downloads /mnt/backup
+	source <(fileutil completion bash)
+	fileutil -json version
+	fileutil -dry-run clean -older-than 30d /var/cache/app
+	fileutil du -human -max-depth 1 -top 10 /path/to/project
+	fileutil compress -recursive -level 9 "/var/log/app/*.log"
+	fileutil compress -algo zstd /path/to/dump.sql
+	fileutil decompress /path/to/dump.sql.zst
+	fileutil decompress -o /tmp/report.csv /path/to/download
+	fileutil encode -o cert.b64 cert.der
+	fileutil decode -algo hex -o firmware.bin < firmware.hex
+	fileutil archive -exclude .git -exclude "*.tmp" /path/to/project.tar.gz /path/to/project
+	fileutil extract /path/to/project.tar.gz /path/to/restore
+	fileutil archive -flatten /path/to/reports.zip "/path/to/reports/**/*.pdf"
+	fileutil extract -list /path/to/reports.zip
+	fileutil encrypt -kdf argon2 /path/to/secrets.db
+	FILEUTIL_PASSPHRASE=... fileutil decrypt -o /tmp/secrets.db /path/to/secrets.db.enc
+	fileutil manifest /path/to/release && fileutil check /path/to/release
+	fileutil keygen -o /path/to/release
+	fileutil sign -key /path/to/release.key "dist/*.tar.gz"
+	fileutil verify -pub /path/to/release.pub "dist/*.tar.gz"
+	fileutil split -size 100MB /path/to/artifact.tar
+	fileutil join -o /path/to/artifact.tar /path/to/chunks/artifact.tar.001
+	fileutil watch -recursive -include "*.go" -debounce 200ms /path/to/project
+	fileutil watch -recursive -include "*.go" -exec "go test ./..." /path/to/project
+	fileutil rename /path/to/file.txt /path/to/newfile.txt
+	fileutil move /path/to/downloads/*.iso /mnt/usb/images
+	fileutil -dry-run rename -match "(.*)\.jpeg" -to '$1.jpg' "photos/*"
+	fileutil -dry-run rename -sanitize -recursive /path/to/music
+	fileutil write -backup -backup-dir /path/to/backups -content "v2" /path/to/file.txt
+	fileutil stat -json /path/to/file.txt
+	fileutil type "downloads/*"
+	fileutil wc -l "src/*.go"
+	fileutil sort -u -memory 512M -o ips.txt access-ips.txt
+	fileutil merge -n -o all.log "parts/*.log"
+	fileutil hash -algo md5 /path/to/file.txt /path/to/other.txt
+	fileutil mkdir -parents -mode 0750 /path/to/new/directory
+	fileutil chmod -recursive u+rwX,go-w /path/to/project
+	fileutil symlink ../shared/config.yaml /path/to/app/config.yaml
+	fileutil resolve /path/to/app/config.yaml
+	fileutil hardlink /path/to/data.bin /path/to/alias.bin
+	fileutil copy -recursive -hardlinks /path/to/snapshots /path/to/backup
+	fileutil copy -resume -verify /path/to/disk.img /mnt/nas/disk.img
+	fileutil copy -reflink always /var/lib/vms/base.qcow2 /var/lib/vms/clone.qcow2
+	fileutil copy -sparse /var/lib/vms/disk.raw /mnt/backup/disk.raw
+	fileutil copy -buffer-size 4M -fsync /path/to/disk.img /mnt/nas/disk.img
+	fileutil -log-level debug -log-format json -log-file /var/log/fileutil.log sync /srv/data /mnt/backup
+	fileutil -v copy -recursive /path/to/project /path/to/backup
+	fileutil -q sync -delete-extra /srv/data /mnt/backup || mail -s "backup failed" admin
+	fileutil -no-progress copy -recursive /path/to/photos /mnt/backup/photos
+	fileutil copy -recursive -exclude node_modules -exclude .git /path/to/project /path/to/backup
+	fileutil copy -recursive -jobs 16 /path/to/node_modules /path/to/backup/node_modules
+	fileutil copy -recursive -update /path/to/project /path/to/backup
+	fileutil copy -recursive -preserve mode,times,owner,xattr /path/to/site /path/to/backup
+	fileutil copy -recursive -no-follow /path/to/project /path/to/backup
+	fileutil touch -mtime 2024-01-02T15:04:05 /path/to/file.txt
+	fileutil touch -reference /path/to/original.txt /path/to/copy.txt
+	fileutil chown -recursive www-data:www-data /path/to/site
+	fileutil chmod -recursive -file-mode 0644 -dir-mode 0755 /path/to/site`
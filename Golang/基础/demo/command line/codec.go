@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// a compression format that compress and decompress can use
+type codec interface {
+	// name used with -algo
+	Name() string
+	// suffix of compressed files
+	Ext() string
+	// bytes every compressed stream starts with
+	Magic() []byte
+	// compress into w; level is 1 (fastest) to 9 (smallest), or 0 for the default
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+	// decompress from r
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// the format compress uses when -algo is not given
+const defaultCodec = "gzip"
+
+// supported formats, in the order they are listed in messages
+var codecs = []codec{gzipCodec{}, zstdCodec{}, xzCodec{}, bzip2Codec{}}
+
+// look up a codec by its -algo name
+func findCodec(name string) (codec, error) {
+	var names []string
+	for _, c := range codecs {
+		if c.Name() == strings.ToLower(name) {
+			return c, nil
+		}
+		names = append(names, c.Name())
+	}
+	return nil, fmt.Errorf("unknown compression format %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// work out the format of a compressed file from its first bytes, falling back to its suffix
+func detectCodec(path string) (codec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header := make([]byte, 8)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	for _, c := range codecs {
+		if bytes.HasPrefix(header[:n], c.Magic()) {
+			return c, nil
+		}
+	}
+	if c := codecForExt(path); c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%s is not in a known compressed format", path)
+}
+
+// the codec whose suffix path ends with, or nil
+func codecForExt(path string) codec {
+	for _, c := range codecs {
+		if strings.HasSuffix(path, c.Ext()) {
+			return c
+		}
+	}
+	return nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string  { return "gzip" }
+func (gzipCodec) Ext() string   { return ".gz" }
+func (gzipCodec) Magic() []byte { return []byte{0x1f, 0x8b} }
+
+func (gzipCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string  { return "zstd" }
+func (zstdCodec) Ext() string   { return ".zst" }
+func (zstdCodec) Magic() []byte { return []byte{0x28, 0xb5, 0x2f, 0xfd} }
+
+func (zstdCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		return zstd.NewWriter(w)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+type xzCodec struct{}
+
+func (xzCodec) Name() string  { return "xz" }
+func (xzCodec) Ext() string   { return ".xz" }
+func (xzCodec) Magic() []byte { return []byte{0xfd, '7', 'z', 'X', 'Z', 0x00} }
+
+// the xz package has no compression levels, so level is ignored
+func (xzCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return xz.NewWriter(w)
+}
+
+func (xzCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(d), nil
+}
+
+type bzip2Codec struct{}
+
+func (bzip2Codec) Name() string  { return "bzip2" }
+func (bzip2Codec) Ext() string   { return ".bz2" }
+func (bzip2Codec) Magic() []byte { return []byte("BZh") }
+
+// returned when asked to compress to a format that can only be read
+var errDecompressOnly = errors.New("bzip2 can only be decompressed; choose gzip, zstd or xz to compress")
+
+// the standard library only implements bzip2 decompression
+func (bzip2Codec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return nil, errDecompressOnly
+}
+
+func (bzip2Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
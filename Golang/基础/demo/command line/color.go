@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// when to color output, set with -color or the config file's color key
+type colorMode string
+
+func (m *colorMode) String() string {
+	return string(*m)
+}
+
+func (m *colorMode) Set(s string) error {
+	switch s {
+	case "auto", "always", "never":
+		*m = colorMode(s)
+		return nil
+	}
+	return fmt.Errorf("must be auto, always or never")
+}
+
+// ANSI SGR codes for the kinds of text that are colored
+const (
+	colorDir     = "1;34"
+	colorLink    = "1;36"
+	colorExec    = "1;32"
+	colorHeader  = "1"
+	colorAdded   = "32"
+	colorRemoved = "31"
+	colorHunk    = "36"
+	colorError   = "1;31"
+	colorKey     = "34"
+	colorString  = "32"
+	colorNumber  = "36"
+	colorLiteral = "35"
+	colorComment = "90"
+)
+
+// report whether output written to f is colored. With auto, it is when f
+// is a terminal, NO_COLOR is unset or empty, TERM is not dumb and the output
+// is not JSON
+func colorEnabled(f *os.File) bool {
+	mode := string(opts.Color)
+	if mode == "" {
+		mode = cfg.Color
+	}
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if opts.JSON || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// wrap s in the color code when output to f is colored
+func paint(f *os.File, code string, s string) string {
+	if code == "" || !colorEnabled(f) {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// color of a file name in listings, like ls: directories, symlinks and
+// executables stand out
+func modeColor(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return colorDir
+	case mode&fs.ModeSymlink != 0:
+		return colorLink
+	case mode.IsRegular() && mode.Perm()&0111 != 0:
+		return colorExec
+	}
+	return ""
+}
@@ -0,0 +1,841 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// create a new file
+func runCreate(args []string) error {
+	flags := newFlagSet("create")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	path := flags.Arg(0)
+	if err := confine(path); err != nil {
+		return fail("creating file", err)
+	}
+
+	if err := fileops.Create(cmdCtx, fsys, path); err != nil {
+		return fail("creating file", err)
+	}
+	printDone(opResult{Op: "create", Path: path}, tr("File created successfully: %s", path))
+	return nil
+}
+
+// read one or more files
+func runRead(args []string) error {
+	flags := newFlagSet("read")
+	stream := flags.Bool("stream", false, "Copy the file to stdout in chunks instead of loading it into memory")
+	head := flags.Int("head", 0, "Print only the first N lines")
+	tail := flags.Int("tail", 0, "Print only the last N lines")
+	follow := flags.Bool("follow", false, "Keep printing lines as they are appended to the file")
+	binary := flags.Bool("binary", false, "Print binary files too instead of skipping them")
+	hex := flags.Bool("hex", false, "Print a hex dump with offsets and an ASCII column, as xxd does")
+	byteRange := addByteRangeFlags(flags, "Read at most this many bytes, e.g. 512, 1M or 0x100")
+	pretty := flags.Bool("pretty", false, "Re-indent and color JSON or YAML, told by the extension or the contents")
+	validate := flags.Bool("validate", false, "Only check the syntax of JSON or YAML files and report where it breaks")
+	table := flags.Bool("table", false, "Show the first rows of CSV or TSV files as an aligned table")
+	var tableOpts tableOptions
+	addTableFlags(flags, &tableOpts)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := exclusiveFlags(flags, "head", "tail"); err != nil {
+		return usageError("reading file", err)
+	}
+	for _, name := range []string{"hex", "offset", "length"} {
+		for _, other := range []string{"head", "tail", "follow"} {
+			if err := exclusiveFlags(flags, name, other); err != nil {
+				return usageError("reading file", err)
+			}
+		}
+	}
+	if err := exclusiveFlags(flags, "pretty", "validate", "table"); err != nil {
+		return usageError("reading file", err)
+	}
+	for _, name := range []string{"rows", "columns", "delimiter", "header"} {
+		if err := requireFlags(flags, name, "table"); err != nil {
+			return usageError("reading file", err)
+		}
+	}
+	if tableOpts.Rows < 1 {
+		return usageError("reading file", fmt.Errorf("-rows must be at least 1"))
+	}
+	for _, name := range []string{"pretty", "validate", "table"} {
+		for _, other := range []string{"stream", "head", "tail", "follow", "hex", "offset", "length", "binary"} {
+			if err := exclusiveFlags(flags, name, other); err != nil {
+				return usageError("reading file", err)
+			}
+		}
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("reading file", err)
+	}
+	if *pretty || *validate {
+		return readData(paths, *validate)
+	}
+	if *table {
+		return readTables(paths, tableOpts)
+	}
+
+	if *follow {
+		if len(paths) != 1 || *head > 0 || opts.JSON {
+			return usageError("reading file", fmt.Errorf("-follow takes a single path and cannot be combined with -head or -json"))
+		}
+		lines := *tail
+		if lines == 0 {
+			lines = defaultFollowLines
+		}
+		if err := followFile(os.Stdout, paths[0], lines); err != nil {
+			return fail("following file", err)
+		}
+		return nil
+	}
+
+	var results []fileContent
+	for _, path := range paths {
+		if *hex || byteRange.partial() {
+			result, err := readRange(path, *byteRange, *hex, *binary, len(paths) > 1)
+			if err != nil {
+				return fail("reading file", err)
+			}
+			if result != nil {
+				results = append(results, *result)
+			}
+			continue
+		}
+		if !*binary {
+			if isBinary, err := isBinaryFile(path); err != nil {
+				return fail("reading file", err)
+			} else if isBinary {
+				if !opts.JSON {
+					printInfo("Skipped binary file %s (use -binary)\n", path)
+				}
+				continue
+			}
+		}
+		if opts.JSON {
+			content, err := readPart(path, *head, *tail)
+			if err != nil {
+				return fail("reading file", err)
+			}
+			results = append(results, fileContent{Path: path, Content: content})
+			continue
+		}
+
+		if *stream || *head > 0 || *tail > 0 {
+			if len(paths) > 1 {
+				fmt.Printf("==> %s <==\n", path)
+			}
+			if err := streamFile(os.Stdout, path, *head, *tail); err != nil {
+				return fail("reading file", err)
+			}
+			continue
+		}
+
+		data, err := fileops.Read(cmdCtx, fsys, path)
+		if err != nil {
+			return fail("reading file", err)
+		}
+		content := string(data)
+		switch {
+		case opts.Quiet:
+			fmt.Println(content)
+		case len(paths) > 1:
+			fmt.Printf("%s\n%s\n", tr("File content (%s):", path), content)
+		default:
+			fmt.Printf("%s\n%s\n", tr("File content:"), content)
+		}
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	return nil
+}
+
+// write to a file
+func runWrite(args []string) error {
+	flags := newFlagSet("write")
+	content := flags.String("content", "-", "Content to write to the file, or - to read it from stdin")
+	atomic := flags.Bool("atomic", true, "Write to a temporary file and rename it over the destination")
+	backup := addBackupFlags(flags)
+	overwrite := addOverwriteFlags(flags, false)
+	patch := addByteRangeFlags(flags, "With -offset, patch exactly this many bytes and refuse content of another size")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := checkSharedFlags(flags); err != nil {
+		return usageError("writing to file", err)
+	}
+	if err := requireFlags(flags, "length", "offset"); err != nil {
+		return usageError("writing to file", err)
+	}
+	if err := exclusiveFlags(flags, "offset", "atomic"); err != nil {
+		return usageError("writing to file", err)
+	}
+	path := flags.Arg(0)
+	if err := confine(path); err != nil {
+		return fail("writing to file", err)
+	}
+	if overwrite.Interactive && !opts.Yes && *content == "-" {
+		return usageError("writing to file", errors.New("-interactive needs the answer on stdin, so give the content with -content"))
+	}
+	input := contentReader(*content)
+
+	if ok, err := overwrite.allow("", path); err != nil {
+		return fail("writing to file", err)
+	} else if !ok {
+		printDone(opResult{Op: "write", Path: path, Skipped: true}, tr("Skipped %s", path))
+		return nil
+	}
+	if flagsGiven(flags)["offset"] {
+		if err := writePatch(path, *patch, input, backup); err != nil {
+			return fail("patching file", err)
+		}
+		return nil
+	}
+
+	if opts.DryRun {
+		size, err := io.Copy(io.Discard, input)
+		if err != nil {
+			return fail("writing to file", err)
+		}
+		plan, err := planWrite("write", path, size)
+		if err != nil {
+			return fail("writing to file", err)
+		}
+		printPlan(plan)
+		return nil
+	}
+	backupPath, err := backupFile(path, backup)
+	if err != nil {
+		return fail("backing up file", err)
+	}
+	entry, err := journalPrepare("write", path, "")
+	if err != nil {
+		return fail("journaling write", err)
+	}
+	if err := journalFinish(entry, fileops.Write(cmdCtx, fsys, path, input, fileops.WriteOptions{Atomic: *atomic})); err != nil {
+		return fail("writing to file", err)
+	}
+	printDone(opResult{Op: "write", Path: path, Backup: backupPath},
+		withBackup(tr("File written successfully: %s", path), backupPath))
+	return nil
+}
+
+// append to a file
+func runAppend(args []string) error {
+	flags := newFlagSet("append")
+	content := flags.String("content", "-", "Content to append to the file, or - to read it from stdin")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	path := flags.Arg(0)
+	if err := confine(path); err != nil {
+		return fail("appending to file", err)
+	}
+	input := contentReader(*content)
+
+	if opts.DryRun {
+		size, err := io.Copy(io.Discard, input)
+		if err != nil {
+			return fail("appending to file", err)
+		}
+		plan, err := planWrite("append", path, size)
+		if err != nil {
+			return fail("appending to file", err)
+		}
+		printPlan(plan)
+		return nil
+	}
+	entry, err := journalPrepare("append", path, "")
+	if err != nil {
+		return fail("journaling append", err)
+	}
+	if err := journalFinish(entry, fileops.Write(cmdCtx, fsys, path, input, fileops.WriteOptions{Append: true})); err != nil {
+		return fail("appending to file", err)
+	}
+	printDone(opResult{Op: "append", Path: path}, tr("File appended successfully: %s", path))
+	return nil
+}
+
+// source of the content for write and append: stdin for "-", otherwise the text itself
+func contentReader(content string) io.Reader {
+	if content == "-" {
+		return os.Stdin
+	}
+	return strings.NewReader(content)
+}
+
+// copy files or directories
+func runCopy(args []string) error {
+	flags := newFlagSet("copy")
+	recursive := flags.Bool("recursive", false, "Copy directories recursively")
+	verify := flags.Bool("verify", false, "Compare source and destination checksums after copying")
+	backup := addBackupFlags(flags)
+	overwrite := addOverwriteFlags(flags, true)
+	preserve := flags.String("preserve", cfg.Preserve, "Keep these attributes of the source: mode,times,owner,xattr or all")
+	resume := flags.Bool("resume", false, "Continue interrupted copies, keeping the part of each destination that already matches")
+	addBwlimitFlag(flags)
+	addCopyTuningFlags(flags)
+	jobs := flags.Int("jobs", cfg.Jobs, "Number of files to copy at once with -recursive; with more than one, every failure is reported instead of stopping at the first")
+	hardlinks := flags.Bool("hardlinks", false, "With -recursive, copy a file with several hard links once and link the other names to it")
+	follow := true
+	addFollowFlags(flags, &follow)
+	filter := addTreeFilterFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := checkSharedFlags(flags); err != nil {
+		return usageError("copying file", err)
+	}
+	if err := requireFlags(flags, "hardlinks", "recursive"); err != nil {
+		return usageError("copying file", err)
+	}
+	if err := requireFlags(flags, "jobs", "recursive"); err != nil {
+		return usageError("copying file", err)
+	}
+	keep, err := parsePreserve(*preserve)
+	if err != nil {
+		return usageError("copying file", err)
+	}
+	if *jobs < 1 {
+		return usageError("copying file", fmt.Errorf("-jobs must be at least 1"))
+	}
+	srcs, err := expandPaths(flags.Args()[:flags.NArg()-1])
+	if err != nil {
+		return fail("copying file", err)
+	}
+	dest := flags.Arg(flags.NArg() - 1)
+	if err := confine(dest); err != nil {
+		return fail("copying file", err)
+	}
+
+	// several sources are copied into dest, which must then be a directory
+	intoDir := len(srcs) > 1
+	if intoDir {
+		if info, err := os.Stat(dest); err != nil || !info.IsDir() {
+			return fail("copying file", fmt.Errorf("destination %s is not a directory", dest))
+		}
+	}
+
+	p := startProgress("copy", totalSize(srcs...))
+	defer p.finish()
+	for _, src := range srcs {
+		target := dest
+		if intoDir {
+			var err error
+			if target, err = fileops.SafeJoin(dest, filepath.Base(src)); err != nil {
+				return fail("copying file", err)
+			}
+		}
+		c := treeCopier{Follow: follow, Hardlinks: *hardlinks, Preserve: keep, Progress: p, Resume: *resume, Jobs: *jobs, Filter: filter, Verbose: opts.Verbose}
+		if *recursive {
+			// the policy applies to each file in the tree
+			c.Overwrite = overwrite
+		} else if ok, err := overwrite.allow(src, target); err != nil {
+			return fail("copying file", err)
+		} else if !ok {
+			printDone(opResult{Op: "copy", Path: src, Dest: target, Skipped: true}, tr("Skipped %s", target))
+			continue
+		}
+		if err := checkNotInside(src, target); err != nil {
+			return fail("copying file", err)
+		}
+		if opts.DryRun {
+			plan, err := planCopy(src, target, *recursive, follow)
+			if err != nil {
+				return fail("copying file", err)
+			}
+			printPlan(plan)
+			continue
+		}
+		if info, err := os.Stat(src); err == nil && info.IsDir() {
+			if !*recursive {
+				return fail("copying file", fmt.Errorf("%s is a directory (use -recursive)", src))
+			}
+			if overwrite.Interactive && !confirm(tr("Copy %s and everything under it to %s?", src, target)) {
+				printDone(opResult{Op: "copy", Path: src, Dest: target, Skipped: true}, tr("Copy cancelled."))
+				continue
+			}
+		}
+		backupPath, err := backupFile(target, backup)
+		if err != nil {
+			return fail("backing up file", err)
+		}
+		// a partial destination being resumed is not worth saving for undo
+		var entry *journalEntry
+		if !*resume || !exists(target) {
+			if entry, err = journalPrepare("copy", src, target); err != nil {
+				return fail("journaling copy", err)
+			}
+		}
+		c.Journal = entry
+		if err := journalFinish(entry, c.copy(src, target)); err != nil {
+			return fail("copying file", err)
+		}
+		if *verify {
+			if err := verifyCopy(src, target, filter); err != nil {
+				return fail("verifying copy", err)
+			}
+		}
+		message := tr("File copied successfully from %s to %s", src, target)
+		if c.Skipped > 0 {
+			message += tr(" (%d existing files kept)", c.Skipped)
+		}
+		if c.Resumed > 0 {
+			message += tr(" (resumed, %s already in place)", humanSize(c.Resumed))
+		}
+		printDone(opResult{Op: "copy", Path: src, Dest: target, Backup: backupPath}, withBackup(message, backupPath))
+	}
+	return nil
+}
+
+// delete files or directories
+func runDelete(args []string) error {
+	flags := newFlagSet("delete")
+	recursive := flags.Bool("recursive", false, "Delete directories and their contents")
+	force := flags.Bool("force", false, "Do not ask for confirmation, even with -interactive")
+	interactive := flags.Bool("interactive", false, "Ask before deleting each path")
+	trash := flags.Bool("trash", false, "Move to the trash instead of deleting permanently")
+	shred := flags.Bool("shred", false, "Overwrite file contents with random data before deleting them, along with the copies the journal kept (best effort on SSDs and copy-on-write filesystems); cannot be undone")
+	passes := flags.Int("passes", 1, "With -shred, how many times to overwrite each file")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := exclusiveFlags(flags, "shred", "trash"); err != nil {
+		return usageError("deleting file", err)
+	}
+	if err := requireFlags(flags, "passes", "shred"); err != nil {
+		return usageError("deleting file", err)
+	}
+	if *passes < 1 {
+		return usageError("deleting file", errors.New("-passes must be at least 1"))
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("deleting file", err)
+	}
+	if *shred && !opts.DryRun {
+		logger().Warn(shredWarning)
+	}
+
+	for _, path := range paths {
+		if opts.DryRun {
+			plan, err := planDelete(path, *recursive)
+			if err != nil {
+				return fail("deleting file", err)
+			}
+			if *shred {
+				plan.Op = "shred"
+			}
+			printPlan(plan)
+			continue
+		}
+		// permanent recursive deletes ask even without -interactive
+		var question string
+		switch {
+		case *force:
+		case *trash && *interactive:
+			question = tr("Move %s to the trash?", path)
+		case *recursive && !*trash:
+			question = tr("Delete %s and everything under it?", path)
+		case *interactive:
+			question = tr("Delete %s?", path)
+		}
+		if question != "" && !confirm(question) {
+			printDone(opResult{Op: "delete", Path: path, Skipped: true}, tr("Delete cancelled."))
+			continue
+		}
+		if *recursive {
+			format := "deleting %s\n"
+			switch {
+			case *trash:
+				format = "trashing %s\n"
+			case *shred:
+				format = "shredding %s\n"
+			}
+			printTreeVerbose(format, path)
+		}
+		if *trash {
+			record, err := journalPrepare("trash", path, "")
+			if err != nil {
+				return fail("journaling delete", err)
+			}
+			trashed, err := trashFile(path)
+			if record != nil {
+				record.Dest = trashed.ID
+			}
+			if err := journalFinish(record, err); err != nil {
+				return fail("moving file to trash", err)
+			}
+			printDone(opResult{Op: "trash", Path: path, Dest: trashed.ID},
+				tr("File moved to trash: %s (restore with: fileutil restore %s)", path, trashed.ID))
+			continue
+		}
+		if *shred {
+			// not journaled: keeping a copy for undo would defeat the point
+			if err := auditChange(auditRecord{Op: "shred", Path: path}, path, ""); err != nil {
+				return fail("writing audit log", err)
+			}
+			if err := shredPath(fsys, path, *recursive, *passes); err != nil {
+				return fail("shredding file", err)
+			}
+			forgotten, err := shredJournalCopies(path, *passes)
+			if err != nil {
+				return fail("shredding journal copies", err)
+			}
+			printVerbose("shredded the journal copies of %d earlier operation(s) on %s\n", forgotten, path)
+			warnTrashedCopies(path)
+			printDone(opResult{Op: "shred", Path: path}, tr("File shredded: %s", path))
+			continue
+		}
+		if err := deleteJournaled(path, *recursive); err != nil {
+			return fail("deleting file", err)
+		}
+		printDone(opResult{Op: "delete", Path: path}, tr("File deleted successfully: %s", path))
+	}
+	return nil
+}
+
+// restore files from the trash
+func runRestore(args []string) error {
+	flags := newFlagSet("restore")
+	list := flags.Bool("list", false, "List the contents of the trash")
+	flags.Parse(args)
+
+	if *list {
+		entries, err := listTrash()
+		if err != nil {
+			return fail("listing trash", err)
+		}
+		if opts.JSON {
+			printJSON(entries)
+			return nil
+		}
+		fmt.Println(tr("Files in trash:"))
+		for _, entry := range entries {
+			fmt.Printf("%s  %s  %s\n", entry.DeletedAt.Format(time.DateTime), entry.ID, entry.OriginalPath)
+		}
+		return nil
+	}
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	for _, key := range flags.Args() {
+		entry, err := findTrashEntry(key)
+		if err != nil {
+			return fail("restoring file", err)
+		}
+		if err := confine(entry.OriginalPath); err != nil {
+			return fail("restoring file", err)
+		}
+		if err := restoreFromTrash(entry); err != nil {
+			return fail("restoring file", err)
+		}
+		if err := journalTrashGone(entry.ID); err != nil {
+			return fail("journaling restore", err)
+		}
+		printDone(opResult{Op: "restore", Path: entry.OriginalPath}, tr("File restored successfully: %s", entry.OriginalPath))
+	}
+	return nil
+}
+
+// permanently delete everything in the trash
+func runEmptyTrash(args []string) error {
+	flags := newFlagSet("empty-trash")
+	force := flags.Bool("force", false, "Do not ask for confirmation")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	if !*force && !confirm(tr("Permanently delete everything in the trash?")) {
+		printDone(opResult{Op: "empty-trash", Skipped: true}, tr("Empty trash cancelled."))
+		return nil
+	}
+	count, err := emptyTrash()
+	if err != nil {
+		return fail("emptying trash", err)
+	}
+	printDone(opResult{Op: "empty-trash"}, tr("Trash emptied: %d item(s) deleted", count))
+	return nil
+}
+
+// roll back the last journaled operation, or a named one
+func runUndo(args []string) error {
+	flags := newFlagSet("undo")
+	list := flags.Bool("list", false, "List operations that can be undone")
+	prune := flags.String("prune", "", "Forget operations older than this age, such as 30d, and delete what was saved to undo them")
+	purge := flags.Bool("purge", false, "Forget every operation and empty the journal store")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := exclusiveFlags(flags, "list", "prune", "purge"); err != nil {
+		return usageError("undoing operation", err)
+	}
+	if (*prune != "" || *purge) && flags.NArg() > 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if *prune != "" || *purge {
+		return forgetJournal(*prune, *purge)
+	}
+
+	entries, err := undoableEntries()
+	if err != nil {
+		return fail("reading journal", err)
+	}
+	if *list {
+		if opts.JSON {
+			printJSON(entries)
+			return nil
+		}
+		fmt.Println(tr("Operations that can be undone:"))
+		for _, entry := range entries {
+			fmt.Printf("%s  %s  %-7s %s %s\n", entry.ID, entry.Time.Format(time.DateTime), entry.Op, entry.Path, entry.Dest)
+		}
+		return nil
+	}
+	if len(entries) == 0 {
+		return fail("undoing operation", fmt.Errorf("nothing to undo"))
+	}
+
+	entry := entries[0]
+	if flags.NArg() == 1 {
+		found := false
+		for _, candidate := range entries {
+			if candidate.ID == flags.Arg(0) {
+				entry, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return fail("undoing operation", fmt.Errorf("no undoable journal entry %s", flags.Arg(0)))
+		}
+	}
+
+	if err := confine(entry.Path); err != nil {
+		return fail("undoing operation", err)
+	}
+	if entry.Dest != "" {
+		if err := confine(entry.Dest); err != nil {
+			return fail("undoing operation", err)
+		}
+	}
+	if err := undoEntry(entry); err != nil {
+		return fail("undoing operation", err)
+	}
+	printDone(opResult{Op: "undo", Path: entry.Path, Dest: entry.ID},
+		tr("Undid %s of %s (journal entry %s)", entry.Op, entry.Path, entry.ID))
+	return nil
+}
+
+// undo -prune and -purge: forget older operations, or all of them
+func forgetJournal(age string, purge bool) error {
+	before := time.Now()
+	if !purge {
+		keep, err := parseAge(age)
+		if err != nil {
+			return usageError("pruning journal", err)
+		}
+		before = before.Add(-keep)
+	} else if !confirm(tr("Forget every operation, so none can be undone?")) {
+		printDone(opResult{Op: "purge", Skipped: true}, tr("Purge cancelled."))
+		return nil
+	}
+	if opts.DryRun {
+		entries, err := undoableEntries()
+		if err != nil {
+			return fail("reading journal", err)
+		}
+		count := 0
+		for _, entry := range entries {
+			if !entry.Time.After(before) && entry.Op != "mktemp" {
+				count++
+			}
+		}
+		printDone(opResult{Op: "prune", DryRun: true}, tr("Would forget %d operation(s)", count))
+		return nil
+	}
+	count, err := pruneJournal(before)
+	if err != nil {
+		return fail("pruning journal", err)
+	}
+	printDone(opResult{Op: "prune"}, tr("Journal pruned: %d operation(s) forgotten", count))
+	return nil
+}
+
+// print metadata for one or more paths
+func runStat(args []string) error {
+	flags := newFlagSet("stat")
+	follow := false
+	addFollowFlags(flags, &follow)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("reading file info", err)
+	}
+
+	var results []fileStat
+	for _, path := range paths {
+		st, err := statFile(path, follow)
+		if err != nil {
+			return fail("reading file info", err)
+		}
+		if opts.JSON {
+			results = append(results, st)
+			continue
+		}
+		if formatting() {
+			if err := printFormatted(st); err != nil {
+				return fail("formatting output", err)
+			}
+			continue
+		}
+		fmt.Println(st)
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	return nil
+}
+
+// create a directory
+func runMkdir(args []string) error {
+	flags := newFlagSet("mkdir")
+	parents := flags.Bool("parents", false, "Create missing parent directories as needed")
+	modeText := flags.String("mode", "0755", "Permission bits for the new directory, in octal")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	path := flags.Arg(0)
+	if err := confine(path); err != nil {
+		return fail("creating directory", err)
+	}
+
+	mode, err := parseMode(*modeText)
+	if err != nil {
+		return usageError("parsing mode", err)
+	}
+	// journal the outermost directory that will be created, which undo removes
+	var entry *journalEntry
+	if !exists(path) {
+		top := path
+		for parent := filepath.Dir(top); parent != top && !exists(parent); parent = filepath.Dir(top) {
+			top = parent
+		}
+		if entry, err = journalPrepare("mkdir", top, ""); err != nil {
+			return fail("journaling mkdir", err)
+		}
+	}
+	if err := journalFinish(entry, fileops.Mkdir(cmdCtx, fsys, path, fileops.MkdirOptions{Perm: mode, Parents: *parents})); err != nil {
+		return fail("creating directory", err)
+	}
+	printDone(opResult{Op: "mkdir", Path: path}, tr("Directory created successfully: %s", path))
+	return nil
+}
+
+// print the checksum of one or more files
+func runHash(args []string) error {
+	flags := newFlagSet("hash")
+	algo := flags.String("algo", cfg.HashAlgo, "Hash algorithm: md5, sha1, sha256 or sha512")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if _, err := newHasher(*algo); err != nil {
+		return usageError("hashing file", err)
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("hashing file", err)
+	}
+
+	var results []hashResult
+	p := startProgress("hash", totalSize(paths...))
+	defer p.finish()
+	for _, path := range paths {
+		digest, err := hashFileProgress(path, *algo, p)
+		if err != nil {
+			return fail("hashing file", err)
+		}
+		if opts.JSON {
+			results = append(results, hashResult{Path: path, Algo: *algo, Digest: digest})
+			continue
+		}
+		if formatting() {
+			if err := printFormatted(hashResult{Path: path, Algo: *algo, Digest: digest}); err != nil {
+				return fail("formatting output", err)
+			}
+			continue
+		}
+		clearProgress()
+		fmt.Printf("%s  %s\n", digest, path)
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	return nil
+}
+
+// parse an octal permission string such as 0755
+func parseMode(text string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(text, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an octal mode", text)
+	}
+	if mode > 0o777 {
+		return 0, fmt.Errorf("%q is out of range", text)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ask the user a yes/no question, defaulting to no; -yes answers for them
+func confirm(question string) bool {
+	if opts.Yes {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "%s %s: ", question, tr("[y/N]"))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes" || answer == tr("yes")
+}
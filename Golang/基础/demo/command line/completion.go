@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// a flag as offered by shell completion
+type completionFlag struct {
+	Name  string
+	Usage string
+	Bool  bool // takes no value
+}
+
+// a subcommand as offered by shell completion
+type completionCommand struct {
+	Name    string
+	Summary string
+	Flags   []completionFlag
+	Words   []string // fixed arguments, completed instead of paths
+}
+
+// everything a completion script needs to know about the command line
+type completionData struct {
+	Global   []completionFlag
+	Commands []completionCommand
+}
+
+// the flags a flag set defines, sorted by name
+func completionFlags(flags *flag.FlagSet) []completionFlag {
+	var result []completionFlag
+	flags.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		result = append(result, completionFlag{Name: f.Name, Usage: f.Usage, Bool: ok && b.IsBoolFlag()})
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// the flags of a command, found by running it with -help while flag
+// sets panic instead of exiting, as in a batch, and print nothing
+func commandFlags(cmd command) (result []completionFlag) {
+	saved, savedOpts := flagErrorHandling, opts
+	flagErrorHandling = flag.PanicOnError
+	var last *flag.FlagSet
+	onNewFlagSet = func(flags *flag.FlagSet) {
+		flags.SetOutput(io.Discard)
+		last = flags
+	}
+	defer func() {
+		flagErrorHandling, opts, onNewFlagSet = saved, savedOpts, nil
+		recover()
+		if last != nil {
+			result = completionFlags(last)
+		}
+	}()
+	cmd.run([]string{"-help"})
+	return nil
+}
+
+// describe the global options and every command for the completion templates
+func collectCompletions() completionData {
+	global := flag.NewFlagSet("fileutil", flag.ContinueOnError)
+	global.String("config", "", "Read defaults from this file instead of the user config file")
+	global.Bool("version", false, "Print the version and build details and exit")
+	global.Bool("read-only", false, "Refuse every command that could change files, for auditing scripts")
+	global.String("root", "", "Confine every path to this directory, which relative paths start from")
+	saved := opts
+	addGlobalFlags(global)
+	opts = saved
+	data := completionData{Global: completionFlags(global)}
+	help := completionCommand{Name: "help", Summary: "Show the options of a command"}
+	for _, cmd := range commands {
+		help.Words = append(help.Words, cmd.name)
+	}
+	data.Commands = append(data.Commands, help)
+	for _, cmd := range commands {
+		c := completionCommand{Name: cmd.name, Summary: cmd.summary, Flags: commandFlags(cmd)}
+		if cmd.name == "completion" {
+			c.Words = completionShells
+		}
+		data.Commands = append(data.Commands, c)
+	}
+	return data
+}
+
+// shells a completion script can be written for
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// functions for quoting descriptions in the completion templates
+var completionFuncs = template.FuncMap{
+	// inside single quotes in sh and fish
+	"sq": func(s string) string { return strings.ReplaceAll(s, "'", `'\''`) },
+	// inside single quotes in PowerShell
+	"psq": func(s string) string { return strings.ReplaceAll(s, "'", "''") },
+	// a zsh _describe entry, where a colon separates the name from its description
+	"zdesc": func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "'", `'\''`), ":", `\:`)
+	},
+	"join": strings.Join,
+	// the flags that take a value, whose argument is not a command name
+	"valued": func(flags []completionFlag) []completionFlag {
+		var result []completionFlag
+		for _, f := range flags {
+			if !f.Bool {
+				result = append(result, f)
+			}
+		}
+		return result
+	},
+}
+
+const bashCompletion = `# bash completion for fileutil; load it with
+#   source <(fileutil completion bash)
+_fileutil() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" cmd="" i word skip=""
+    local valued="{{range valued .Global}} -{{.Name}}{{end}} "
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        if [[ -n $skip ]]; then
+            skip=""
+        elif [[ $word == -* ]]; then
+            [[ $word != *=* && $valued == *" $word "* ]] && skip=1
+        else
+            cmd="$word"
+            break
+        fi
+    done
+
+    if [[ -z $cmd ]]; then
+        if [[ $cur == -* ]]; then
+            COMPREPLY=($(compgen -W "{{range .Global}} -{{.Name}}{{end}}" -- "$cur"))
+        else
+            COMPREPLY=($(compgen -W "{{range .Commands}} {{.Name}}{{end}}" -- "$cur"))
+        fi
+        return
+    fi
+
+    local flags="" words=""
+    case "$cmd" in
+{{- range .Commands}}
+        {{.Name}}) flags="{{range .Flags}} -{{.Name}}{{end}}" words="{{range .Words}} {{.}}{{end}}" ;;
+{{- end}}
+    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ -n $words ]]; then
+        COMPREPLY=($(compgen -W "$words" -- "$cur"))
+    fi
+    # anything else falls back to completing paths
+}
+complete -o default -o bashdefault -F _fileutil fileutil
+`
+
+const zshCompletion = `#compdef fileutil
+# zsh completion for fileutil; save it as _fileutil in a directory on $fpath,
+# or load it with: source <(fileutil completion zsh)
+_fileutil() {
+    local -a commands global flags fixed
+    local cmd i skip
+    local valued=" {{range valued .Global}}-{{.Name}} {{end}}"
+    commands=(
+{{- range .Commands}}
+        '{{zdesc .Name}}:{{zdesc .Summary}}'
+{{- end}}
+    )
+    global=({{range .Global}} '-{{sq .Name}}'{{end}})
+    for ((i = 2; i < CURRENT; i++)); do
+        if [[ -n $skip ]]; then
+            skip=
+        elif [[ $words[i] == -* ]]; then
+            [[ $words[i] != *=* && $valued == *" $words[i] "* ]] && skip=1
+        else
+            cmd=$words[i]
+            break
+        fi
+    done
+
+    if [[ -z $cmd ]]; then
+        if [[ $PREFIX == -* ]]; then
+            compadd -- $global
+        else
+            _describe command commands
+        fi
+        return
+    fi
+
+    case $cmd in
+{{- range .Commands}}
+        {{.Name}}) flags=({{range .Flags}} '-{{sq .Name}}'{{end}}) fixed=({{range .Words}} '{{sq .}}'{{end}}) ;;
+{{- end}}
+    esac
+    if [[ $PREFIX == -* ]]; then
+        compadd -- $flags
+    elif (( $#fixed )); then
+        compadd -- $fixed
+    else
+        _files
+    fi
+}
+if [[ $funcstack[1] == _fileutil ]]; then
+    _fileutil "$@"
+else
+    compdef _fileutil fileutil
+fi
+`
+
+const fishCompletion = `# fish completion for fileutil; load it with
+#   fileutil completion fish | source
+complete -c fileutil -f
+{{- range .Global}}
+complete -c fileutil -n __fish_use_subcommand -o '{{sq .Name}}'{{if not .Bool}} -r{{end}} -d '{{sq .Usage}}'
+{{- end}}
+{{- range .Commands}}
+complete -c fileutil -n __fish_use_subcommand -a '{{sq .Name}}' -d '{{sq .Summary}}'
+{{- end}}
+{{- range $cmd := .Commands}}
+{{- range .Flags}}
+complete -c fileutil -n '__fish_seen_subcommand_from {{sq $cmd.Name}}' -o '{{sq .Name}}'{{if not .Bool}} -r{{end}} -d '{{sq .Usage}}'
+{{- end}}
+{{- if .Words}}
+complete -c fileutil -n '__fish_seen_subcommand_from {{sq .Name}}' -a '{{sq (join .Words " ")}}'
+{{- else}}
+complete -c fileutil -n '__fish_seen_subcommand_from {{sq .Name}}' -F
+{{- end}}
+{{- end}}
+`
+
+const powershellCompletion = `# PowerShell completion for fileutil; load it with
+#   fileutil completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName fileutil -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $commands = [ordered]@{
+{{- range .Commands}}
+        '{{psq .Name}}' = '{{psq .Summary}}'
+{{- end}}
+    }
+    $global = @({{range $i, $f := .Global}}{{if $i}}, {{end}}'-{{psq $f.Name}}'{{end}})
+    $valued = @({{range $i, $f := valued .Global}}{{if $i}}, {{end}}'-{{psq $f.Name}}'{{end}})
+    $flags = @{
+{{- range .Commands}}
+        '{{psq .Name}}' = @({{range $i, $f := .Flags}}{{if $i}}, {{end}}'-{{psq $f.Name}}'{{end}})
+{{- end}}
+    }
+    $words = @{
+{{- range .Commands}}{{if .Words}}
+        '{{psq .Name}}' = @({{range $i, $w := .Words}}{{if $i}}, {{end}}'{{psq $w}}'{{end}})
+{{- end}}{{end}}
+    }
+
+    $cmd = $null
+    $skip = $false
+    foreach ($element in $commandAst.CommandElements | Select-Object -Skip 1) {
+        if ($element.Extent.StartOffset -ge $cursorPosition) { break }
+        $word = $element.ToString()
+        if ($word -eq $wordToComplete -and $element.Extent.EndOffset -ge $cursorPosition) { break }
+        if ($skip) { $skip = $false }
+        elseif ($word.StartsWith('-')) { $skip = $valued -contains $word }
+        else { $cmd = $word; break }
+    }
+
+    if ($wordToComplete.StartsWith('-')) {
+        $candidates = if ($cmd) { $flags[$cmd] } else { $global }
+        $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterName', $_)
+        }
+    } elseif (-not $cmd) {
+        $commands.Keys | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'Command', $commands[$_])
+        }
+    } elseif ($words.ContainsKey($cmd)) {
+        $words[$cmd] | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+        }
+    } else {
+        Get-ChildItem -Path "$wordToComplete*" -ErrorAction SilentlyContinue | ForEach-Object {
+            $path = Resolve-Path -Relative -LiteralPath $_.FullName
+            if ($_.PSIsContainer) { $path += [IO.Path]::DirectorySeparatorChar }
+            [System.Management.Automation.CompletionResult]::new($path, $path, 'ProviderItem', $path)
+        }
+    }
+}
+`
+
+// completion templates by shell
+var completionScripts = map[string]string{
+	"bash":       bashCompletion,
+	"zsh":        zshCompletion,
+	"fish":       fishCompletion,
+	"powershell": powershellCompletion,
+}
+
+// print a completion script for a shell
+func runCompletion(args []string) error {
+	flags := newFlagSet("completion")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	script, ok := completionScripts[flags.Arg(0)]
+	if !ok {
+		return usageError("writing completion script", fmt.Errorf("unknown shell %q (want %s)", flags.Arg(0), strings.Join(completionShells, ", ")))
+	}
+	tmpl := template.Must(template.New(flags.Arg(0)).Funcs(completionFuncs).Parse(script))
+	if err := tmpl.Execute(os.Stdout, collectCompletions()); err != nil {
+		return fail("writing completion script", err)
+	}
+	return nil
+}
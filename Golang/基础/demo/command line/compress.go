@@ -0,0 +1,298 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// settings shared by compress and decompress
+type compressOptions struct {
+	Algo      string
+	Level     int
+	Recursive bool
+	Keep      bool
+	Force     bool
+	// remove the input by shredding it and journal nothing, so no copy of
+	// it is left behind
+	Shred    bool
+	Progress *progress // counts the bytes read from each source
+}
+
+// collect the files to work on, walking directories when recursive;
+// want selects which files found inside directories are picked up
+func compressTargets(paths []string, recursive bool, want func(string) bool) ([]string, error) {
+	var targets []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			targets = append(targets, path)
+			continue
+		}
+		if !recursive {
+			return nil, fmt.Errorf("%s is a directory (use -recursive)", path)
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() && want(p) {
+				targets = append(targets, p)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// write src through convert into dest, then give dest the mode and
+// modification time of src and remove src unless keep is set
+func convertFile(op string, src string, dest string, o compressOptions, convert func(io.Writer, io.Reader, fs.FileInfo) error) (opResult, error) {
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return opResult{}, err
+	}
+	result := opResult{Op: op, Path: src, Dest: dest, Bytes: info.Size(), Overwrite: exists(dest)}
+	if result.Overwrite && !o.Force {
+		return result, fmt.Errorf("%s already exists (use -force to overwrite)", dest)
+	}
+	if opts.DryRun {
+		result.DryRun = true
+		return result, nil
+	}
+
+	in, err := fsys.Open(src)
+	if err != nil {
+		return result, err
+	}
+	defer in.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(convert(pw, o.Progress.reader(interruptible(cmdCtx, in)), info))
+	}()
+
+	// undoing the write would leave neither file when the input is shredded
+	var entry *journalEntry
+	if !o.Shred {
+		if entry, err = journalPrepare("copy", src, dest); err != nil {
+			return result, err
+		}
+	}
+	err = writeFileAtomic(dest, pr)
+	pr.CloseWithError(err)
+	if err == nil {
+		if err = fsys.Chmod(dest, info.Mode().Perm()); err == nil {
+			err = fsys.Chtimes(dest, info.ModTime(), info.ModTime())
+		}
+	}
+	if err := journalFinish(entry, err); err != nil {
+		return result, err
+	}
+	if !o.Keep {
+		in.Close()
+		remove := func() error { return deleteJournaled(src, false) }
+		if o.Shred {
+			remove = func() error { return shredFile(fsys, src, 1) }
+		}
+		if err := remove(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// compress r into w; gzip also records the original name and modification time
+func compressStream(c codec, w io.Writer, r io.Reader, info fs.FileInfo, level int) error {
+	zw, err := c.NewWriter(w, level)
+	if err != nil {
+		return err
+	}
+	if gz, ok := zw.(*gzip.Writer); ok {
+		gz.Name = info.Name()
+		gz.ModTime = info.ModTime()
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// the name to decompress src to: src without the format's suffix, else
+// the name gzip recorded when compressing it, beside src, else src.out
+func decompressedName(src string, c codec) string {
+	if dest := strings.TrimSuffix(src, c.Ext()); dest != src {
+		return dest
+	}
+	if _, ok := c.(gzipCodec); ok {
+		if name := gzipName(src); name != "" {
+			if dest := filepath.Join(filepath.Dir(src), name); dest != src {
+				return dest
+			}
+		}
+	}
+	return src + ".out"
+}
+
+// the file name in the header of a gzip file, without any directory, or ""
+func gzipName(path string) string {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+	name := filepath.Base(filepath.FromSlash(zr.Name))
+	if zr.Name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return ""
+	}
+	return name
+}
+
+// decompress r into w
+func decompressStream(c codec, w io.Writer, r io.Reader) error {
+	zr, err := c.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	_, err = io.Copy(w, zr)
+	return err
+}
+
+// print the result of compressing or decompressing one file
+func printConverted(result opResult) {
+	if result.DryRun {
+		printPlan(result)
+		return
+	}
+	format := "Compressed %s to %s"
+	if result.Op == "decompress" {
+		format = "Decompressed %s to %s"
+	}
+	printDone(result, tr(format, result.Path, result.Dest))
+}
+
+// add the shared compress and decompress flags
+func addCompressFlags(flags *flag.FlagSet, o *compressOptions) {
+	flags.StringVar(&o.Algo, "algo", o.Algo, "Compression format: gzip, zstd, xz or bzip2")
+	flags.BoolVar(&o.Recursive, "recursive", false, "Process every file under directories")
+	flags.BoolVar(&o.Keep, "keep", false, "Keep the input files instead of removing them")
+	flags.BoolVar(&o.Force, "force", false, "Overwrite existing output files")
+}
+
+// compress files
+func runCompress(args []string) error {
+	flags := newFlagSet("compress")
+	o := compressOptions{Algo: defaultCodec}
+	flags.IntVar(&o.Level, "level", 0, "Compression level from 1 (fastest) to 9 (smallest), or 0 for the format's default")
+	addCompressFlags(flags, &o)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if o.Level < 0 || o.Level > 9 {
+		return usageError("compressing file", fmt.Errorf("-level must be between 1 and 9"))
+	}
+	c, err := findCodec(o.Algo)
+	if err != nil {
+		return usageError("compressing file", err)
+	}
+	// refuse before any file is touched rather than on the first one
+	if _, ok := c.(bzip2Codec); ok {
+		return usageError("compressing file", errDecompressOnly)
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("compressing file", err)
+	}
+	targets, err := compressTargets(paths, o.Recursive, func(path string) bool {
+		return codecForExt(path) == nil
+	})
+	if err != nil {
+		return fail("compressing file", err)
+	}
+
+	o.Progress = startProgress("compress", totalSize(targets...))
+	defer o.Progress.finish()
+	for _, src := range targets {
+		result, err := convertFile("compress", src, src+c.Ext(), o, func(w io.Writer, r io.Reader, info fs.FileInfo) error {
+			return compressStream(c, w, r, info, o.Level)
+		})
+		if err != nil {
+			return fail("compressing file", err)
+		}
+		printConverted(result)
+	}
+	return nil
+}
+
+// decompress files, detecting the format unless -algo is given
+func runDecompress(args []string) error {
+	flags := newFlagSet("decompress")
+	var o compressOptions
+	addCompressFlags(flags, &o)
+	output := flags.String("o", "", "File to write, when decompressing a single file (default: PATH without its suffix, the name gzip recorded, or PATH.out)")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	var forced codec
+	if o.Algo != "" {
+		var err error
+		if forced, err = findCodec(o.Algo); err != nil {
+			return usageError("decompressing file", err)
+		}
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("decompressing file", err)
+	}
+	targets, err := compressTargets(paths, o.Recursive, func(path string) bool {
+		return codecForExt(path) != nil
+	})
+	if err != nil {
+		return fail("decompressing file", err)
+	}
+	if *output != "" && len(targets) != 1 {
+		return usageError("decompressing file", errors.New("-o needs a single file to decompress"))
+	}
+
+	o.Progress = startProgress("decompress", totalSize(targets...))
+	defer o.Progress.finish()
+	for _, src := range targets {
+		c := forced
+		if c == nil {
+			if c, err = detectCodec(src); err != nil {
+				return fail("decompressing file", err)
+			}
+		}
+		dest := *output
+		if dest == "" {
+			dest = decompressedName(src, c)
+		}
+		result, err := convertFile("decompress", src, dest, o, func(w io.Writer, r io.Reader, _ fs.FileInfo) error {
+			return decompressStream(c, w, r)
+		})
+		if err != nil {
+			return fail("decompressing file", err)
+		}
+		printConverted(result)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reader over the given files in order with sep between them; the caller
+// closes the returned files once the reader has been consumed
+func concatReader(paths []string, sep string) (io.Reader, []*os.File, error) {
+	var readers []io.Reader
+	var files []*os.File
+	for i, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			closeAll(files)
+			return nil, nil, err
+		}
+		files = append(files, file)
+		if i > 0 && sep != "" {
+			readers = append(readers, strings.NewReader(sep))
+		}
+		readers = append(readers, file)
+	}
+	return io.MultiReader(readers...), files, nil
+}
+
+// close every file, ignoring errors, for files that were only read
+func closeAll(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// interpret escapes such as \n and \t in a separator given on the command line
+func unescape(text string) string {
+	if unquoted, err := strconv.Unquote(`"` + text + `"`); err == nil {
+		return unquoted
+	}
+	return text
+}
+
+// join several files into one
+func runConcat(args []string) error {
+	flags := newFlagSet("concat")
+	separator := flags.String("separator", "", `Text to insert between inputs; escapes such as \n are understood`)
+	newline := flags.Bool("newline", false, "Insert a newline between inputs")
+	backup := addBackupFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := exclusiveFlags(flags, "newline", "separator"); err != nil {
+		return usageError("concatenating files", err)
+	}
+	if err := checkSharedFlags(flags); err != nil {
+		return usageError("concatenating files", err)
+	}
+	sep := unescape(*separator)
+	if *newline {
+		sep = "\n"
+	}
+
+	dest := flags.Arg(flags.NArg() - 1)
+	sources, err := expandPaths(flags.Args()[:flags.NArg()-1])
+	if err != nil {
+		return fail("concatenating files", err)
+	}
+	if err := confine(dest); err != nil {
+		return fail("concatenating files", err)
+	}
+	for _, src := range sources {
+		if same, _ := sameFile(src, dest); same {
+			return usageError("concatenating files", fmt.Errorf("%s is both an input and the destination", src))
+		}
+	}
+
+	input, files, err := concatReader(sources, sep)
+	if err != nil {
+		return fail("concatenating files", err)
+	}
+	defer closeAll(files)
+
+	if opts.DryRun {
+		size, err := io.Copy(io.Discard, input)
+		if err != nil {
+			return fail("concatenating files", err)
+		}
+		plan, err := planWrite("write", dest, size)
+		if err != nil {
+			return fail("concatenating files", err)
+		}
+		printPlan(plan)
+		return nil
+	}
+	backupPath, err := backupFile(dest, backup)
+	if err != nil {
+		return fail("backing up file", err)
+	}
+	entry, err := journalPrepare("write", dest, "")
+	if err != nil {
+		return fail("journaling write", err)
+	}
+	if err := journalFinish(entry, writeFileAtomic(dest, input)); err != nil {
+		return fail("concatenating files", err)
+	}
+	printDone(opResult{Op: "concat", Path: dest, Backup: backupPath},
+		withBackup(tr("Concatenated %d files into %s", len(sources), dest), backupPath))
+	return nil
+}
+
+// report whether two paths name the same existing file
+func sameFile(a string, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaults read from the config file, then from FILEUTIL_* environment
+// variables; flags given on the command line override both
+type config struct {
+	HashAlgo string      `yaml:"hash_algo"`
+	Preserve string      `yaml:"preserve"`
+	Color    string      `yaml:"color"`
+	Trash    string      `yaml:"trash"`
+	Ignore   patternList `yaml:"ignore"`
+	Jobs     int         `yaml:"jobs"`
+	AuditLog string      `yaml:"audit_log"`
+	// how long undo information is kept, such as 30d, or 0 for ever
+	JournalKeep string `yaml:"journal_keep"`
+	// the most data one operation may save for undo when it has to be
+	// copied rather than moved, such as 1G
+	JournalMaxCopy string `yaml:"journal_max_copy"`
+
+	journalKeep    time.Duration
+	journalMaxCopy int64
+}
+
+// settings in effect, filled in by loadConfig before the command runs
+var cfg = config{HashAlgo: defaultHashAlgo, Color: "auto", Jobs: 1, JournalKeep: "30d", JournalMaxCopy: "1G"}
+
+// config file used when -config is not given, following the XDG convention
+// like dataDir
+func defaultConfigPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "fileutil", "config.yaml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "fileutil", "config.yaml"), nil
+}
+
+// apply the config file and then the environment to cfg; a missing file is
+// only an error when it was named explicitly
+func loadConfig(path string) error {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			// no home directory to look in
+			path = ""
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := parseConfig(data, &cfg); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			logger().Debug("loaded config", "path", path)
+		case explicit || !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+	}
+	if err := applyConfigEnv(&cfg); err != nil {
+		return err
+	}
+	return cfg.check()
+}
+
+// decode YAML settings over c, rejecting unknown keys so typos are noticed
+func parseConfig(data []byte, c *config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// override settings from FILEUTIL_HASH_ALGO, FILEUTIL_PRESERVE, FILEUTIL_COLOR,
+// FILEUTIL_TRASH, FILEUTIL_IGNORE (comma-separated), FILEUTIL_AUDIT_LOG, FILEUTIL_JOBS,
+// FILEUTIL_JOURNAL_KEEP and FILEUTIL_JOURNAL_MAX_COPY
+func applyConfigEnv(c *config) error {
+	if v, ok := os.LookupEnv("FILEUTIL_HASH_ALGO"); ok {
+		c.HashAlgo = v
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_PRESERVE"); ok {
+		c.Preserve = v
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_COLOR"); ok {
+		c.Color = v
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_TRASH"); ok {
+		c.Trash = v
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_IGNORE"); ok {
+		c.Ignore = nil
+		for _, pattern := range strings.Split(v, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				c.Ignore = append(c.Ignore, pattern)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_AUDIT_LOG"); ok {
+		c.AuditLog = v
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_JOBS"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("FILEUTIL_JOBS: %q is not a number", v)
+		}
+		c.Jobs = n
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_JOURNAL_KEEP"); ok {
+		c.JournalKeep = v
+	}
+	if v, ok := os.LookupEnv("FILEUTIL_JOURNAL_MAX_COPY"); ok {
+		c.JournalMaxCopy = v
+	}
+	return nil
+}
+
+// validate the settings, so a bad value is reported once rather than by each command
+func (c *config) check() error {
+	if _, err := newHasher(c.HashAlgo); err != nil {
+		return fmt.Errorf("hash_algo: %w", err)
+	}
+	if _, err := parsePreserve(c.Preserve); err != nil {
+		return fmt.Errorf("preserve: %w", err)
+	}
+	switch c.Color {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("color: %q is not auto, always or never", c.Color)
+	}
+	for _, pattern := range c.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("ignore: bad pattern %q: %w", pattern, err)
+		}
+	}
+	if c.Jobs < 1 {
+		return fmt.Errorf("jobs: must be at least 1")
+	}
+	var err error
+	if c.journalKeep, err = parseAge(c.JournalKeep); err != nil || c.journalKeep < 0 {
+		return fmt.Errorf("journal_keep: %q is not an age such as 30d, or 0", c.JournalKeep)
+	}
+	if c.journalMaxCopy, err = parseSize(c.JournalMaxCopy); err != nil {
+		return fmt.Errorf("journal_max_copy: %w", err)
+	}
+	if c.Trash, err = expandConfigPath(c.Trash); err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	if c.AuditLog, err = expandConfigPath(c.AuditLog); err != nil {
+		return fmt.Errorf("audit_log: %w", err)
+	}
+	return nil
+}
+
+// make a path from the config absolute, with a leading ~ standing for the home directory
+func expandConfigPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(path, "~"+string(filepath.Separator)) || path == "~" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
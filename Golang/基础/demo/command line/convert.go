@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cmdline/fileops"
+)
+
+// the UTF-8 byte order mark some Windows editors put at the start of files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// settings for convert
+type convertOptions struct {
+	// line ending to use: "lf", "crlf" or empty to leave them alone
+	EOL      string
+	StripBOM bool
+	// re-encode text from From, or the encoding detected when it is nil,
+	// into To
+	Iconv bool
+	From  *textEncoding
+	To    textEncoding
+}
+
+// the converted contents of a text file, and the encoding it was read in
+func convertText(data []byte, o convertOptions) ([]byte, textEncoding, error) {
+	from := utf8Encoding
+	if o.Iconv {
+		from = detectEncoding(data)
+		if o.From != nil {
+			from = *o.From
+		}
+		text, err := decodeText(data, from)
+		if err != nil {
+			return nil, from, fmt.Errorf("decoding %s: %w", from.Name, err)
+		}
+		data = text
+	}
+	if o.StripBOM {
+		data = bytes.TrimPrefix(data, utf8BOM)
+	}
+	switch o.EOL {
+	case "lf":
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	case "crlf":
+		// go through LF so existing CRLF endings are not doubled
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	if o.Iconv {
+		text, err := encodeText(data, o.To)
+		if err != nil {
+			return nil, from, fmt.Errorf("encoding %s: %w", o.To.Name, err)
+		}
+		data = text
+	}
+	return data, from, nil
+}
+
+// counts of what convert did
+type convertSummary struct {
+	Converted int `json:"converted"`
+	Unchanged int `json:"unchanged"`
+	Binary    int `json:"binary"`
+}
+
+// convert one file in place, keeping a backup and a journal entry
+func convertTextFile(path string, o convertOptions, backup *backupOptions, summary *convertSummary) error {
+	data, err := fileops.Read(cmdCtx, fsys, path)
+	if err != nil {
+		return err
+	}
+	if looksBinary(data) && !(o.Iconv && hasUTF16BOM(data)) {
+		printVerbose("skipped binary file %s\n", path)
+		summary.Binary++
+		return nil
+	}
+	converted, from, err := convertText(data, o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if bytes.Equal(converted, data) {
+		if o.Iconv {
+			printVerbose("%s is already %s\n", path, o.To.Name)
+		}
+		summary.Unchanged++
+		return nil
+	}
+	summary.Converted++
+	if opts.DryRun {
+		result := opResult{Op: "convert", Path: path, DryRun: true, Bytes: int64(len(converted))}
+		if !o.Iconv {
+			printPlan(result)
+			return nil
+		}
+		result.Encoding = from.Name
+		printDone(result, tr("Would convert %s from %s to %s (%d bytes)", path, from.Name, o.To.Name, result.Bytes))
+		return nil
+	}
+	backupPath, err := backupFile(path, backup)
+	if err != nil {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+	entry, err := journalPrepare("write", path, "")
+	if err != nil {
+		return err
+	}
+	if err := journalFinish(entry, writeFileAtomic(path, bytes.NewReader(converted))); err != nil {
+		return err
+	}
+	printVerbose("converted %s\n", path)
+	if backupPath != "" {
+		printVerbose("saved %s\n", backupPath)
+	}
+	return nil
+}
+
+// convert a file, or with recursive every file under a directory
+func convertPath(root string, recursive bool, filter *treeFilter, o convertOptions, backup *backupOptions, summary *convertSummary) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return convertTextFile(root, o, backup, summary)
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (use -recursive)", root)
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := canceled(cmdCtx); err != nil {
+			return err
+		}
+		if filter.excluded(root, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// nor the backups an earlier run left
+		if !d.Type().IsRegular() || backup.Enabled && strings.HasSuffix(path, backup.Suffix) {
+			return nil
+		}
+		return convertTextFile(path, o, backup, summary)
+	})
+}
+
+// convert line endings and strip byte order marks of text files in place
+func runConvert(args []string) error {
+	flags := newFlagSet("convert")
+	var o convertOptions
+	flags.Func("convert-eol", "Rewrite line endings as lf or crlf", func(text string) error {
+		if text != "lf" && text != "crlf" {
+			return fmt.Errorf("use lf or crlf")
+		}
+		o.EOL = text
+		return nil
+	})
+	flags.BoolVar(&o.StripBOM, "strip-bom", false, "Remove the UTF-8 byte order mark at the start of files")
+	flags.BoolVar(&o.Iconv, "iconv", false, "Re-encode text from its encoding, detected among UTF-8, UTF-16, GBK/GB18030, Shift-JIS and Latin-1, into -to")
+	flags.Func("from", "Encoding of the files for -iconv, instead of detecting it, e.g. gbk", func(text string) error {
+		enc, err := lookupEncoding(text)
+		o.From = &enc
+		return err
+	})
+	o.To = utf8Encoding
+	flags.Func("to", "Encoding -iconv writes, e.g. shift_jis (default utf-8)", func(text string) error {
+		enc, err := lookupEncoding(text)
+		o.To = enc
+		return err
+	})
+	recursive := flags.Bool("recursive", false, "Convert every file under directories")
+	noBackup := flags.Bool("no-backup", false, "Do not keep a .bak copy of converted files")
+	filter := addTreeFilterFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	for _, name := range []string{"from", "to"} {
+		if err := requireFlags(flags, name, "iconv"); err != nil {
+			return usageError("converting files", err)
+		}
+	}
+	if o.EOL == "" && !o.StripBOM && !o.Iconv {
+		return usageError("converting files", errors.New(tr("give -convert-eol, -strip-bom, -iconv or several of them")))
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("converting files", err)
+	}
+
+	backup := &backupOptions{Enabled: !*noBackup, Suffix: ".bak"}
+	var summary convertSummary
+	for _, path := range paths {
+		if err := convertPath(path, *recursive, filter, o, backup, &summary); err != nil {
+			return fail("converting files", err)
+		}
+	}
+	if opts.JSON {
+		printJSON(summary)
+		return nil
+	}
+	format := "Converted %d files, %d unchanged, %d binary skipped\n"
+	if opts.DryRun {
+		format = "Would convert %d files, %d unchanged, %d binary skipped\n"
+	}
+	printInfo(format, summary.Converted, summary.Unchanged, summary.Binary)
+	return nil
+}
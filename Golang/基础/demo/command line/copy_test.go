@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// -verify checks only what the filters let through, since the files they
+// left out are not in the copy
+func TestCopyVerifyWithFilters(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	savedOpts := opts
+	t.Cleanup(func() { opts = savedOpts })
+
+	base := t.TempDir()
+	src := filepath.Join(base, "src")
+	files := map[string]string{
+		"keep.txt":         "kept",
+		"skip.tmp":         "excluded",
+		"sub/deep.txt":     "kept",
+		"sub/deep.tmp":     "excluded",
+		"cache/data":       "excluded by directory",
+		"ignored/file.txt": "ignored by " + ignoreFileName,
+		ignoreFileName:     "ignored/\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := filepath.Join(base, "dest")
+
+	err := runCopy([]string{"-recursive", "-verify", "-exclude", "*.tmp", "-exclude", "cache", src, dest})
+	if err != nil {
+		t.Fatalf("copy -verify: %v", err)
+	}
+	for _, name := range []string{"skip.tmp", "sub/deep.tmp", "cache", "ignored"} {
+		if _, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s was copied: %v", name, err)
+		}
+	}
+
+	// without the filter, the files left out count as missing
+	if err := verifyCopy(src, dest, nil); err == nil {
+		t.Errorf("verifying without the filter succeeded, want the left out files missing")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"cmdline/fileops"
+)
+
+// settings for the loop that copies file contents, set with -reflink,
+// -sparse, -preallocate, -buffer-size and -fsync
+var copyTuning = struct {
+	Reflink     string
+	Sparse      bool
+	Preallocate bool
+	BufferSize  int
+	Fsync       bool
+}{Reflink: "auto", Preallocate: true}
+
+// register -reflink, -sparse, -preallocate, -buffer-size and -fsync for commands that copy file contents
+func addCopyTuningFlags(flags *flag.FlagSet) {
+	flags.Func("reflink", "Clone files copy-on-write: auto (when the filesystem can), always or never (default auto)", func(text string) error {
+		if text != "auto" && text != "always" && text != "never" {
+			return fmt.Errorf("use auto, always or never")
+		}
+		copyTuning.Reflink = text
+		return nil
+	})
+	flags.BoolVar(&copyTuning.Sparse, "sparse", false, "Recreate holes of sparse files instead of filling them with zeros")
+	flags.BoolVar(&copyTuning.Preallocate, "preallocate", true, "Reserve disk space for each file before copying it, so a full disk is noticed at the start")
+	flags.Func("buffer-size", "Size of the buffer used to copy file contents, e.g. 4M (default: chosen by the system)", func(text string) error {
+		size, err := parseSize(text)
+		if err != nil {
+			return err
+		}
+		if size <= 0 || size > 1<<30 {
+			return fmt.Errorf("buffer size must be between 1 byte and 1G")
+		}
+		copyTuning.BufferSize = int(size)
+		return nil
+	})
+	flags.BoolVar(&copyTuning.Fsync, "fsync", false, "Flush each copied file and its directory entry to disk before reporting success")
+}
+
+// copy the rest of src into dest, with progress, -reflink, -sparse,
+// -preallocate, -bwlimit and -buffer-size
+func copyContents(dest *os.File, src *os.File, p *progress) error {
+	if copyTuning.Reflink != "never" {
+		if cloned, err := reflink(dest, src, p); cloned || err != nil {
+			return err
+		}
+	}
+	if copyTuning.Sparse {
+		return copySparse(dest, src, p)
+	}
+	if copyTuning.Preallocate {
+		if err := preallocateRest(dest, src); err != nil {
+			return err
+		}
+	}
+	if copyTuning.Reflink != "never" && p == nil && bwLimiter == nil && copyTuning.BufferSize == 0 {
+		return copyInKernel(dest, src)
+	}
+	return copyBuffered(dest, src, p)
+}
+
+// reserve space in dest for the rest of src, starting at src's read position
+func preallocateRest(dest *os.File, src *os.File) error {
+	off, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= off {
+		return nil
+	}
+	if err := preallocate(dest, off, info.Size()-off); err != nil {
+		return fmt.Errorf("cannot reserve %s for %s: %w", humanSize(info.Size()-off), dest.Name(), err)
+	}
+	return nil
+}
+
+// size of the pieces copied by copyInKernel between checks for cancellation
+const kernelCopyChunk = 64 << 20
+
+// copy the rest of src into dest with io.Copy's fast paths between files:
+// copy_file_range, which stays inside the kernel, and sendfile. A limited
+// reader over a file keeps them, so the copy goes in pieces and can stop
+// when the command is interrupted
+func copyInKernel(dest *os.File, src *os.File) error {
+	for {
+		if err := canceled(cmdCtx); err != nil {
+			return err
+		}
+		n, err := io.Copy(dest, io.LimitReader(src, kernelCopyChunk))
+		if err != nil || n < kernelCopyChunk {
+			return err
+		}
+	}
+}
+
+// copy the rest of src into dest through a buffer of -buffer-size; hiding
+// ReadFrom and WriteTo makes the copy really use it, and keeps
+// copy_file_range from sharing blocks anyway with -reflink never
+func copyBuffered(dest io.Writer, src io.Reader, p *progress) error {
+	buf := make([]byte, cmp.Or(copyTuning.BufferSize, 32*1024))
+	_, err := io.CopyBuffer(struct{ io.Writer }{dest}, struct{ io.Reader }{throttle(p.reader(interruptible(cmdCtx, src)))}, buf)
+	return err
+}
+
+// copy the rest of src into dest, seeking over the holes of src so they
+// stay holes in dest; dest must end where src's read position is
+func copySparse(dest *os.File, src *os.File, p *progress) error {
+	off, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	for {
+		data, hole, err := nextData(src, off)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errors.ErrUnsupported) {
+			if _, err := src.Seek(off, io.SeekStart); err != nil {
+				return err
+			}
+			return copyBuffered(dest, src, p)
+		}
+		if err != nil {
+			return err
+		}
+		p.add(data - off)
+		if _, err := src.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := dest.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if err := copyBuffered(dest, io.LimitReader(src, hole-data), p); err != nil {
+			return err
+		}
+		off = hole
+	}
+	// a trailing hole only needs the file to be long enough
+	p.add(info.Size() - off)
+	return dest.Truncate(info.Size())
+}
+
+// try to clone src into dest, reporting whether it worked. A clone covers
+// the whole file, which is also right when resuming, since the part of dest
+// that is kept already matches src. Errors only matter with -reflink always;
+// otherwise the caller falls back to copying
+func reflink(dest *os.File, src *os.File, p *progress) (bool, error) {
+	err := cloneFile(dest, src)
+	if err != nil {
+		if copyTuning.Reflink == "always" {
+			return false, fmt.Errorf("cannot reflink %s to %s: %w", src.Name(), dest.Name(), err)
+		}
+		return false, nil
+	}
+	offset, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return true, err
+	}
+	info, err := src.Stat()
+	if err != nil {
+		return true, err
+	}
+	p.add(info.Size() - offset)
+	return true, nil
+}
+
+// copy a file
+func copyFile(src string, dest string) error {
+	return copyFileProgress(src, dest, nil)
+}
+
+// copy a file with the -reflink, -sparse, -preallocate, -buffer-size and
+// -fsync settings, counting the bytes towards p
+func copyFileProgress(src string, dest string, p *progress) error {
+	return copyFileOn(fsys, src, dest, p)
+}
+
+// copyFileProgress through the file system on
+func copyFileOn(on fileops.FS, src string, dest string, p *progress) error {
+	return fileops.Copy(cmdCtx, on, src, dest, fileops.CopyOptions{
+		Contents: func(dest fileops.File, src fileops.File) error {
+			destFile, destOK := dest.(*os.File)
+			srcFile, srcOK := src.(*os.File)
+			if !destOK || !srcOK {
+				return copyBuffered(dest, src, p)
+			}
+			if err := copyContents(destFile, srcFile, p); err != nil {
+				return err
+			}
+			return finishCopy(destFile)
+		},
+	})
+}
+
+// with -fsync, flush a copied file and its directory entry to disk
+func finishCopy(dest *os.File) error {
+	if !copyTuning.Fsync {
+		return nil
+	}
+	if err := dest.Sync(); err != nil {
+		return err
+	}
+	return fileops.SyncDir(filepath.Dir(dest.Name()))
+}
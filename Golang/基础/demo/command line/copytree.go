@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"cmdline/fileops"
+)
+
+// copy a directory tree, recreating the structure under dest; symlinks are
+// copied as the files they point to when follow is set and as links otherwise
+func copyDir(src string, dest string, follow bool) error {
+	c := treeCopier{Follow: follow}
+	return c.copy(src, dest)
+}
+
+// settings and state for copying one tree. The tree is walked first,
+// creating directories and symlinks and collecting the files, which are then
+// copied by Jobs workers; hard links and directory metadata come last
+type treeCopier struct {
+	Follow bool
+	// copy the first of several hard links to a file and link the others to
+	// that copy, instead of writing the content once per name
+	Hardlinks bool
+	Preserve  preserveSet
+	// policy for files that already exist under the destination, if any
+	Overwrite *overwriteOptions
+	// paths under the source tree that are not copied, if any
+	Filter *treeFilter
+	// number of files left alone by Overwrite
+	Skipped int
+	// counts the bytes copied, if set
+	Progress *progress
+	// keep the matching start of existing destination files and copy only
+	// the rest, counting the bytes kept in Resumed
+	Resume  bool
+	Resumed int64
+	// files copied at once; with more than one, a failed file does not stop
+	// the others and all failures are reported together
+	Jobs int
+	// print each file as it is copied, for -v
+	Verbose bool
+	// copy the file contents through the OS file system instead of fsys,
+	// for copies into the journal or trash, which lie outside any -root
+	Host bool
+	// the journal entry of a copy into an existing directory, which saves
+	// each file just before the copy replaces it
+	Journal *journalEntry
+
+	mu      sync.Mutex          // guards Resumed while workers run
+	files   []copyJob           // regular files to copy
+	links   []copyJob           // further names of hard-linked files, linked to the first copy
+	dirs    []copyJob           // directories, whose metadata is set once they are filled
+	copied  map[int64][]copyJob // by size, compared with os.SameFile
+	entered []string            // real directories being copied, to stop symlink loops
+	srcRoot string              // the tree being copied, which Filter is applied from
+	dstRoot string
+	cases   *caseCollisions // destination names, when its file system ignores case
+}
+
+// one file or directory to copy
+type copyJob struct {
+	src, dest string
+	info      fs.FileInfo
+}
+
+// the file system files and directories are created through
+func (c *treeCopier) fsys() fileops.FS {
+	if c.Host {
+		return fileops.OS
+	}
+	return fsys
+}
+
+// the absolute path with every symlink along it resolved, where the end
+// of the path need not exist yet
+func resolveMissing(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		parent := filepath.Dir(abs)
+		if !os.IsNotExist(err) || parent == abs {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(abs)}, rest...)
+		abs = parent
+	}
+}
+
+// report whether the clean absolute path is root or below it
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fail, as cp does, when dest is the directory src or lies inside it, since
+// copying a tree into itself would never end
+func checkNotInside(src string, dest string) error {
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return nil
+	}
+	from, err := resolvePath(src)
+	if err != nil {
+		return err
+	}
+	to, err := resolveMissing(dest)
+	if err != nil {
+		return err
+	}
+	if isWithin(from, to) {
+		return fmt.Errorf("cannot copy %s into itself, %s", src, dest)
+	}
+	return nil
+}
+
+// copy src to dest, which may be a file, a directory or a symlink
+func (c *treeCopier) copy(src string, dest string) error {
+	if err := checkNotInside(src, dest); err != nil {
+		return err
+	}
+	c.srcRoot, c.dstRoot = src, dest
+	if !c.Host {
+		c.cases = newCaseCollisions(dest)
+	}
+	if err := c.walk(src, dest); err != nil {
+		return err
+	}
+	if err := runPool(cmdCtx, c.Jobs, len(c.files), func(i int) error {
+		return c.copyFile(c.files[i])
+	}); err != nil {
+		return err
+	}
+	for _, job := range c.links {
+		if err := c.fsys().Link(job.src, job.dest); err != nil {
+			return err
+		}
+	}
+	// deepest first, so setting the times of a directory does not change its parent's
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		if err := preserveMetadata(c.fsys(), c.dirs[i].src, c.dirs[i].dest, c.dirs[i].info, c.Preserve); err != nil {
+			return err
+		}
+	}
+	c.files, c.links, c.dirs = nil, nil, nil
+	return nil
+}
+
+// create the directories and symlinks under dest and queue the files
+func (c *treeCopier) walk(src string, dest string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if !c.Follow {
+			if err := c.Journal.saveBefore(dest); err != nil {
+				return err
+			}
+			if err := copyLink(c.fsys(), src, dest); err != nil {
+				return err
+			}
+			return preserveMetadata(c.fsys(), src, dest, info, c.Preserve)
+		}
+		if info, err = os.Stat(src); err != nil {
+			return err
+		}
+	}
+	if !info.IsDir() {
+		return c.queueFile(copyJob{src, dest, info})
+	}
+
+	// walk the real directory, since WalkDir does not enter a link to one
+	real, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return err
+	}
+	if slices.Contains(c.entered, real) {
+		return fmt.Errorf("symlink loop: %s leads back to %s", src, real)
+	}
+	c.entered = append(c.entered, real)
+	defer func() { c.entered = c.entered[:len(c.entered)-1] }()
+
+	return filepath.WalkDir(real, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := canceled(cmdCtx); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(real, path)
+		if err != nil {
+			return err
+		}
+		// a symlink already under dest must not lead the copy out of it
+		target, err := fileops.SafeJoin(dest, rel)
+		if err != nil {
+			return err
+		}
+		c.cases.add(target)
+		if c.skip(target, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			return c.walk(path, target)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			c.dirs = append(c.dirs, copyJob{path, target, info})
+			if err := c.Journal.saveBefore(target); err != nil {
+				return err
+			}
+			return c.fsys().MkdirAll(target, info.Mode().Perm())
+		}
+		return c.queueFile(copyJob{path, target, info})
+	})
+}
+
+// report whether Filter leaves out the source of target; paths are taken
+// relative to the roots, so directories reached through symlinks are
+// filtered like the rest of the tree
+func (c *treeCopier) skip(target string, isDir bool) bool {
+	if c.Filter == nil {
+		return false
+	}
+	rel, err := filepath.Rel(c.dstRoot, target)
+	if err != nil {
+		return false
+	}
+	return c.Filter.excluded(c.srcRoot, filepath.Join(c.srcRoot, rel), isDir)
+}
+
+// apply the overwrite policy to a file and queue it for copying, or for
+// linking when it is another name of a file already queued
+func (c *treeCopier) queueFile(job copyJob) error {
+	if c.Overwrite != nil {
+		ok, err := c.Overwrite.allow(job.src, job.dest)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.Skipped++
+			return nil
+		}
+	}
+	if err := c.Journal.saveBefore(job.dest); err != nil {
+		return err
+	}
+	if !c.Hardlinks || !job.info.Mode().IsRegular() {
+		c.files = append(c.files, job)
+		return nil
+	}
+	size := job.info.Size()
+	for _, prev := range c.copied[size] {
+		if os.SameFile(job.info, prev.info) {
+			if exists(job.dest) {
+				if err := c.fsys().Remove(job.dest); err != nil {
+					return err
+				}
+			}
+			c.links = append(c.links, copyJob{src: prev.dest, dest: job.dest})
+			return nil
+		}
+	}
+	if c.copied == nil {
+		c.copied = make(map[int64][]copyJob)
+	}
+	c.copied[size] = append(c.copied[size], job)
+	c.files = append(c.files, job)
+	return nil
+}
+
+// copy the contents and selected metadata of one file
+func (c *treeCopier) copyFile(job copyJob) error {
+	logger().Debug("copying file", "src", job.src, "dest", job.dest, "size", job.info.Size())
+	if err := c.copyData(job.src, job.dest); err != nil {
+		return err
+	}
+	if c.Verbose {
+		printVerbose("copied %s -> %s\n", job.src, job.dest)
+	}
+	return preserveMetadata(c.fsys(), job.src, job.dest, job.info, c.Preserve)
+}
+
+// write the contents of src to dest, resuming a partial copy with Resume
+func (c *treeCopier) copyData(src string, dest string) error {
+	if !c.Resume {
+		return copyFileOn(c.fsys(), src, dest, c.Progress)
+	}
+	offset, err := resumeCopy(c.fsys(), src, dest, c.Progress)
+	c.mu.Lock()
+	c.Resumed += offset
+	c.mu.Unlock()
+	return err
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// layout of an encrypted file:
+//
+//	magic "FUENC" and version 1        6 bytes
+//	kdf id                             1 byte
+//	kdf parameters                     9 bytes (uint32, uint32, uint8)
+//	salt                              16 bytes
+//	nonce prefix                       7 bytes
+//	chunk size                         4 bytes
+//	chunks of AES-256-GCM ciphertext, each sealed with the header as
+//	additional data and the nonce prefix + chunk counter + last-chunk flag
+const (
+	cryptMagic      = "FUENC\x01"
+	cryptHeaderSize = 6 + 1 + 9 + 16 + 7 + 4
+	cryptChunkSize  = 64 * 1024
+	cryptKeySize    = 32
+)
+
+// key derivation functions that may be named with -kdf
+const (
+	kdfScrypt = 1
+	kdfArgon2 = 2
+)
+
+// the most memory a kdf named in a header may take; files are checked
+// against the bounds before a key is derived, so a crafted header cannot
+// make decrypt allocate without limit or spin for hours
+const (
+	kdfMaxMemory   = 1 << 30
+	scryptMinLogN  = 10
+	scryptMaxLogN  = 22
+	scryptMaxR     = 32
+	scryptMaxP     = 16
+	argon2MaxTime  = 16
+	argon2MinKiB   = 8 // per thread, as argon2 itself requires
+	argon2MaxProcs = 64
+)
+
+// environment variable read for the passphrase when no file is given
+const passphraseEnv = "FILEUTIL_PASSPHRASE"
+
+// parameters stored in the header of an encrypted file
+type cryptHeader struct {
+	KDF    byte
+	Params [3]uint32 // scrypt: log2 N, r, p; argon2id: time, memory in KiB, threads
+	Salt   [16]byte
+	Prefix [7]byte
+	Chunk  uint32
+	Raw    []byte
+}
+
+// a fresh header for the named kdf with random salt and nonce prefix
+func newCryptHeader(kdf string) (*cryptHeader, error) {
+	h := &cryptHeader{Chunk: cryptChunkSize}
+	switch kdf {
+	case "scrypt":
+		h.KDF, h.Params = kdfScrypt, [3]uint32{15, 8, 1}
+	case "argon2":
+		h.KDF, h.Params = kdfArgon2, [3]uint32{3, 64 * 1024, 4}
+	default:
+		return nil, fmt.Errorf("unknown -kdf %q (use scrypt or argon2)", kdf)
+	}
+	if _, err := rand.Read(h.Salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(h.Prefix[:]); err != nil {
+		return nil, err
+	}
+	h.Raw = h.marshal()
+	return h, nil
+}
+
+// encode the header as it is written at the start of the file
+func (h *cryptHeader) marshal() []byte {
+	buf := bytes.NewBufferString(cryptMagic)
+	buf.WriteByte(h.KDF)
+	binary.Write(buf, binary.BigEndian, h.Params[0])
+	binary.Write(buf, binary.BigEndian, h.Params[1])
+	buf.WriteByte(byte(h.Params[2]))
+	buf.Write(h.Salt[:])
+	buf.Write(h.Prefix[:])
+	binary.Write(buf, binary.BigEndian, h.Chunk)
+	return buf.Bytes()
+}
+
+// read and check the header at the start of an encrypted file
+func readCryptHeader(r io.Reader) (*cryptHeader, error) {
+	raw := make([]byte, cryptHeaderSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, errors.New("not an encrypted file (header too short)")
+	}
+	if string(raw[:6]) != cryptMagic {
+		return nil, errors.New("not an encrypted file (bad magic bytes)")
+	}
+	h := &cryptHeader{KDF: raw[6], Raw: raw}
+	h.Params[0] = binary.BigEndian.Uint32(raw[7:11])
+	h.Params[1] = binary.BigEndian.Uint32(raw[11:15])
+	h.Params[2] = uint32(raw[15])
+	copy(h.Salt[:], raw[16:32])
+	copy(h.Prefix[:], raw[32:39])
+	h.Chunk = binary.BigEndian.Uint32(raw[39:43])
+	if h.Chunk == 0 || h.Chunk > 16*1024*1024 {
+		return nil, fmt.Errorf("bad chunk size %d in header", h.Chunk)
+	}
+	if err := h.checkParams(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// check that the kdf parameters of a header are within the bounds above
+func (h *cryptHeader) checkParams() error {
+	switch h.KDF {
+	case kdfScrypt:
+		logN, r, p := h.Params[0], uint64(h.Params[1]), uint64(h.Params[2])
+		switch {
+		case logN < scryptMinLogN || logN > scryptMaxLogN:
+			return fmt.Errorf("scrypt cost 2^%d in header is out of range (2^%d to 2^%d)", logN, scryptMinLogN, scryptMaxLogN)
+		case r < 1 || r > scryptMaxR:
+			return fmt.Errorf("scrypt block size %d in header is out of range (1 to %d)", r, scryptMaxR)
+		case p < 1 || p > scryptMaxP:
+			return fmt.Errorf("scrypt parallelism %d in header is out of range (1 to %d)", p, scryptMaxP)
+		case 128*r<<logN > kdfMaxMemory:
+			return fmt.Errorf("scrypt parameters in header need more than %s of memory", humanSize(kdfMaxMemory))
+		}
+	case kdfArgon2:
+		passes, memory, threads := h.Params[0], uint64(h.Params[1]), h.Params[2]
+		switch {
+		case passes < 1 || passes > argon2MaxTime:
+			return fmt.Errorf("argon2 time %d in header is out of range (1 to %d)", passes, argon2MaxTime)
+		case threads < 1 || threads > argon2MaxProcs:
+			return fmt.Errorf("argon2 threads %d in header is out of range (1 to %d)", threads, argon2MaxProcs)
+		case memory < argon2MinKiB*uint64(threads):
+			return fmt.Errorf("argon2 memory %d KiB in header is below %d KiB per thread", memory, argon2MinKiB)
+		case memory*1024 > kdfMaxMemory:
+			return fmt.Errorf("argon2 memory %d KiB in header is above %s", memory, humanSize(kdfMaxMemory))
+		}
+	default:
+		return fmt.Errorf("unknown key derivation function %d in header", h.KDF)
+	}
+	return nil
+}
+
+// derive the AES key from a passphrase with the header's kdf and parameters
+func (h *cryptHeader) deriveKey(passphrase []byte) ([]byte, error) {
+	if err := h.checkParams(); err != nil {
+		return nil, err
+	}
+	switch h.KDF {
+	case kdfScrypt:
+		return scrypt.Key(passphrase, h.Salt[:], 1<<h.Params[0], int(h.Params[1]), int(h.Params[2]), cryptKeySize)
+	case kdfArgon2:
+		return argon2.IDKey(passphrase, h.Salt[:], h.Params[0], h.Params[1], uint8(h.Params[2]), cryptKeySize), nil
+	}
+	return nil, fmt.Errorf("unknown key derivation function %d in header", h.KDF)
+}
+
+// nonce for the n-th chunk; the flag keeps the last chunk from being dropped or moved
+func (h *cryptHeader) nonce(n uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, h.Prefix[:])
+	binary.BigEndian.PutUint32(nonce[7:11], n)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// create the AES-GCM cipher for a header and passphrase
+func (h *cryptHeader) aead(passphrase []byte) (cipher.AEAD, error) {
+	key, err := h.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt r into w chunk by chunk
+func encryptStream(w io.Writer, r io.Reader, h *cryptHeader, passphrase []byte) error {
+	gcm, err := h.aead(passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(h.Raw); err != nil {
+		return err
+	}
+	in := bufio.NewReaderSize(r, int(h.Chunk)+1)
+	buf := make([]byte, h.Chunk)
+	for n := uint32(0); ; n++ {
+		size, err := io.ReadFull(in, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// only the end of the input makes this the last chunk; a failed
+		// read must not pass for it
+		_, peekErr := in.Peek(1)
+		if peekErr != nil && peekErr != io.EOF {
+			return peekErr
+		}
+		last := peekErr == io.EOF
+		if _, err := w.Write(gcm.Seal(nil, h.nonce(n, last), buf[:size], h.Raw)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decrypt r into w, failing if any chunk was changed, reordered or cut off
+func decryptStream(w io.Writer, r io.Reader, passphrase []byte) error {
+	h, err := readCryptHeader(r)
+	if err != nil {
+		return err
+	}
+	gcm, err := h.aead(passphrase)
+	if err != nil {
+		return err
+	}
+	sealed := int(h.Chunk) + gcm.Overhead()
+	in := bufio.NewReaderSize(r, sealed+1)
+	buf := make([]byte, sealed)
+	for n := uint32(0); ; n++ {
+		size, err := io.ReadFull(in, buf)
+		if err == io.EOF {
+			return errors.New("encrypted file is truncated")
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		_, peekErr := in.Peek(1)
+		if peekErr != nil && peekErr != io.EOF {
+			return peekErr
+		}
+		last := peekErr == io.EOF
+		plain, err := gcm.Open(nil, h.nonce(n, last), buf[:size], h.Raw)
+		if err != nil {
+			if n == 0 {
+				return errors.New("wrong passphrase or corrupted file")
+			}
+			return fmt.Errorf("chunk %d is corrupted or the file was truncated", n)
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// get the passphrase from a file, the environment or the terminal;
+// confirm asks for it twice when prompting
+func readPassphrase(file string, confirm bool) ([]byte, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if data = bytes.TrimRight(data, "\r\n"); len(data) == 0 {
+			return nil, fmt.Errorf("%s is empty", file)
+		}
+		return data, nil
+	}
+	if env := os.Getenv(passphraseEnv); env != "" {
+		return []byte(env), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase: use -passphrase-file or set %s", passphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	if len(pass) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	return pass, nil
+}
+
+// encrypt a file with a passphrase
+func runEncrypt(args []string) error {
+	flags := newFlagSet("encrypt")
+	kdf := flags.String("kdf", "scrypt", "Key derivation function: scrypt or argon2")
+	output := flags.String("o", "", "File to write (default: FILE.enc)")
+	passFile := flags.String("passphrase-file", "", "Read the passphrase from this file instead of "+passphraseEnv+" or the terminal")
+	remove := flags.Bool("remove", false, "Shred the original file after encrypting it; the journal keeps no copy, so this cannot be undone")
+	force := flags.Bool("force", false, "Overwrite the output file if it exists")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	h, err := newCryptHeader(*kdf)
+	if err != nil {
+		return usageError("encrypting file", err)
+	}
+
+	src := flags.Arg(0)
+	dest := *output
+	if dest == "" {
+		dest = src + ".enc"
+	}
+	if err := confine(src, dest); err != nil {
+		return fail("encrypting file", err)
+	}
+	var passphrase []byte
+	if !opts.DryRun {
+		if passphrase, err = readPassphrase(*passFile, true); err != nil {
+			return fail("reading passphrase", err)
+		}
+	}
+	result, err := convertFile("encrypt", src, dest, compressOptions{Keep: !*remove, Shred: *remove, Force: *force},
+		func(w io.Writer, r io.Reader, _ fs.FileInfo) error {
+			return encryptStream(w, r, h, passphrase)
+		})
+	if err != nil {
+		return fail("encrypting file", err)
+	}
+	if result.DryRun {
+		printPlan(result)
+		return nil
+	}
+	printDone(result, tr("Encrypted %s to %s", src, dest))
+	return nil
+}
+
+// decrypt a file written by encrypt
+func runDecrypt(args []string) error {
+	flags := newFlagSet("decrypt")
+	output := flags.String("o", "", "File to write (default: FILE without .enc)")
+	passFile := flags.String("passphrase-file", "", "Read the passphrase from this file instead of "+passphraseEnv+" or the terminal")
+	remove := flags.Bool("remove", false, "Remove the encrypted file after decrypting it")
+	force := flags.Bool("force", false, "Overwrite the output file if it exists")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	src := flags.Arg(0)
+	dest := *output
+	if dest == "" {
+		if dest = strings.TrimSuffix(src, ".enc"); dest == src {
+			return usageError("decrypting file", fmt.Errorf("%s does not end in .enc; give the output name with -o", src))
+		}
+	}
+	if err := confine(src, dest); err != nil {
+		return fail("decrypting file", err)
+	}
+	var passphrase []byte
+	var err error
+	if !opts.DryRun {
+		if passphrase, err = readPassphrase(*passFile, false); err != nil {
+			return fail("reading passphrase", err)
+		}
+	}
+	result, err := convertFile("decrypt", src, dest, compressOptions{Keep: !*remove, Force: *force},
+		func(w io.Writer, r io.Reader, _ fs.FileInfo) error {
+			return decryptStream(w, r, passphrase)
+		})
+	if err != nil {
+		return fail("decrypting file", err)
+	}
+	if result.DryRun {
+		printPlan(result)
+		return nil
+	}
+	printDone(result, tr("Decrypted %s to %s", src, dest))
+	return nil
+}
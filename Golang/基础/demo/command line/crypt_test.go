@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEncryptStream(t *testing.T) {
+	h, err := newCryptHeader("scrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("secret")
+	// whole chunks and a partial one, so the last chunk is found by peeking
+	plain := bytes.Repeat([]byte("x"), 2*int(h.Chunk)+10)
+
+	var sealed bytes.Buffer
+	if err := encryptStream(&sealed, bytes.NewReader(plain), h, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	var opened bytes.Buffer
+	if err := decryptStream(&opened, bytes.NewReader(sealed.Bytes()), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened.Bytes(), plain) {
+		t.Errorf("decrypted %d bytes, want the %d encrypted", opened.Len(), len(plain))
+	}
+
+	// a read that fails right after a full chunk must not end the stream as
+	// if the input were complete
+	errRead := errors.New("read failed")
+	failing := io.MultiReader(bytes.NewReader(plain[:h.Chunk]), iotest.ErrReader(errRead))
+	if err := encryptStream(io.Discard, failing, h, passphrase); !errors.Is(err, errRead) {
+		t.Errorf("encrypting a failing reader: %v, want %v", err, errRead)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// bytes read from the start of each file before hashing it in full
+const partialHashSize = 64 * 1024
+
+// files with identical contents; the first one is kept
+type duplicateSet struct {
+	Size   int64    `json:"size"`
+	Digest string   `json:"digest"`
+	Files  []string `json:"files"`
+}
+
+// collect the regular files under the given roots, grouped by size
+func filesBySize(roots []string, minSize int64) (map[int64][]string, error) {
+	bySize := map[int64][]string{}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() >= minSize {
+				bySize[info.Size()] = append(bySize[info.Size()], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bySize, nil
+}
+
+// hash the first partialHashSize bytes of a file
+func hashPrefix(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher, _ := newHasher(defaultHashAlgo)
+	if _, err := io.CopyN(hasher, file, partialHashSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// split paths into groups that share the same key, dropping groups of one
+func groupBy(paths []string, key func(string) (string, error)) (map[string][]string, error) {
+	groups := map[string][]string{}
+	for _, path := range paths {
+		k, err := key(path)
+		if err != nil {
+			return nil, err
+		}
+		groups[k] = append(groups[k], path)
+	}
+	for k, group := range groups {
+		if len(group) < 2 {
+			delete(groups, k)
+		}
+	}
+	return groups, nil
+}
+
+// find sets of identical files by size, then the hash of their first bytes,
+// then the hash of their full contents
+func findDuplicates(roots []string, minSize int64) ([]duplicateSet, error) {
+	bySize, err := filesBySize(roots, minSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var sets []duplicateSet
+	for size, paths := range bySize {
+		if paths = distinctFiles(paths); len(paths) < 2 {
+			continue
+		}
+		candidates := map[string][]string{"": paths}
+		if size > partialHashSize {
+			if candidates, err = groupBy(paths, hashPrefix); err != nil {
+				return nil, err
+			}
+		}
+		for _, group := range candidates {
+			full, err := groupBy(group, func(path string) (string, error) { return hashFile(path, defaultHashAlgo) })
+			if err != nil {
+				return nil, err
+			}
+			for digest, files := range full {
+				sort.Strings(files)
+				sets = append(sets, duplicateSet{Size: size, Digest: digest, Files: files})
+			}
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Size != sets[j].Size {
+			return sets[i].Size > sets[j].Size
+		}
+		return sets[i].Files[0] < sets[j].Files[0]
+	})
+	return sets, nil
+}
+
+// drop paths that are hard links to a file already in the list
+func distinctFiles(paths []string) []string {
+	var kept []string
+	var infos []fs.FileInfo
+next:
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		for _, seen := range infos {
+			if os.SameFile(info, seen) {
+				continue next
+			}
+		}
+		kept = append(kept, path)
+		infos = append(infos, info)
+	}
+	return kept
+}
+
+// replace a duplicate with a hard link to the kept file, journaled so it can be undone;
+// the rename replaces the name itself, so a symlink there is saved, not its target
+func replaceWithLink(keep string, dup string) error {
+	entry, err := journalPrepare("hardlink", dup, "")
+	if err != nil {
+		return err
+	}
+	tmp := dup + ".fileutil-link"
+	if err := fsys.Link(keep, tmp); err != nil {
+		return journalFinish(entry, err)
+	}
+	if err := fsys.Rename(tmp, dup); err != nil {
+		fsys.Remove(tmp)
+		return journalFinish(entry, err)
+	}
+	return journalFinish(entry, nil)
+}
+
+// move a duplicate under the quarantine directory, keeping its absolute path as the layout
+func quarantineFile(path string, dir string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel := strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	dest := filepath.Join(dir, rel)
+	if exists(dest) {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+	if err := fsys.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	entry, err := journalPrepare("rename", path, dest)
+	if err != nil {
+		return "", err
+	}
+	return dest, journalFinish(entry, moveFile(path, dest))
+}
+
+// apply an action to one duplicate
+func dedupeFile(action string, keep string, dup string, size int64, quarantine string) (opResult, error) {
+	switch action {
+	case "delete":
+		if opts.DryRun {
+			return opResult{Op: "delete", Path: dup, Bytes: size, DryRun: true}, nil
+		}
+		return opResult{Op: "delete", Path: dup}, deleteJournaled(dup, false)
+	case "hardlink":
+		if opts.DryRun {
+			return opResult{Op: "hardlink", Path: dup, Dest: keep, Bytes: size, DryRun: true}, nil
+		}
+		return opResult{Op: "hardlink", Path: dup, Dest: keep}, replaceWithLink(keep, dup)
+	default:
+		if opts.DryRun {
+			return opResult{Op: "quarantine", Path: dup, Dest: quarantine, Bytes: size, DryRun: true}, nil
+		}
+		dest, err := quarantineFile(dup, quarantine)
+		return opResult{Op: "quarantine", Path: dup, Dest: dest}, err
+	}
+}
+
+// report duplicate files and optionally get rid of them
+func runDedupe(args []string) error {
+	flags := newFlagSet("dedupe")
+	action := flags.String("action", "report", "What to do with duplicates: report, delete, hardlink or quarantine")
+	quarantine := flags.String("quarantine", "", "Directory to move duplicates into with -action quarantine")
+	minSizeText := flags.String("min-size", "1", "Ignore files smaller than this size")
+	force := flags.Bool("force", false, "Do not ask for confirmation before deleting")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	switch *action {
+	case "report", "delete", "hardlink":
+		if *quarantine != "" {
+			return usageError("finding duplicates", fmt.Errorf("-quarantine only applies with -action quarantine"))
+		}
+	case "quarantine":
+		if *quarantine == "" {
+			return usageError("finding duplicates", fmt.Errorf("-action quarantine needs -quarantine DIR"))
+		}
+	default:
+		return usageError("finding duplicates", fmt.Errorf("unknown -action %q (use report, delete, hardlink or quarantine)", *action))
+	}
+	minSize, err := parseSize(*minSizeText)
+	if err != nil {
+		return usageError("finding duplicates", err)
+	}
+
+	if err := confine(append(flags.Args(), *quarantine)...); err != nil {
+		return fail("finding duplicates", err)
+	}
+	sets, err := findDuplicates(flags.Args(), minSize)
+	if err != nil {
+		return fail("finding duplicates", err)
+	}
+	var wasted int64
+	for _, set := range sets {
+		wasted += set.Size * int64(len(set.Files)-1)
+	}
+
+	if *action == "report" {
+		if opts.JSON {
+			printJSON(struct {
+				Sets   []duplicateSet `json:"sets"`
+				Wasted int64          `json:"wasted"`
+			}{append([]duplicateSet{}, sets...), wasted})
+			return nil
+		}
+		for _, set := range sets {
+			fmt.Print(tr("%s each, %d copies:\n", humanSize(set.Size), len(set.Files)))
+			for _, file := range set.Files {
+				fmt.Printf("\t%s\n", file)
+			}
+		}
+		fmt.Print(tr("%d duplicate sets, %s reclaimable\n", len(sets), humanSize(wasted)))
+		return nil
+	}
+
+	if *action == "delete" && !opts.DryRun && !*force && len(sets) > 0 &&
+		!confirm(tr("Delete duplicates in %d sets, keeping the first file of each?", len(sets))) {
+		printDone(opResult{Op: "delete", Skipped: true}, tr("Dedupe cancelled."))
+		return nil
+	}
+	if len(sets) == 0 && !opts.JSON {
+		printInfo("No duplicate files found\n")
+	}
+	for _, set := range sets {
+		keep := set.Files[0]
+		for _, dup := range set.Files[1:] {
+			result, err := dedupeFile(*action, keep, dup, set.Size, *quarantine)
+			if err != nil {
+				return fail("removing duplicate", err)
+			}
+			if opts.DryRun {
+				printPlan(result)
+				continue
+			}
+			message := fmt.Sprintf("%s: %s", tr(result.Op), dup)
+			if result.Dest != "" {
+				message += " -> " + result.Dest
+			}
+			printDone(result, message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// one line of an edit script: ' ' kept, '-' removed from a, '+' added from b
+type diffOp struct {
+	Kind byte
+	Line string
+	A    int // index in a where the op applies
+	B    int // index in b where the op applies
+}
+
+// a group of nearby changes with their context, as shown in a unified diff
+type diffHunk struct {
+	AStart int      `json:"a_start"`
+	ALines int      `json:"a_lines"`
+	BStart int      `json:"b_start"`
+	BLines int      `json:"b_lines"`
+	Lines  []string `json:"lines"`
+}
+
+// lines of a file, and whether its last line ends without a newline
+type diffFile struct {
+	Lines     []string
+	NoEOL     bool
+	Timestamp time.Time
+}
+
+// read a file and split it into lines
+func readDiffFile(path string) (diffFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return diffFile{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return diffFile{}, err
+	}
+	f := diffFile{Timestamp: info.ModTime()}
+	text := string(data)
+	if text == "" {
+		return f, nil
+	}
+	f.NoEOL = !strings.HasSuffix(text, "\n")
+	f.Lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	return f, nil
+}
+
+// compute the shortest edit script turning a into b (Myers' algorithm);
+// key maps a line to what is compared, so whitespace can be ignored
+func diffLines(a []string, b []string, key func(string) string) []diffOp {
+	ka := make([]string, len(a))
+	for i, line := range a {
+		ka[i] = key(line)
+	}
+	kb := make([]string, len(b))
+	for i, line := range b {
+		kb[i] = key(line)
+	}
+
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && ka[x] == kb[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk the trace backwards to recover the edits
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x], x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y], x, y})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x], x, y})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// group an edit script into hunks with up to context unchanged lines around each change
+func buildHunks(ops []diffOp, context int, a diffFile, b diffFile) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(ops); i++ {
+		if ops[i].Kind == ' ' {
+			continue
+		}
+		// extend the hunk while the next change is close enough to share context
+		last := i
+		for j := i + 1; j < len(ops) && j <= last+2*context+1; j++ {
+			if ops[j].Kind != ' ' {
+				last = j
+			}
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := last + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		h := diffHunk{AStart: ops[start].A + 1, BStart: ops[start].B + 1}
+		for _, op := range ops[start:end] {
+			h.Lines = append(h.Lines, string(op.Kind)+op.Line)
+			if op.Kind != '+' {
+				h.ALines++
+			}
+			if op.Kind != '-' {
+				h.BLines++
+			}
+			lastA := op.Kind != '+' && op.A == len(a.Lines)-1 && a.NoEOL
+			lastB := op.Kind == '+' && op.B == len(b.Lines)-1 && b.NoEOL
+			if lastA || lastB {
+				h.Lines = append(h.Lines, `\ No newline at end of file`)
+			}
+		}
+		// an empty side is numbered by the line before it, as diff does
+		if h.ALines == 0 {
+			h.AStart--
+		}
+		if h.BLines == 0 {
+			h.BStart--
+		}
+		hunks = append(hunks, h)
+		i = end - 1
+	}
+	return hunks
+}
+
+// write hunks in unified diff format, colored when w is a terminal
+func printUnified(w *os.File, pathA string, a diffFile, pathB string, b diffFile, hunks []diffHunk) {
+	const stamp = "2006-01-02 15:04:05.000000000 -0700"
+	fmt.Fprintln(w, paint(w, colorHeader, fmt.Sprintf("--- %s\t%s", pathA, a.Timestamp.Format(stamp))))
+	fmt.Fprintln(w, paint(w, colorHeader, fmt.Sprintf("+++ %s\t%s", pathB, b.Timestamp.Format(stamp))))
+	for _, h := range hunks {
+		fmt.Fprintln(w, paint(w, colorHunk, fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.AStart, h.ALines), hunkRange(h.BStart, h.BLines))))
+		for _, line := range h.Lines {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				line = paint(w, colorAdded, line)
+			case strings.HasPrefix(line, "-"):
+				line = paint(w, colorRemoved, line)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// format a hunk range, leaving out a count of one as diff does
+func hunkRange(start int, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// compare two files line by line
+func runDiff(args []string) error {
+	flags := newFlagSet("diff")
+	context := flags.Int("context", 3, "Show N lines of context around each change")
+	ignoreSpace := flags.Bool("ignore-space", false, "Ignore all whitespace when comparing lines")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	if *context < 0 {
+		return usageError("comparing files", fmt.Errorf("-context must not be negative"))
+	}
+
+	pathA, pathB := flags.Arg(0), flags.Arg(1)
+	if err := confine(pathA, pathB); err != nil {
+		return fail("comparing files", err)
+	}
+	a, err := readDiffFile(pathA)
+	if err != nil {
+		return fail("comparing files", err)
+	}
+	b, err := readDiffFile(pathB)
+	if err != nil {
+		return fail("comparing files", err)
+	}
+
+	key := func(line string) string { return line }
+	if *ignoreSpace {
+		key = func(line string) string { return strings.Join(strings.Fields(line), "") }
+	}
+	ops := diffLines(a.Lines, b.Lines, key)
+	if !*ignoreSpace && a.NoEOL != b.NoEOL && len(a.Lines) > 0 && len(b.Lines) > 0 {
+		// the last lines match but only one of them ends with a newline
+		if last := len(ops) - 1; ops[last].Kind == ' ' {
+			op := ops[last]
+			ops = append(ops[:last], diffOp{'-', op.Line, op.A, op.B}, diffOp{'+', op.Line, op.A + 1, op.B})
+		}
+	}
+	hunks := buildHunks(ops, *context, a, b)
+
+	if opts.JSON {
+		printJSON(struct {
+			A     string     `json:"a"`
+			B     string     `json:"b"`
+			Hunks []diffHunk `json:"hunks"`
+		}{pathA, pathB, append([]diffHunk{}, hunks...)})
+		return nil
+	}
+	if len(hunks) == 0 {
+		printInfo("Files %s and %s are identical\n", pathA, pathB)
+		return nil
+	}
+	printUnified(os.Stdout, pathA, a, pathB, b, hunks)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// a file present in both directories whose contents differ
+type dirDifference struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// Reason in the active language, for the text output
+	message string
+}
+
+// result of comparing two directory trees
+type dirComparison struct {
+	A         string          `json:"a"`
+	B         string          `json:"b"`
+	OnlyInA   []string        `json:"only_in_a"`
+	OnlyInB   []string        `json:"only_in_b"`
+	Differ    []dirDifference `json:"differ"`
+	Identical bool            `json:"identical"`
+}
+
+// compare the regular files under two directories by size and, unless sizeOnly, by hash
+func compareDirs(a string, b string, sizeOnly bool) (dirComparison, error) {
+	result := dirComparison{A: a, B: b, OnlyInA: []string{}, OnlyInB: []string{}, Differ: []dirDifference{}}
+	filesA, err := regularFiles(a)
+	if err != nil {
+		return result, err
+	}
+	filesB, err := regularFiles(b)
+	if err != nil {
+		return result, err
+	}
+
+	for name, infoA := range filesA {
+		infoB, ok := filesB[name]
+		if !ok {
+			result.OnlyInA = append(result.OnlyInA, name)
+			continue
+		}
+		if infoA.Size() != infoB.Size() {
+			result.Differ = append(result.Differ, dirDifference{name, fmt.Sprintf("size %d != %d", infoA.Size(), infoB.Size()), tr("size %d != %d", infoA.Size(), infoB.Size())})
+			continue
+		}
+		if sizeOnly {
+			continue
+		}
+		sumA, err := hashFile(filepath.Join(a, name), defaultHashAlgo)
+		if err != nil {
+			return result, err
+		}
+		sumB, err := hashFile(filepath.Join(b, name), defaultHashAlgo)
+		if err != nil {
+			return result, err
+		}
+		if sumA != sumB {
+			result.Differ = append(result.Differ, dirDifference{name, "content differs", tr("content differs")})
+		}
+	}
+	for name := range filesB {
+		if _, ok := filesA[name]; !ok {
+			result.OnlyInB = append(result.OnlyInB, name)
+		}
+	}
+
+	sort.Strings(result.OnlyInA)
+	sort.Strings(result.OnlyInB)
+	sort.Slice(result.Differ, func(i, j int) bool { return result.Differ[i].Path < result.Differ[j].Path })
+	result.Identical = len(result.OnlyInA) == 0 && len(result.OnlyInB) == 0 && len(result.Differ) == 0
+	return result, nil
+}
+
+// compare two directory trees
+func runDiffDir(args []string) error {
+	flags := newFlagSet("diff-dir")
+	sizeOnly := flags.Bool("size-only", false, "Compare sizes only and skip hashing contents")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	if err := confine(flags.Arg(0), flags.Arg(1)); err != nil {
+		return fail("comparing directories", err)
+	}
+	result, err := compareDirs(flags.Arg(0), flags.Arg(1), *sizeOnly)
+	if err != nil {
+		return fail("comparing directories", err)
+	}
+	if opts.JSON {
+		printJSON(result)
+		return nil
+	}
+	for _, name := range result.OnlyInA {
+		fmt.Print(tr("only in %s: %s\n", result.A, name))
+	}
+	for _, name := range result.OnlyInB {
+		fmt.Print(tr("only in %s: %s\n", result.B, name))
+	}
+	for _, d := range result.Differ {
+		fmt.Print(tr("differ: %s (%s)\n", d.Path, d.message))
+	}
+	if result.Identical {
+		printInfo("Directories %s and %s are identical\n", result.A, result.B)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// describe a copy without performing it
+func planCopy(src string, dest string, recursive bool, follow bool) (opResult, error) {
+	result := opResult{Op: "copy", Path: src, Dest: dest, DryRun: true}
+
+	stat := os.Stat
+	if !follow {
+		stat = os.Lstat
+	}
+	info, err := stat(src)
+	if err != nil {
+		return result, err
+	}
+	if info.IsDir() && !recursive {
+		return result, fmt.Errorf("%s is a directory (use -recursive)", src)
+	}
+	if result.Bytes, err = treeSize(src); err != nil {
+		return result, err
+	}
+	result.Overwrite = exists(dest)
+	return result, nil
+}
+
+// describe a delete without performing it
+func planDelete(path string, recursive bool) (opResult, error) {
+	result := opResult{Op: "delete", Path: path, DryRun: true}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return result, err
+	}
+	if info.IsDir() && !recursive {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return result, err
+		}
+		if len(entries) > 0 {
+			return result, fmt.Errorf("%s is a non-empty directory (use -recursive)", path)
+		}
+	}
+	result.Bytes, err = treeSize(path)
+	return result, err
+}
+
+// describe a rename without performing it
+func planRename(src string, dest string) (opResult, error) {
+	result := opResult{Op: "rename", Path: src, Dest: dest, DryRun: true}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return result, err
+	}
+	result.Bytes = info.Size()
+	result.Overwrite = exists(dest)
+	return result, nil
+}
+
+// describe a write or append without performing it
+func planWrite(op string, path string, size int64) (opResult, error) {
+	result := opResult{Op: op, Path: path, Bytes: size, DryRun: true}
+
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		result.Overwrite = op == "write"
+	case op == "append":
+		// append does not create missing files
+		return result, err
+	}
+	return result, nil
+}
+
+// total size of the regular files at or under path
+func treeSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+// report whether anything exists at path
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// human readable description of a planned operation
+func describePlan(result opResult) string {
+	var message string
+	switch result.Op {
+	case "copy", "rename", "move", "hardlink", "quarantine", "compress", "decompress", "archive", "extract", "encrypt", "decrypt", "encode", "decode":
+		message = tr("Would %s %s to %s (%d bytes)", tr(result.Op), result.Path, result.Dest, result.Bytes)
+	case "mktemp":
+		message = tr("Would create a temporary file like %s", result.Path)
+	case "mktempdir":
+		message = tr("Would create a temporary directory like %s", result.Path)
+	case "symlink":
+		message = tr("Would create symlink %s -> %s", result.Path, result.Dest)
+	case "write", "append":
+		message = tr("Would %s %d bytes to %s", tr(result.Op), result.Bytes, result.Path)
+	default:
+		message = tr("Would %s %s (%d bytes)", tr(result.Op), result.Path, result.Bytes)
+	}
+	if result.Overwrite {
+		message += tr(", overwriting the existing file")
+	}
+	return message
+}
+
+// report a planned operation as text or JSON
+func printPlan(result opResult) {
+	printDone(result, describePlan(result))
+}
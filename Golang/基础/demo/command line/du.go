@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// total size of one directory and everything under it
+type dirUsage struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+	Depth int    `json:"-"`
+}
+
+// size of a single file, for the largest files report
+type fileUsage struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// walk root and add each file's size to every directory above it
+func diskUsage(root string, filter *treeFilter) ([]dirUsage, []fileUsage, error) {
+	dirs := map[string]*dirUsage{}
+	var files []fileUsage
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filter.excluded(root, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			depth := 0
+			if rel != "." {
+				depth = strings.Count(filepath.ToSlash(rel), "/") + 1
+			}
+			dirs[path] = &dirUsage{Path: path, Depth: depth}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, fileUsage{path, info.Size()})
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			usage, ok := dirs[dir]
+			if !ok {
+				break
+			}
+			usage.Size += info.Size()
+			usage.Files++
+			if usage.Depth == 0 {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usages := make([]dirUsage, 0, len(dirs))
+	for _, usage := range dirs {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Size != usages[j].Size {
+			return usages[i].Size > usages[j].Size
+		}
+		return usages[i].Path < usages[j].Path
+	})
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	return usages, files, nil
+}
+
+// show how much space directories use
+func runDu(args []string) error {
+	flags := newFlagSet("du")
+	human := flags.Bool("human", false, "Show sizes like 1.5K, 2.0M")
+	maxDepth := flags.Int("max-depth", -1, "Only show directories up to this depth below each root (-1 for no limit)")
+	top := flags.Int("top", 0, "Also report the N largest files")
+	filter := addTreeFilterFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	size := func(n int64) string {
+		if *human {
+			return humanSize(n)
+		}
+		return fmt.Sprint(n)
+	}
+	type report struct {
+		Path    string      `json:"path"`
+		Dirs    []dirUsage  `json:"dirs"`
+		Largest []fileUsage `json:"largest,omitempty"`
+	}
+	if err := confine(flags.Args()...); err != nil {
+		return fail("measuring disk usage", err)
+	}
+	var reports []report
+	for _, root := range flags.Args() {
+		usages, files, err := diskUsage(root, filter)
+		if err != nil {
+			return fail("measuring disk usage", err)
+		}
+		shown := []dirUsage{}
+		for _, usage := range usages {
+			if *maxDepth < 0 || usage.Depth <= *maxDepth {
+				shown = append(shown, usage)
+			}
+		}
+		if *top < len(files) {
+			files = files[:*top]
+		}
+		if opts.JSON {
+			reports = append(reports, report{root, shown, files})
+			continue
+		}
+
+		for _, usage := range shown {
+			fmt.Printf("%10s  %s\n", size(usage.Size), usage.Path)
+		}
+		if len(files) > 0 {
+			fmt.Printf("\nLargest files in %s:\n", root)
+			for _, file := range files {
+				fmt.Printf("%10s  %s\n", size(file.Size), file.Path)
+			}
+		}
+	}
+	if opts.JSON {
+		printJSON(reports)
+	}
+	return nil
+}
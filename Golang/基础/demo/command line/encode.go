@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// a binary-to-text encoding that encode and decode can use
+type textCodec struct {
+	Name    string
+	Encoder func(w io.Writer) io.WriteCloser
+	Decoder func(r io.Reader) io.Reader
+}
+
+// supported encodings, in the order they are listed in messages
+var textCodecs = []textCodec{
+	{"base64",
+		func(w io.Writer) io.WriteCloser { return base64.NewEncoder(base64.StdEncoding, w) },
+		func(r io.Reader) io.Reader { return base64.NewDecoder(base64.StdEncoding, r) }},
+	{"base64url",
+		func(w io.Writer) io.WriteCloser { return base64.NewEncoder(base64.URLEncoding, w) },
+		func(r io.Reader) io.Reader { return base64.NewDecoder(base64.URLEncoding, r) }},
+	{"hex",
+		func(w io.Writer) io.WriteCloser { return nopWriteCloser{hex.NewEncoder(w)} },
+		hex.NewDecoder},
+}
+
+// a writer with nothing to flush on Close
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// look up an encoding by its -algo name
+func findTextCodec(name string) (textCodec, error) {
+	var names []string
+	for _, c := range textCodecs {
+		if c.Name == strings.ToLower(name) {
+			return c, nil
+		}
+		names = append(names, c.Name)
+	}
+	return textCodec{}, fmt.Errorf("unknown encoding %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// a writer that breaks what it is given into lines of width characters,
+// as base64 does, and ends the last one on Close
+type lineWrapper struct {
+	w      io.Writer
+	width  int
+	column int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if l.width > 0 {
+			n = min(n, l.width-l.column)
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		l.column += n
+		p = p[n:]
+		if l.width > 0 && l.column == l.width {
+			if _, err := l.w.Write([]byte{'\n'}); err != nil {
+				return written, err
+			}
+			l.column = 0
+		}
+	}
+	return written, nil
+}
+
+func (l *lineWrapper) Close() error {
+	if l.column == 0 {
+		return nil
+	}
+	l.column = 0
+	_, err := l.w.Write([]byte{'\n'})
+	return err
+}
+
+// a reader that drops whitespace, so wrapped or indented text decodes
+type spaceSkipper struct{ r io.Reader }
+
+func (s spaceSkipper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b < unicode.MaxASCII && unicode.IsSpace(rune(b)) {
+				continue
+			}
+			p[kept] = b
+			kept++
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// encode r into w as c, in lines of width characters, or one line when
+// width is 0
+func encodeStream(c textCodec, w io.Writer, r io.Reader, width int) error {
+	wrapped := &lineWrapper{w: w, width: width}
+	enc := c.Encoder(wrapped)
+	if _, err := io.Copy(enc, r); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return wrapped.Close()
+}
+
+// decode text in c from r into w, ignoring whitespace
+func decodeStream(c textCodec, w io.Writer, r io.Reader) error {
+	_, err := io.Copy(w, c.Decoder(spaceSkipper{r}))
+	return err
+}
+
+// run convert from src to dest, where an empty src is stdin and an empty
+// dest is stdout; a file written is journaled like write
+func transcodeFile(op string, src string, dest string, force bool, convert func(io.Writer, io.Reader) error) (opResult, error) {
+	result := opResult{Op: op, Path: src, Dest: dest}
+	var in io.Reader = os.Stdin
+	if src != "" {
+		file, err := fsys.Open(src)
+		if err != nil {
+			return result, err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return result, err
+		}
+		result.Bytes = info.Size()
+		in = file
+	}
+	in = interruptible(cmdCtx, in)
+	err := writeOutput(&result, dest, force, func(w io.Writer) error {
+		return convert(w, in)
+	})
+	return result, err
+}
+
+// write what produce gives to stdout when dest is empty, or else
+// atomically to dest, journaled like write; result is marked as a dry run
+// or overwrite as fits
+func writeOutput(result *opResult, dest string, force bool, produce func(io.Writer) error) error {
+	if dest == "" {
+		out := bufio.NewWriterSize(os.Stdout, streamBufferSize)
+		if err := produce(out); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+	result.Overwrite = exists(dest)
+	if result.Overwrite && !force {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", dest)
+	}
+	if opts.DryRun {
+		result.DryRun = true
+		return nil
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(produce(pw))
+	}()
+	entry, err := journalPrepare("write", dest, "")
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	err = writeFileAtomic(dest, pr)
+	pr.CloseWithError(err)
+	return journalFinish(entry, err)
+}
+
+// add the flags encode and decode share, returning -algo, -o and -force
+func addTranscodeFlags(flags *flag.FlagSet) (*string, *string, *bool) {
+	algo := flags.String("algo", "base64", "Encoding: base64, base64url or hex")
+	output := flags.String("o", "", "File to write (default: stdout)")
+	force := flags.Bool("force", false, "Overwrite the output file if it exists")
+	return algo, output, force
+}
+
+// encode a file or stdin as base64 or hex text
+func runEncode(args []string) error {
+	flags := newFlagSet("encode")
+	algo, output, force := addTranscodeFlags(flags)
+	wrap := flags.Int("wrap", 76, "Break the output into lines of N characters, or 0 for a single line")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if *wrap < 0 {
+		return usageError("encoding data", fmt.Errorf("-wrap must not be negative"))
+	}
+	c, err := findTextCodec(*algo)
+	if err != nil {
+		return usageError("encoding data", err)
+	}
+	src := flags.Arg(0)
+	if src == "-" {
+		src = ""
+	}
+	if err := confine(src, *output); err != nil {
+		return fail("encoding data", err)
+	}
+	result, err := transcodeFile("encode", src, *output, *force, func(w io.Writer, r io.Reader) error {
+		return encodeStream(c, w, r, *wrap)
+	})
+	if err != nil {
+		return fail("encoding data", err)
+	}
+	printTranscoded(result)
+	return nil
+}
+
+// decode base64 or hex text from a file or stdin
+func runDecode(args []string) error {
+	flags := newFlagSet("decode")
+	algo, output, force := addTranscodeFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	c, err := findTextCodec(*algo)
+	if err != nil {
+		return usageError("decoding data", err)
+	}
+	src := flags.Arg(0)
+	if src == "-" {
+		src = ""
+	}
+	if err := confine(src, *output); err != nil {
+		return fail("decoding data", err)
+	}
+	result, err := transcodeFile("decode", src, *output, *force, func(w io.Writer, r io.Reader) error {
+		return decodeStream(c, w, r)
+	})
+	if err != nil {
+		return fail("decoding data", err)
+	}
+	printTranscoded(result)
+	return nil
+}
+
+// report encoding or decoding into a file; output to stdout is the result
+// itself
+func printTranscoded(result opResult) {
+	switch {
+	case result.Dest == "":
+	case result.DryRun:
+		printPlan(result)
+	case result.Op == "encode":
+		printDone(result, tr("Encoded %s to %s", sourceName(result.Path), result.Dest))
+	default:
+		printDone(result, tr("Decoded %s to %s", sourceName(result.Path), result.Dest))
+	}
+}
+
+// name of an input in messages, where stdin has none
+func sourceName(path string) string {
+	if path == "" {
+		return tr("stdin")
+	}
+	return path
+}
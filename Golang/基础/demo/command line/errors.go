@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// process exit codes, so scripts can branch on the kind of failure
+const (
+	exitOK         = 0
+	exitFailure    = 1
+	exitUsage      = 2
+	exitNotFound   = 3
+	exitPermission = 4
+	// the codes timeout(1) and a shell use for a command that ran out of
+	// time or was killed by SIGINT
+	exitTimeout     = 124
+	exitInterrupted = 130
+)
+
+// errUsage reports that a command was invoked with bad arguments
+var errUsage = errors.New("invalid usage")
+
+// an error annotated with the action that was being attempted
+type actionError struct {
+	action string
+	err    error
+}
+
+func (e *actionError) Error() string {
+	return e.action + ": " + e.err.Error()
+}
+
+func (e *actionError) Unwrap() error {
+	return e.err
+}
+
+// wrap an error with the action that failed, e.g. "copying file"
+func fail(action string, err error) error {
+	return &actionError{action: action, err: err}
+}
+
+// a problem with the command line, such as an unknown algorithm name
+type invalidUsage struct {
+	err error
+}
+
+func (e *invalidUsage) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidUsage) Is(target error) bool {
+	return target == errUsage
+}
+
+// wrap a problem with the command line so it exits with the usage code
+func usageError(action string, err error) error {
+	return fail(action, &invalidUsage{err: err})
+}
+
+// map an error to the exit code that describes it
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errTimeout):
+		return exitTimeout
+	case errors.Is(err, errInterrupted):
+		return exitInterrupted
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, fs.ErrNotExist):
+		return exitNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return exitPermission
+	default:
+		return exitFailure
+	}
+}
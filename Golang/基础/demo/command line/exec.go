@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// runs a user command for batches of watch events, at most once per interval;
+// batches that arrive while a run is in progress collapse into one more run
+type execRunner struct {
+	command  string
+	throttle time.Duration
+	queue    chan watchEvent
+}
+
+// start the background loop that runs the command
+func newExecRunner(command string, throttle time.Duration) *execRunner {
+	r := &execRunner{command: command, throttle: throttle, queue: make(chan watchEvent, 1)}
+	go r.loop()
+	return r
+}
+
+// schedule a run for the latest event of a batch, replacing any run still waiting
+func (r *execRunner) trigger(batch []watchEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	latest := batch[len(batch)-1]
+	select {
+	case <-r.queue:
+	default:
+	}
+	r.queue <- latest
+}
+
+func (r *execRunner) loop() {
+	var last time.Time
+	for event := range r.queue {
+		if wait := r.throttle - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+			// pick up anything newer that arrived while waiting
+			select {
+			case newer := <-r.queue:
+				event = newer
+			default:
+			}
+		}
+		last = time.Now()
+		if err := runShell(r.command, event); err != nil {
+			logger().Error("running command failed", "command", r.command, "path", event.Path, "error", err)
+		}
+	}
+}
+
+// run a command line through the shell with {} replaced by the changed path
+func runShell(command string, event watchEvent) error {
+	line := strings.ReplaceAll(command, "{}", shellQuote(event.Path))
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", line)
+	} else {
+		cmd = exec.Command("sh", "-c", line)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "FILEUTIL_EVENT="+event.Op, "FILEUTIL_PATH="+event.Path)
+	return cmd.Run()
+}
+
+// quote a path so the shell passes it through as a single argument
+func shellQuote(path string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + path + `"`
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
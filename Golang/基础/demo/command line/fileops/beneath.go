@@ -0,0 +1,308 @@
+package fileops
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrEscape is the error of a path that leads out of a root, directly or
+// through a symlink. errors.Is also matches it with fs.ErrPermission.
+var ErrEscape error = escapeError{}
+
+type escapeError struct{}
+
+func (escapeError) Error() string        { return "path escapes the root" }
+func (escapeError) Is(target error) bool { return target == fs.ErrPermission }
+
+// the most symlinks Resolve follows, as Linux does
+const maxSymlinks = 40
+
+// report whether the clean absolute path is root or below it
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// the clean absolute form of name, with relative names taken from root
+func underRoot(root string, name string) string {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(root, name)
+	}
+	return filepath.Clean(name)
+}
+
+// Resolve returns the path name leads to with every symlink in it followed,
+// failing with ErrEscape when it, or any symlink on the way, leaves root.
+// Relative names are taken from root, which must be a clean absolute path
+// without symlinks. Parts that do not exist yet are kept as they are.
+func Resolve(root string, name string) (string, error) {
+	escape := &fs.PathError{Op: "resolve", Path: name, Err: ErrEscape}
+	path := underRoot(root, name)
+	if !within(root, path) {
+		return "", escape
+	}
+	rel, _ := filepath.Rel(root, path)
+	rest := strings.Split(rel, string(filepath.Separator))
+	resolved, links := root, 0
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == root {
+				return "", escape
+			}
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &fs.PathError{Op: "resolve", Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			target = filepath.Clean(target)
+			if !within(root, target) {
+				return "", escape
+			}
+			target, _ = filepath.Rel(root, target)
+			resolved = root
+		}
+		rest = append(strings.Split(target, string(filepath.Separator)), rest...)
+	}
+	return resolved, nil
+}
+
+// Beneath returns the OS file system confined to the directory root: names
+// are taken from root when relative, and any that leads out of it, also
+// through a symlink, fails with ErrEscape. Names are resolved first; on
+// Linux 5.6 and later files are then opened with openat2 and
+// RESOLVE_BENEATH, so the kernel enforces this even when the tree changes
+// meanwhile.
+// Operations on a symlink itself, such as Lstat, Remove, Rename, Readlink
+// and Lchown, do not follow it. The target of a new symlink is not checked,
+// since following it later is what is confined.
+func Beneath(root string) (FS, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: root, Err: errors.New("not a directory")}
+	}
+	return beneathFS{root}, nil
+}
+
+// OS file system confined to a root
+type beneathFS struct {
+	root string
+}
+
+// resolve name, following every symlink
+func (b beneathFS) resolve(name string) (string, error) {
+	return Resolve(b.root, name)
+}
+
+// resolve the directory of name but not its last part, for calls that act
+// on a symlink itself
+func (b beneathFS) resolveParent(name string) (string, error) {
+	path := underRoot(b.root, name)
+	if path == b.root {
+		return path, nil
+	}
+	dir, err := Resolve(b.root, filepath.Dir(path))
+	if err != nil {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: ErrEscape}
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+func (b beneathFS) Open(name string) (File, error) {
+	return b.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// the path is resolved first, so absolute symlinks inside the root work;
+// openat2 then makes sure nothing swapped in meanwhile leads out
+func (b beneathFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	rel, _ := filepath.Rel(b.root, resolved)
+	if f, ok, err := openBeneath(b.root, rel, flag, perm, name); ok {
+		return osFile(f, err)
+	}
+	return osFile(os.OpenFile(resolved, flag, perm))
+}
+
+func (b beneathFS) CreateTemp(dir string, pattern string) (File, error) {
+	resolved, err := b.resolve(dir)
+	if err != nil {
+		return nil, err
+	}
+	return osFile(os.CreateTemp(resolved, pattern))
+}
+
+func (b beneathFS) Stat(name string) (fs.FileInfo, error) {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(resolved)
+}
+
+func (b beneathFS) Lstat(name string) (fs.FileInfo, error) {
+	resolved, err := b.resolveParent(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(resolved)
+}
+
+func (b beneathFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(resolved)
+}
+
+func (b beneathFS) Mkdir(name string, perm fs.FileMode) error {
+	resolved, err := b.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(resolved, perm)
+}
+
+func (b beneathFS) MkdirAll(name string, perm fs.FileMode) error {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(resolved, perm)
+}
+
+func (b beneathFS) Remove(name string) error {
+	resolved, err := b.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(resolved)
+}
+
+func (b beneathFS) RemoveAll(name string) error {
+	resolved, err := b.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(resolved)
+}
+
+func (b beneathFS) Rename(oldName string, newName string) error {
+	oldPath, err := b.resolveParent(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := b.resolveParent(newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+func (b beneathFS) Readlink(name string) (string, error) {
+	resolved, err := b.resolveParent(name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(resolved)
+}
+
+func (b beneathFS) Symlink(oldName string, newName string) error {
+	resolved, err := b.resolveParent(newName)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(oldName, resolved)
+}
+
+func (b beneathFS) Link(oldName string, newName string) error {
+	oldPath, err := b.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := b.resolveParent(newName)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldPath, newPath)
+}
+
+func (b beneathFS) Chmod(name string, mode fs.FileMode) error {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(resolved, mode)
+}
+
+func (b beneathFS) Chown(name string, uid int, gid int) error {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Chown(resolved, uid, gid)
+}
+
+func (b beneathFS) Lchown(name string, uid int, gid int) error {
+	resolved, err := b.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	return os.Lchown(resolved, uid, gid)
+}
+
+func (b beneathFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(resolved, atime, mtime)
+}
+
+func (b beneathFS) Truncate(name string, size int64) error {
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Truncate(resolved, size)
+}
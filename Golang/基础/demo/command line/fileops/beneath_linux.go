@@ -0,0 +1,35 @@
+package fileops
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// open rel below root with openat2 and RESOLVE_BENEATH, naming the file
+// name. ok is false when the kernel has no openat2, so the caller resolves
+// the path itself
+func openBeneath(root string, rel string, flag int, perm fs.FileMode, name string) (f *os.File, ok bool, err error) {
+	dir, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, true, &fs.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer unix.Close(dir)
+	how := &unix.OpenHow{Flags: uint64(flag | unix.O_CLOEXEC), Resolve: unix.RESOLVE_BENEATH}
+	// openat2 rejects a mode when it creates nothing
+	if flag&(unix.O_CREAT|unix.O_TMPFILE) != 0 {
+		how.Mode = uint64(perm.Perm())
+	}
+	fd, err := unix.Openat2(dir, rel, how)
+	switch {
+	case errors.Is(err, unix.ENOSYS):
+		return nil, false, nil
+	case errors.Is(err, unix.EXDEV):
+		return nil, true, &fs.PathError{Op: "open", Path: name, Err: ErrEscape}
+	case err != nil:
+		return nil, true, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), true, nil
+}
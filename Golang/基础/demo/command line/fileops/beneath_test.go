@@ -0,0 +1,45 @@
+package fileops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBeneathOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, "out")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	fsys, err := Beneath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		flag int
+		perm os.FileMode
+	}{
+		{"file", os.O_RDONLY, 0},
+		{"file", os.O_RDWR, 0644},
+		{"file", os.O_WRONLY | os.O_APPEND, 0644},
+		{"file", os.O_WRONLY | os.O_TRUNC, 0644},
+		{"new", os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0600},
+	}
+	for _, tt := range tests {
+		f, err := fsys.OpenFile(tt.name, tt.flag, tt.perm)
+		if err != nil {
+			t.Errorf("OpenFile(%q, %#o): %v", tt.name, tt.flag, err)
+			continue
+		}
+		f.Close()
+	}
+	if _, err := fsys.OpenFile("out/new", os.O_WRONLY|os.O_CREATE, 0644); !errors.Is(err, ErrEscape) {
+		t.Errorf("creating a file through a symlink out of the root: %v, want ErrEscape", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package fileops holds the file operations behind fileutil, so other
+// programs can call them directly instead of running the command. They work
+// on an FS: OS for the real disk, or a MemFS for tests.
+//
+// Every function takes a context. It is checked before anything is changed
+// and, for operations that stream data, between reads, so a canceled
+// operation stops early; Write and Copy then remove the file they were
+// writing rather than leave it half written.
+//
+// Errors are those of package os, usually *fs.PathError or *os.LinkError,
+// so errors.Is works with fs.ErrNotExist and the like. A canceled context
+// is reported as a *fs.PathError whose Err is the context's cause.
+package fileops
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// the permissions of files created when no Perm is given
+const defaultPerm fs.FileMode = 0644
+
+// stop before op on path when ctx is already canceled
+func checkContext(ctx context.Context, op string, path string) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: path, Err: context.Cause(ctx)}
+}
+
+// Create creates an empty file, truncating it if it exists.
+func Create(ctx context.Context, fsys FS, path string) error {
+	if err := checkContext(ctx, "create", path); err != nil {
+		return err
+	}
+	file, err := fsys.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, defaultPerm)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Read returns the contents of a file.
+func Read(ctx context.Context, fsys FS, path string) ([]byte, error) {
+	if err := checkContext(ctx, "read", path); err != nil {
+		return nil, err
+	}
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(Reader(ctx, file))
+}
+
+// WriteOptions controls how Write stores its content.
+type WriteOptions struct {
+	// Perm is the permissions of a file Write creates; 0 means 0644. An
+	// atomic write keeps the permissions of the file it replaces.
+	Perm fs.FileMode
+	// Append adds to the end of an existing file instead of replacing it.
+	Append bool
+	// Atomic writes to a temporary file in the same directory, syncs it and
+	// renames it over path, so readers never see a partial file. When path
+	// is a symlink, the file it points to is replaced and the link kept. It
+	// cannot be combined with Append.
+	Atomic bool
+}
+
+// Write stores everything read from r in the file at path.
+func Write(ctx context.Context, fsys FS, path string, r io.Reader, opts WriteOptions) error {
+	if err := checkContext(ctx, "write", path); err != nil {
+		return err
+	}
+	if opts.Perm == 0 {
+		opts.Perm = defaultPerm
+	}
+	r = Reader(ctx, r)
+	switch {
+	case opts.Append && opts.Atomic:
+		return &fs.PathError{Op: "write", Path: path, Err: fs.ErrInvalid}
+	case opts.Atomic:
+		return writeAtomic(fsys, path, r, opts.Perm)
+	case opts.Append:
+		return writeTo(fsys, path, os.O_APPEND|os.O_WRONLY, opts.Perm, r)
+	}
+	return writeTo(fsys, path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, opts.Perm, r)
+}
+
+// copy r into the file opened with flag
+func writeTo(fsys FS, path string, flag int, perm fs.FileMode, r io.Reader) error {
+	file, err := fsys.OpenFile(path, flag, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// FollowLinks returns the file path names, following the symlinks at its
+// end, so a rename over it replaces what a link points to rather than the
+// link. The target of a dangling link is returned, to be created.
+func FollowLinks(fsys FS, path string) (string, error) {
+	for range maxSymlinks {
+		info, err := fsys.Lstat(path)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			return path, nil
+		}
+		target, err := fsys.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return "", &fs.PathError{Op: "write", Path: path, Err: syscall.ELOOP}
+}
+
+// write through a synced temporary file renamed over path
+func writeAtomic(fsys FS, path string, r io.Reader, perm fs.FileMode) (err error) {
+	if path, err = FollowLinks(fsys, path); err != nil {
+		return err
+	}
+	if info, statErr := fsys.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := fsys.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			fsys.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = fsys.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(fsys, dir)
+}
+
+// CopyOptions controls how Copy moves the data.
+type CopyOptions struct {
+	// Contents copies the data from src, positioned at its start, into the
+	// newly created dest. Nil means a plain copy that stops when the
+	// context is canceled. Its errors are returned unchanged.
+	Contents func(dest File, src File) error
+}
+
+// Copy copies the contents of the file src to dest, which is created or
+// truncated. An interrupted copy removes dest.
+func Copy(ctx context.Context, fsys FS, src string, dest string, opts CopyOptions) error {
+	if err := checkContext(ctx, "copy", src); err != nil {
+		return err
+	}
+	srcFile, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := fsys.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_RDWR, defaultPerm)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	contents := opts.Contents
+	if contents == nil {
+		contents = func(dest File, src File) error {
+			_, err := io.Copy(dest, Reader(ctx, src))
+			return err
+		}
+	}
+	if err := contents(destFile, srcFile); err != nil {
+		if ctx.Err() != nil {
+			// leave nothing half-written behind when interrupted
+			destFile.Close()
+			fsys.Remove(dest)
+		}
+		return err
+	}
+	return destFile.Close()
+}
+
+// DeleteOptions controls what Delete removes.
+type DeleteOptions struct {
+	// Recursive removes a directory and everything it contains; otherwise
+	// only files and empty directories can be deleted.
+	Recursive bool
+}
+
+// Delete removes a file or directory. Unlike RemoveAll, a recursive
+// delete of a path that does not exist fails.
+func Delete(ctx context.Context, fsys FS, path string, opts DeleteOptions) error {
+	if err := checkContext(ctx, "remove", path); err != nil {
+		return err
+	}
+	if !opts.Recursive {
+		return fsys.Remove(path)
+	}
+	if _, err := fsys.Lstat(path); err != nil {
+		return err
+	}
+	return fsys.RemoveAll(path)
+}
+
+// Rename moves oldPath to newPath, replacing a file already there.
+func Rename(ctx context.Context, fsys FS, oldPath string, newPath string) error {
+	if err := checkContext(ctx, "rename", oldPath); err != nil {
+		return err
+	}
+	return fsys.Rename(oldPath, newPath)
+}
+
+// MkdirOptions controls how Mkdir creates a directory.
+type MkdirOptions struct {
+	// Perm is the permissions of the directories created, before the umask.
+	Perm fs.FileMode
+	// Parents also creates missing parent directories and accepts a
+	// directory that already exists.
+	Parents bool
+}
+
+// Mkdir creates a directory.
+func Mkdir(ctx context.Context, fsys FS, path string, opts MkdirOptions) error {
+	if err := checkContext(ctx, "mkdir", path); err != nil {
+		return err
+	}
+	if opts.Parents {
+		return fsys.MkdirAll(path, opts.Perm)
+	}
+	return fsys.Mkdir(path, opts.Perm)
+}
+
+// SyncDir flushes a directory entry of the OS file system to disk. Not
+// every platform supports this, so failures are ignored.
+func SyncDir(dir string) error {
+	return syncDir(OS, dir)
+}
+
+// flush a directory entry of fsys, ignoring failures
+func syncDir(fsys FS, dir string) error {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	d.Sync()
+	return nil
+}
+
+// Reader wraps r so reading from it fails with the context's cause once
+// ctx is canceled.
+func Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx, r}
+}
+
+// reader that checks its context before every read
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(buf []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, context.Cause(r.ctx)
+	}
+	return r.r.Read(buf)
+}
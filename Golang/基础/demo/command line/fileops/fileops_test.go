@@ -0,0 +1,325 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run test on the OS file system, confined to a temporary directory so
+// relative names work as they do on a MemFS, and on a MemFS
+func eachFS(t *testing.T, test func(t *testing.T, fsys FS)) {
+	t.Run("os", func(t *testing.T) {
+		fsys, err := Beneath(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, fsys)
+	})
+	t.Run("mem", func(t *testing.T) {
+		test(t, NewMemFS())
+	})
+}
+
+// the content of name, failing the test when it cannot be read
+func content(t *testing.T, fsys FS, name string) string {
+	t.Helper()
+	data, err := Read(context.Background(), fsys, name)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		opts WriteOptions
+		want string
+	}{
+		{"replace", WriteOptions{}, "new"},
+		{"append", WriteOptions{Append: true}, "oldnew"},
+		{"atomic", WriteOptions{Atomic: true}, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eachFS(t, func(t *testing.T, fsys FS) {
+				if err := Write(ctx, fsys, "file", strings.NewReader("old"), WriteOptions{}); err != nil {
+					t.Fatal(err)
+				}
+				if err := Write(ctx, fsys, "file", strings.NewReader("new"), tt.opts); err != nil {
+					t.Fatal(err)
+				}
+				if got := content(t, fsys, "file"); got != tt.want {
+					t.Errorf("content = %q, want %q", got, tt.want)
+				}
+				// an atomic write leaves no temporary file behind
+				entries, err := fsys.ReadDir(".")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 1 {
+					t.Errorf("directory holds %d entries, want 1", len(entries))
+				}
+			})
+		})
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		ctx := context.Background()
+		if err := Write(ctx, fsys, "missing", strings.NewReader("x"), WriteOptions{Append: true}); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("append to a missing file: %v, want ErrNotExist", err)
+		}
+		if err := Write(ctx, fsys, "file", strings.NewReader("x"), WriteOptions{Append: true, Atomic: true}); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("atomic append: %v, want ErrInvalid", err)
+		}
+		if err := Write(canceled, fsys, "file", strings.NewReader("x"), WriteOptions{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("canceled write: %v, want context.Canceled", err)
+		}
+		if _, err := fsys.Stat("file"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("a failed write created the file: %v", err)
+		}
+	})
+}
+
+func TestCreateTruncates(t *testing.T) {
+	ctx := context.Background()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		if err := Write(ctx, fsys, "file", strings.NewReader("data"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Create(ctx, fsys, "file"); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(t, fsys, "file"); got != "" {
+			t.Errorf("content = %q, want it empty", got)
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		if err := Mkdir(ctx, fsys, "dir/sub", MkdirOptions{Perm: 0755, Parents: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(ctx, fsys, "dir/sub/file", strings.NewReader("x"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Delete(ctx, fsys, "dir", DeleteOptions{}); err == nil {
+			t.Error("deleting a non-empty directory without Recursive succeeded")
+		}
+		if err := Delete(ctx, fsys, "missing", DeleteOptions{Recursive: true}); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("recursive delete of a missing path: %v, want ErrNotExist", err)
+		}
+		if err := Delete(ctx, fsys, "dir", DeleteOptions{Recursive: true}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.Lstat("dir/sub/file"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("file under a deleted directory: %v, want ErrNotExist", err)
+		}
+	})
+}
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		for name, data := range map[string]string{"a": "a", "b": "b", "full/file": "x"} {
+			if err := fsys.MkdirAll("full", 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := Write(ctx, fsys, name, strings.NewReader(data), WriteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := fsys.Mkdir("empty", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := Rename(ctx, fsys, "a", "b"); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(t, fsys, "b"); got != "a" {
+			t.Errorf("renamed file holds %q, want %q", got, "a")
+		}
+		if err := Rename(ctx, fsys, "full", "moved"); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(t, fsys, "moved/file"); got != "x" {
+			t.Errorf("file moved with its directory holds %q, want %q", got, "x")
+		}
+		// os.Rename replaces no directory, not even an empty one
+		if err := Rename(ctx, fsys, "moved", "empty"); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("renaming a directory over another: %v, want ErrExist", err)
+		}
+		if err := Rename(ctx, fsys, "b", "empty"); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("renaming a file over a directory: %v, want ErrExist", err)
+		}
+	})
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		if err := Write(ctx, fsys, "src", strings.NewReader("content"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(ctx, fsys, "dest", strings.NewReader("longer old content"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Copy(ctx, fsys, "src", "dest", CopyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(t, fsys, "dest"); got != "content" {
+			t.Errorf("copy holds %q, want %q", got, "content")
+		}
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		if err := Write(ctx, fsys, "file", strings.NewReader("content"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Chmod("file", 0600); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		if err := fsys.Chtimes("file", time.Time{}, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Truncate("file", 4); err != nil {
+			t.Fatal(err)
+		}
+		info, err := fsys.Stat("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+		}
+		if got := content(t, fsys, "file"); got != "cont" {
+			t.Errorf("truncated file holds %q, want %q", got, "cont")
+		}
+		// truncating changes the time again, so it is set last
+		if err := fsys.Chtimes("file", time.Time{}, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if info, _ = fsys.Stat("file"); !info.ModTime().Equal(mtime) {
+			t.Errorf("modification time = %v, want %v", info.ModTime(), mtime)
+		}
+	})
+}
+
+func TestLink(t *testing.T) {
+	ctx := context.Background()
+	eachFS(t, func(t *testing.T, fsys FS) {
+		if err := Write(ctx, fsys, "file", strings.NewReader("old"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Link("file", "link"); err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(ctx, fsys, "file", strings.NewReader("new"), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(t, fsys, "link"); got != "new" {
+			t.Errorf("hard link holds %q, want %q", got, "new")
+		}
+		if err := fsys.Link("file", "link"); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("linking over an existing name: %v, want ErrExist", err)
+		}
+		if err := fsys.Remove("file"); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(t, fsys, "link"); got != "new" {
+			t.Errorf("hard link holds %q after the other name was removed, want %q", got, "new")
+		}
+	})
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemFS()
+	if err := Write(ctx, mem, "file", strings.NewReader("data"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	fsys := ReadOnly(mem)
+
+	changes := map[string]func() error{
+		"create":   func() error { return Create(ctx, fsys, "new") },
+		"write":    func() error { return Write(ctx, fsys, "file", strings.NewReader("x"), WriteOptions{}) },
+		"atomic":   func() error { return Write(ctx, fsys, "file", strings.NewReader("x"), WriteOptions{Atomic: true}) },
+		"append":   func() error { return Write(ctx, fsys, "file", strings.NewReader("x"), WriteOptions{Append: true}) },
+		"copy":     func() error { return Copy(ctx, fsys, "file", "copy", CopyOptions{}) },
+		"delete":   func() error { return Delete(ctx, fsys, "file", DeleteOptions{}) },
+		"rename":   func() error { return Rename(ctx, fsys, "file", "moved") },
+		"mkdir":    func() error { return Mkdir(ctx, fsys, "dir", MkdirOptions{Perm: 0755, Parents: true}) },
+		"symlink":  func() error { return fsys.Symlink("file", "link") },
+		"link":     func() error { return fsys.Link("file", "link") },
+		"chmod":    func() error { return fsys.Chmod("file", 0600) },
+		"chown":    func() error { return fsys.Chown("file", 0, 0) },
+		"chtimes":  func() error { return fsys.Chtimes("file", time.Now(), time.Now()) },
+		"truncate": func() error { return fsys.Truncate("file", 0) },
+		"write to an open file": func() error {
+			f, err := fsys.Open("file")
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Write([]byte("x"))
+			return err
+		},
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			if err := change(); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("err = %v, want ErrReadOnly", err)
+			}
+		})
+	}
+
+	if got := content(t, fsys, "file"); got != "data" {
+		t.Errorf("file holds %q, want it unchanged", got)
+	}
+	entries, err := mem.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("file system holds %d entries, want only the file", len(entries))
+	}
+}
+
+func TestMemFSOpenFlags(t *testing.T) {
+	mem := NewMemFS()
+	if _, err := mem.OpenFile("file", os.O_WRONLY, 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("opening a missing file without O_CREATE: %v, want ErrNotExist", err)
+	}
+	if _, err := mem.OpenFile("missing/file", os.O_WRONLY|os.O_CREATE, 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("creating a file in a missing directory: %v, want ErrNotExist", err)
+	}
+	f, err := mem.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := mem.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("O_EXCL on an existing file: %v, want ErrExist", err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("writing to a closed file: %v, want ErrClosed", err)
+	}
+	if err := mem.Symlink("file", "link"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("symlink: %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,197 @@
+package fileops
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FS is a file system the operations work on. Names are paths in the
+// style of package os, not the slash-separated names of io/fs, and errors
+// are *fs.PathError or *os.LinkError like those of package os.
+type FS interface {
+	// Open opens a file or directory for reading.
+	Open(name string) (File, error)
+	// OpenFile opens a file with the os.O_* flags, creating it with perm.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	// CreateTemp creates a new file in dir, named after pattern as in
+	// os.CreateTemp, and opens it for reading and writing.
+	CreateTemp(dir string, pattern string) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldName string, newName string) error
+	// Readlink returns the target of a symlink.
+	Readlink(name string) (string, error)
+	// Symlink creates newName as a symlink to oldName, which is stored as
+	// it is given.
+	Symlink(oldName string, newName string) error
+	// Link creates newName as a hard link to the file oldName.
+	Link(oldName string, newName string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chown(name string, uid int, gid int) error
+	// Lchown changes the owner of a symlink itself rather than its target.
+	Lchown(name string, uid int, gid int) error
+	// Chtimes sets the access and modification times; a zero time leaves
+	// that one unchanged.
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+	Truncate(name string, size int64) error
+}
+
+// File is an open file of an FS; *os.File is the one of OS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Sync() error
+	Chmod(mode fs.FileMode) error
+}
+
+// OS is the file system of the operating system. On Windows it gives long
+// paths the \\?\ prefix and refuses to create files with reserved names.
+var OS FS = osFS{}
+
+// FS backed by package os; it returns *os.File
+type osFS struct{}
+
+// return f as a File, without turning a nil *os.File into a non-nil interface
+func osFile(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// report the errors of a call made with LongPath(name) under name itself
+func shortName(err error, name string) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) && pathErr.Path == longPath(name) {
+		pathErr.Path = name
+	}
+	return err
+}
+
+func (osFS) Open(name string) (File, error) {
+	f, err := os.Open(longPath(name))
+	return osFile(f, shortName(err, name))
+}
+
+func (osFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&os.O_CREATE != 0 {
+		if err := checkCreate("open", name); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(longPath(name), flag, perm)
+	return osFile(f, shortName(err, name))
+}
+
+func (osFS) CreateTemp(dir string, pattern string) (File, error) {
+	f, err := os.CreateTemp(longPath(dir), pattern)
+	return osFile(f, err)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := os.Stat(longPath(name))
+	return info, shortName(err, name)
+}
+
+func (osFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := os.Lstat(longPath(name))
+	return info, shortName(err, name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := os.ReadDir(longPath(name))
+	return entries, shortName(err, name)
+}
+
+func (osFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := checkCreate("mkdir", name); err != nil {
+		return err
+	}
+	return shortName(os.Mkdir(longPath(name), perm), name)
+}
+
+func (osFS) MkdirAll(name string, perm fs.FileMode) error {
+	for dir := name; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if err := checkCreate("mkdir", dir); err != nil {
+			return err
+		}
+	}
+	return shortName(os.MkdirAll(longPath(name), perm), name)
+}
+
+func (osFS) Remove(name string) error {
+	return shortName(os.Remove(longPath(name)), name)
+}
+
+func (osFS) RemoveAll(name string) error {
+	return shortName(os.RemoveAll(longPath(name)), name)
+}
+
+// report the errors of a call made with LongPath names under the names given
+func shortNames(err error, oldName string, newName string) error {
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		linkErr.Old, linkErr.New = oldName, newName
+	}
+	return err
+}
+
+func (osFS) Rename(oldName string, newName string) error {
+	if err := checkCreate("rename", newName); err != nil {
+		return err
+	}
+	return shortNames(os.Rename(longPath(oldName), longPath(newName)), oldName, newName)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	target, err := os.Readlink(longPath(name))
+	return target, shortName(err, name)
+}
+
+// the target is what the link will hold, so it is not made a long path
+func (osFS) Symlink(oldName string, newName string) error {
+	if err := checkCreate("symlink", newName); err != nil {
+		return err
+	}
+	return shortNames(os.Symlink(oldName, longPath(newName)), oldName, newName)
+}
+
+func (osFS) Link(oldName string, newName string) error {
+	if err := checkCreate("link", newName); err != nil {
+		return err
+	}
+	return shortNames(os.Link(longPath(oldName), longPath(newName)), oldName, newName)
+}
+
+func (osFS) Chmod(name string, mode fs.FileMode) error {
+	return shortName(os.Chmod(longPath(name), mode), name)
+}
+
+func (osFS) Chown(name string, uid int, gid int) error {
+	return shortName(os.Chown(longPath(name), uid, gid), name)
+}
+
+func (osFS) Lchown(name string, uid int, gid int) error {
+	return shortName(os.Lchown(longPath(name), uid, gid), name)
+}
+
+func (osFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return shortName(os.Chtimes(longPath(name), atime, mtime), name)
+}
+
+func (osFS) Truncate(name string, size int64) error {
+	return shortName(os.Truncate(longPath(name), size), name)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package fileops
+
+// only Windows limits path lengths this way
+func longPath(path string) string {
+	return path
+}
+
+// only Windows reserves device names in every directory
+func reservedHere(name string) bool {
+	return false
+}
@@ -0,0 +1,32 @@
+package fileops
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// paths this long need the prefix: MAX_PATH less room for an 8.3 file
+// name, since directories are limited to that
+const maxPath = 248
+
+// prefix path when it is too long for the classic Windows calls
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	// the prefix turns off all parsing, so the path must be absolute and
+	// clean, with backslashes only
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// report whether a name cannot be created because Windows reserves it
+func reservedHere(name string) bool {
+	return IsReservedName(name)
+}
@@ -0,0 +1,490 @@
+package fileops
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errors of a MemFS that package os reports with platform error numbers
+var (
+	errNotEmpty = errors.New("directory not empty")
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+)
+
+// MemFS is an FS held in memory, so tests can run operations without
+// touching the disk. Relative names are taken from the root, so
+// "a/b" and "/a/b" are the same file. It has hard links but no symlinks,
+// and does not keep owners or access times. It is safe for concurrent use.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode // by cleaned slash path, always holding "/"
+	temp  int                 // counter for CreateTemp names
+}
+
+// a file or directory of a MemFS
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS holding only the root directory.
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{
+		"/": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+	}}
+}
+
+// the key of a name in nodes
+func memPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// the node of a directory that must exist to create name
+func (m *MemFS) parent(op string, name string, key string) (*memNode, error) {
+	dir, ok := m.nodes[path.Dir(key)]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !dir.mode.IsDir() {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return dir, nil
+}
+
+// the keys of everything below the directory key
+func (m *MemFS) below(key string) []string {
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	var keys []string
+	for k := range m.nodes {
+		if k != key && strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memPath(name)
+	node, ok := m.nodes[key]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case ok && node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if _, err := m.parent("open", name, key); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[key] = node
+	case flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		node.data = nil
+		node.modTime = time.Now()
+	}
+	return &memFile{fs: m, node: node, name: name, flag: flag}, nil
+}
+
+func (m *MemFS) CreateTemp(dir string, pattern string) (File, error) {
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	for {
+		m.mu.Lock()
+		m.temp++
+		n := m.temp
+		m.mu.Unlock()
+		name := filepath.Join(dir, prefix+strconv.Itoa(n)+suffix)
+		f, err := m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	return m.Lstat(name)
+}
+
+// a MemFS has no symlinks, so Lstat is Stat
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memPath(name)
+	node, ok := m.nodes[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return node.info(path.Base(key)), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memPath(name)
+	node, ok := m.nodes[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: errNotDir}
+	}
+	var entries []fs.DirEntry
+	for _, k := range m.below(key) {
+		if path.Dir(k) == key {
+			entries = append(entries, fs.FileInfoToDirEntry(m.nodes[k].info(path.Base(k))))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memPath(name)
+	if _, ok := m.nodes[key]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if _, err := m.parent("mkdir", name, key); err != nil {
+		return err
+	}
+	m.nodes[key] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	key := memPath(name)
+	if key != "/" {
+		if err := m.MkdirAll(path.Dir(key), perm); err != nil {
+			return err
+		}
+	}
+	err := m.Mkdir(key, perm)
+	if errors.Is(err, fs.ErrExist) {
+		if info, _ := m.Stat(key); info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: name, Err: errNotDir}
+	}
+	return err
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memPath(name)
+	if _, ok := m.nodes[key]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(m.below(key)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	if key == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	delete(m.nodes, key)
+	return nil
+}
+
+// like os.RemoveAll, removing a name that does not exist succeeds
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memPath(name)
+	if key == "/" {
+		return &fs.PathError{Op: "unlinkat", Path: name, Err: fs.ErrInvalid}
+	}
+	for _, k := range m.below(key) {
+		delete(m.nodes, k)
+	}
+	delete(m.nodes, key)
+	return nil
+}
+
+// like os.Rename, a file replaces a file, and nothing replaces a directory
+func (m *MemFS) Rename(oldName string, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldKey, newKey := memPath(oldName), memPath(newName)
+	fail := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: err}
+	}
+	node, ok := m.nodes[oldKey]
+	if !ok {
+		return fail(fs.ErrNotExist)
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if strings.HasPrefix(newKey, oldKey+"/") || oldKey == "/" {
+		return fail(fs.ErrInvalid)
+	}
+	if _, err := m.parent("rename", newName, newKey); err != nil {
+		return fail(fs.ErrNotExist)
+	}
+	if target, ok := m.nodes[newKey]; ok {
+		switch {
+		case target.mode.IsDir():
+			return fail(fs.ErrExist)
+		case node.mode.IsDir():
+			return fail(errNotDir)
+		}
+	}
+	for _, k := range m.below(oldKey) {
+		m.nodes[newKey+strings.TrimPrefix(k, oldKey)] = m.nodes[k]
+		delete(m.nodes, k)
+	}
+	delete(m.nodes, oldKey)
+	m.nodes[newKey] = node
+	return nil
+}
+
+// the node of an existing name, for calls that change it in place
+func (m *MemFS) node(op string, name string) (*memNode, error) {
+	node, ok := m.nodes[memPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return node, nil
+}
+
+// there are no symlinks, so every name that exists is not one
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.node("readlink", name); err != nil {
+		return "", err
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+func (m *MemFS) Symlink(oldName string, newName string) error {
+	return &os.LinkError{Op: "symlink", Old: oldName, New: newName, Err: errors.ErrUnsupported}
+}
+
+// the new name shares the node, so writes through either show in both
+func (m *MemFS) Link(oldName string, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fail := func(err error) error {
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: err}
+	}
+	node, ok := m.nodes[memPath(oldName)]
+	switch {
+	case !ok:
+		return fail(fs.ErrNotExist)
+	case node.mode.IsDir():
+		return fail(fs.ErrPermission)
+	}
+	newKey := memPath(newName)
+	if _, ok := m.nodes[newKey]; ok {
+		return fail(fs.ErrExist)
+	}
+	if _, err := m.parent("link", newName, newKey); err != nil {
+		return fail(fs.ErrNotExist)
+	}
+	m.nodes[newKey] = node
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("chmod", name)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+// owners are not kept, so only the name is checked
+func (m *MemFS) Chown(name string, uid int, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.node("chown", name)
+	return err
+}
+
+func (m *MemFS) Lchown(name string, uid int, gid int) error {
+	return m.Chown(name, uid, gid)
+}
+
+func (m *MemFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("chtimes", name)
+	if err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		node.modTime = mtime
+	}
+	return nil
+}
+
+func (m *MemFS) Truncate(name string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("truncate", name)
+	switch {
+	case err != nil:
+		return err
+	case node.mode.IsDir():
+		return &fs.PathError{Op: "truncate", Path: name, Err: errIsDir}
+	case size < 0:
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrInvalid}
+	}
+	if size <= int64(len(node.data)) {
+		node.data = node.data[:size]
+	} else {
+		node.data = append(node.data, make([]byte, size-int64(len(node.data)))...)
+	}
+	node.modTime = time.Now()
+	return nil
+}
+
+// the file info of a node named name
+func (n *memNode) info(name string) fs.FileInfo {
+	return &memInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// snapshot of a node's metadata
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// an open file of a MemFS; it keeps working on its node after a rename or remove, as on Unix
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	case f.node.mode.IsDir() && op != "seek":
+		return &fs.PathError{Op: op, Path: f.name, Err: errIsDir}
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0,
+		!write && op == "read" && f.flag&os.O_WRONLY != 0:
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Read(buf []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(buf []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(buf)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.offset:], buf)
+	f.offset += int64(len(buf))
+	f.node.modTime = time.Now()
+	return len(buf), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("seek", false); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Chmod(mode fs.FileMode) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.node.mode = f.node.mode.Type() | mode.Perm()
+	return nil
+}
@@ -0,0 +1,94 @@
+package fileops
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrReadOnly is the error of every change to a file system wrapped by ReadOnly.
+var ErrReadOnly = errors.New("read-only file system")
+
+// ReadOnly wraps fsys so it can be read but not changed: opening a file
+// for writing, creating, linking, removing, renaming, truncating and
+// changing the mode, owner or times of a file fail with ErrReadOnly.
+func ReadOnly(fsys FS) FS {
+	return readOnlyFS{fsys}
+}
+
+// FS that refuses every change
+type readOnlyFS struct {
+	fsys FS
+}
+
+// the error of op on name
+func readOnly(op string, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Open(name string) (File, error) {
+	f, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{f}, nil
+}
+
+func (r readOnlyFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, readOnly("open", name)
+	}
+	f, err := r.fsys.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{f}, nil
+}
+
+func (r readOnlyFS) CreateTemp(dir string, pattern string) (File, error) {
+	return nil, readOnly("createtemp", dir)
+}
+
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error)        { return r.fsys.Stat(name) }
+func (r readOnlyFS) Lstat(name string) (fs.FileInfo, error)       { return r.fsys.Lstat(name) }
+func (r readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error)   { return r.fsys.ReadDir(name) }
+func (r readOnlyFS) Mkdir(name string, perm fs.FileMode) error    { return readOnly("mkdir", name) }
+func (r readOnlyFS) MkdirAll(name string, perm fs.FileMode) error { return readOnly("mkdir", name) }
+func (r readOnlyFS) Remove(name string) error                     { return readOnly("remove", name) }
+func (r readOnlyFS) RemoveAll(name string) error                  { return readOnly("remove", name) }
+
+func (r readOnlyFS) Rename(oldName string, newName string) error {
+	return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Readlink(name string) (string, error) { return r.fsys.Readlink(name) }
+
+func (r readOnlyFS) Symlink(oldName string, newName string) error {
+	return &os.LinkError{Op: "symlink", Old: oldName, New: newName, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Link(oldName string, newName string) error {
+	return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Chmod(name string, mode fs.FileMode) error  { return readOnly("chmod", name) }
+func (r readOnlyFS) Chown(name string, uid int, gid int) error  { return readOnly("chown", name) }
+func (r readOnlyFS) Lchown(name string, uid int, gid int) error { return readOnly("lchown", name) }
+func (r readOnlyFS) Chtimes(name string, atime, mtime time.Time) error {
+	return readOnly("chtimes", name)
+}
+func (r readOnlyFS) Truncate(name string, size int64) error { return readOnly("truncate", name) }
+
+// file of a readOnlyFS, which cannot be written to or have its mode changed
+type readOnlyFile struct {
+	File
+}
+
+func (f readOnlyFile) Write(buf []byte) (int, error) {
+	return 0, readOnly("write", f.Name())
+}
+
+func (f readOnlyFile) Chmod(mode fs.FileMode) error {
+	return readOnly("chmod", f.Name())
+}
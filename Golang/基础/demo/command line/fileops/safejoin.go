@@ -0,0 +1,45 @@
+package fileops
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SafeJoin joins dir and name, a relative path from a source that cannot
+// be trusted, such as an archive entry, a tree being copied or a saved
+// sync state. Slashes in name are taken as separators. It fails with
+// ErrEscape when name is absolute, has a .. part, or leads out of dir
+// through a symlink already on disk, so nothing written to the result can
+// land outside dir. On Windows names reserved for devices fail with
+// ErrReservedName.
+func SafeJoin(dir string, name string) (string, error) {
+	escape := &fs.PathError{Op: "join", Path: name, Err: ErrEscape}
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(name, string(filepath.Separator)) {
+		return "", escape
+	}
+	parts := strings.FieldsFunc(name, func(c rune) bool { return c == '/' || os.IsPathSeparator(uint8(c)) })
+	for _, part := range parts {
+		if part == ".." {
+			return "", escape
+		}
+		if reservedHere(part) {
+			return "", &fs.PathError{Op: "join", Path: name, Err: ErrReservedName}
+		}
+	}
+
+	// symlinks up to dir itself are trusted, those below it are followed
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+	if _, err := Resolve(root, name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
@@ -0,0 +1,70 @@
+package fileops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "dir")
+	outside := filepath.Join(base, "outside")
+	for _, d := range []string{filepath.Join(dir, "sub"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inside":   "sub",
+		"absolute": outside,
+		"relative": filepath.Join("..", "outside"),
+		"nested":   filepath.Join("sub", "..", "..", "outside"),
+		"chain":    "relative",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		escape bool
+	}{
+		{"file", false},
+		{"sub/file", false},
+		{"sub/deeper/new", false},
+		{"./file", false},
+		{"inside/file", false},
+		{"inside", false},
+		{"../file", true},
+		{"sub/../../file", true},
+		{"sub/../file", true},
+		{"..", true},
+		{"/etc/passwd", true},
+		{"absolute", true},
+		{"absolute/file", true},
+		{"relative/file", true},
+		{"nested/file", true},
+		{"chain/file", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SafeJoin(dir, tt.name)
+			if tt.escape {
+				if !errors.Is(err, ErrEscape) {
+					t.Fatalf("SafeJoin(%q) = %q, %v; want ErrEscape", tt.name, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SafeJoin(%q): %v", tt.name, err)
+			}
+			if want := filepath.Join(dir, filepath.FromSlash(tt.name)); got != want {
+				t.Errorf("SafeJoin(%q) = %q, want %q", tt.name, got, want)
+			}
+		})
+	}
+}
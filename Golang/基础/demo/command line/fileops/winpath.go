@@ -0,0 +1,46 @@
+package fileops
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// ErrReservedName is the error of creating a file whose name Windows
+// keeps for a device, such as CON, NUL or COM1.
+var ErrReservedName = errors.New("name is reserved for a device on Windows")
+
+// device names Windows reserves in every directory
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// IsReservedName reports whether the last element of path is a device name
+// Windows reserves, in any case and also with an extension or trailing
+// spaces, as in nul.txt or "COM1 ". Such names cannot be used for files
+// there, whatever the directory.
+func IsReservedName(path string) bool {
+	base := path[strings.LastIndexAny(path, `/\`)+1:]
+	base, _, _ = strings.Cut(base, ".")
+	return reservedNames[strings.ToUpper(strings.TrimRight(base, " "))]
+}
+
+// LongPath returns the form of path that Windows accepts beyond the
+// classic 260 character limit: long paths are made absolute and given the
+// \\?\ prefix, or \\?\UNC\ for network paths. Short paths, and every path
+// on other systems, are returned as they are.
+func LongPath(path string) string {
+	return longPath(path)
+}
+
+// fail with ErrReservedName when name cannot be created on this system
+func checkCreate(op string, name string) error {
+	if !reservedHere(name) {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: name, Err: ErrReservedName}
+}
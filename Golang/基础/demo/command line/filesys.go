@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cmdline/fileops"
+)
+
+// the file system the operations of package fileops work on; -read-only
+// wraps it so every change fails
+var fsys fileops.FS = fileops.OS
+
+// commands that never change files, so -read-only lets them run as they are
+var readOnlyCommands = map[string]bool{
+	"read": true, "list": true, "find": true, "grep": true, "tree": true, "diff": true,
+	"diff-dir": true, "du": true, "check": true, "verify": true, "stat": true, "type": true, "wc": true, "hash": true,
+	"readlink": true, "resolve": true, "completion": true, "version": true,
+	"batch": true, "shell": true, // their steps are checked one by one
+}
+
+// with -read-only, refuse a command line that could change files before it
+// starts. Other commands only run with -dry-run, -help or the options that
+// make them read: replace without -in-place, dedupe reporting, watch
+// without -exec and the -list of extract, restore and undo. This only
+// fails early, before the journal or audit log is written: the changes
+// themselves go through fsys, which refuses them anyway
+func checkReadOnly(name string, args []string) error {
+	if !opts.ReadOnly || opts.DryRun || readOnlyCommands[name] {
+		return nil
+	}
+	// the flags given, with the value after = or else the next argument,
+	// in case the flag takes one
+	given := map[string]string{}
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") || arg == "--" {
+			continue
+		}
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		if value != "false" {
+			given[flagName] = value
+		}
+	}
+	has := func(flagName string) bool {
+		_, ok := given[flagName]
+		return ok
+	}
+	switch {
+	case has("dry-run"), has("help"), has("h"):
+		return nil
+	case name == "replace" && !has("in-place"):
+		return nil
+	case name == "dedupe" && (!has("action") || given["action"] == "report"):
+		return nil
+	case name == "watch" && !has("exec"):
+		return nil
+	case (name == "extract" || name == "restore" || name == "undo") && has("list"):
+		return nil
+	}
+	return usageError("running command", errors.New(tr("%s can change files, so it does not run with -read-only; add -dry-run to see what it would do", name)))
+}
+
+// moves into and out of the journal and trash go through the OS file
+// system, since those lie outside any -root, so check the paths of the
+// user's files here as fsys would
+func checkHostMove(path string) error {
+	if opts.ReadOnly {
+		return &fs.PathError{Op: "move", Path: path, Err: fileops.ErrReadOnly}
+	}
+	return confine(path)
+}
+
+// with -root, make the root the current directory, so relative paths start
+// there, and confine fsys to it
+func enterRoot(dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	if fsys, err = fileops.Beneath(root); err != nil {
+		return err
+	}
+	opts.Root = root
+	return os.Chdir(root)
+}
+
+// with -root, check that each path stays beneath the root once its
+// symlinks are followed
+func confine(paths ...string) error {
+	if opts.Root == "" {
+		return nil
+	}
+	for _, path := range paths {
+		if path == "" {
+			// an optional flag left out
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if _, err := fileops.Resolve(opts.Root, abs); err != nil {
+			if errors.Is(err, fileops.ErrEscape) {
+				return &fs.PathError{Op: "resolve", Path: path, Err: fileops.ErrEscape}
+			}
+			return err
+		}
+	}
+	return nil
+}
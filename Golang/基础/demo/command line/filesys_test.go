@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// a listing of everything under dir with its mode, size, time and content
+func treeState(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	state := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		state[path] = fmt.Sprint(info.Mode(), info.Size(), info.ModTime().UnixNano())
+		if info.Mode().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			state[path] += " " + string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// the operations refuse to change anything on a read-only fsys, without
+// relying on -read-only turning the command away first
+func TestReadOnlyRefusesChanges(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	savedFS, savedOpts := fsys, opts
+	t.Cleanup(func() { fsys, opts = savedFS, savedOpts })
+	fsys = fileops.ReadOnly(fileops.OS)
+	opts.ReadOnly = true
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	other := filepath.Join(dir, "other")
+	link := filepath.Join(dir, "link")
+	for _, path := range []string{file, other} {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "test.tar")
+	writeTestTar(t, archive, []testEntry{{Name: "file", Body: "new"}, {Name: "added", Body: "new"}})
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := parseModeChange("600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"touch", func() error { _, err := touchFile(file, now, now, false); return err }},
+		{"touch new", func() error { _, err := touchFile(filepath.Join(dir, "new"), now, now, false); return err }},
+		{"chmod", func() error { _, err := chmodPath(file, info, private); return err }},
+		{"chown", func() error { return chownPath(file, os.Getuid(), os.Getgid(), false) }},
+		{"shred", func() error { return shredPath(fsys, file, false, 1) }},
+		{"copy symlink", func() error { return copyLink(fsys, link, filepath.Join(dir, "link2")) }},
+		{"copy keeping time", func() error { return copyKeepingTime(file, filepath.Join(dir, "copy")) }},
+		{"move", func() error { return moveFile(file, filepath.Join(dir, "moved")) }},
+		{"hard link", func() error { return replaceWithLink(file, other) }},
+		{"delete", func() error { return deleteJournaled(file, false) }},
+		{"trash", func() error { _, err := trashFile(file); return err }},
+		{"mktemp", func() error { _, err := makeTemp(false, tempOptions{Dir: dir, Prefix: "tmp"}); return err }},
+		{"mktempdir", func() error { _, err := makeTemp(true, tempOptions{Dir: dir, Prefix: "tmp"}); return err }},
+		{"extract", func() error { _, err := extractArchive(archive, dir, archiveOptions{}); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := treeState(t, dir)
+			if err := tt.op(); !errors.Is(err, fileops.ErrReadOnly) {
+				t.Errorf("err = %v, want ErrReadOnly", err)
+			}
+			after := treeState(t, dir)
+			for path, state := range before {
+				if after[path] != state {
+					t.Errorf("%s changed: %q, was %q", path, after[path], state)
+				}
+			}
+			for path := range after {
+				if _, ok := before[path]; !ok {
+					t.Errorf("%s was created", path)
+				}
+			}
+		})
+	}
+}
+
+// the operations that only go through fsys work on a MemFS, without
+// touching the disk
+func TestOperationsOnMemFS(t *testing.T) {
+	savedFS := fsys
+	t.Cleanup(func() { fsys = savedFS })
+	mem := fileops.NewMemFS()
+	fsys = mem
+	if err := mem.MkdirAll("/work", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	created, err := touchFile("/work/note", mtime, mtime, false)
+	if err != nil || !created {
+		t.Fatalf("touch = %v, %v; want a new file", created, err)
+	}
+	if info, err := mem.Stat("/work/note"); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("touched file: %v, %v; want modified at %v", info, err, mtime)
+	}
+
+	if err := fileops.Write(cmdCtx, fsys, "/work/note", strings.NewReader("port: 80\n"), fileops.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	before, after, err := replaceInFile("/work/note", regexp.MustCompile(`\d+`), "8080")
+	if err != nil || before != "port: 80\n" || after != "port: 8080\n" {
+		t.Errorf("replace = %q, %q, %v", before, after, err)
+	}
+
+	for _, dir := range []bool{false, true} {
+		path, err := makeTemp(dir, tempOptions{Dir: "/work", Prefix: "tmp"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, err := mem.Stat(path); err != nil || info.IsDir() != dir {
+			t.Errorf("mktemp dir=%v made %s: %v, %v", dir, path, info, err)
+		}
+	}
+
+	if err := shredPath(fsys, "/work/note", false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.Stat("/work/note"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("shredded file: %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// how much of a file is looked at to tell its type, and text from binary
+// as git does
+const sniffLen = 8000
+
+// report whether data looks binary: a NUL byte near the start means it is
+// not text in any 8-bit encoding or UTF-8
+func looksBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), sniffLen)], 0) >= 0
+}
+
+// the start of a file, enough to tell its type
+func sniffFile(path string) ([]byte, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// report whether the file at path looks binary; read, grep and replace
+// leave such files alone unless given -binary
+func isBinaryFile(path string) (bool, error) {
+	head, err := sniffFile(path)
+	if err != nil {
+		return false, err
+	}
+	return looksBinary(head), nil
+}
+
+// signatures of formats net/http does not sniff, looked for first; the
+// short ones of binary formats only count when the contents look binary
+var magicTypes = []struct {
+	offset int
+	magic  string
+	mime   string
+	binary bool
+}{
+	{0, cryptMagic, "application/x-fileutil-encrypted", false},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd", false},
+	{0, "\xfd7zXZ\x00", "application/x-xz", false},
+	{0, "BZh", "application/x-bzip2", true},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed", false},
+	{257, "ustar", "application/x-tar", false},
+	{0, "\x7fELF", "application/x-elf", false},
+	{0, "MZ", "application/vnd.microsoft.portable-executable", true},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary", false},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary", false},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3", false},
+	{4, "ftypheic", "image/heic", false},
+	{0, "-----BEGIN ", "application/x-pem-file", false},
+	{0, "#!", "text/x-shellscript", false},
+}
+
+// a human readable kind for the MIME types sniffing gives
+var mimeKinds = map[string]string{
+	"application/x-fileutil-encrypted":              "file encrypted by fileutil",
+	"application/zstd":                              "Zstandard compressed data",
+	"application/x-xz":                              "XZ compressed data",
+	"application/x-bzip2":                           "bzip2 compressed data",
+	"application/x-gzip":                            "gzip compressed data",
+	"application/x-7z-compressed":                   "7-Zip archive",
+	"application/x-tar":                             "tar archive",
+	"application/zip":                               "ZIP archive",
+	"application/x-rar-compressed":                  "RAR archive",
+	"application/x-elf":                             "ELF executable",
+	"application/vnd.microsoft.portable-executable": "Windows executable",
+	"application/x-mach-binary":                     "Mach-O executable",
+	"application/vnd.sqlite3":                       "SQLite database",
+	"application/pdf":                               "PDF document",
+	"application/postscript":                        "PostScript document",
+	"application/wasm":                              "WebAssembly module",
+	"application/x-pem-file":                        "PEM certificate or key",
+	"application/json":                              "JSON text",
+	"application/ogg":                               "Ogg media",
+	"application/octet-stream":                      "binary data",
+	"text/html":                                     "HTML document",
+	"text/xml":                                      "XML document",
+	"text/x-shellscript":                            "script",
+	"text/plain":                                    "text",
+	"image/heic":                                    "HEIC image",
+}
+
+// the type of a file's contents, as reported by type
+type contentType struct {
+	Path string `json:"path"`
+	MIME string `json:"mime"`
+	Kind string `json:"kind"`
+}
+
+// tell the type of contents starting with head by their magic bytes; the
+// name only refines plain text, whose format sniffing cannot tell apart
+func detectType(head []byte, name string) contentType {
+	t := contentType{Path: name, MIME: "application/octet-stream"}
+	if len(head) == 0 {
+		return contentType{Path: name, MIME: "inode/x-empty", Kind: "empty"}
+	}
+	binary := looksBinary(head)
+	found := false
+	for _, m := range magicTypes {
+		if m.binary && !binary {
+			continue
+		}
+		if len(head) >= m.offset+len(m.magic) && string(head[m.offset:m.offset+len(m.magic)]) == m.magic {
+			t.MIME, found = m.mime, true
+			break
+		}
+	}
+	if !found {
+		t.MIME, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	if t.MIME == "text/plain" && !binary {
+		if byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name))); err == nil && isTextMIME(byExt) {
+			t.MIME = byExt
+		}
+	}
+	t.Kind = mimeKinds[t.MIME]
+	if t.Kind == "" {
+		// image/png becomes "PNG image", text/csv "CSV text"
+		major, minor, _ := strings.Cut(t.MIME, "/")
+		minor = strings.TrimPrefix(strings.TrimPrefix(minor, "x-"), "vnd.")
+		t.Kind = strings.ToUpper(minor) + " " + major
+	}
+	return t
+}
+
+// report whether a MIME type names text, which sniffing reports as text/plain
+func isTextMIME(t string) bool {
+	switch t {
+	case "application/json", "application/xml", "application/javascript", "application/toml", "application/yaml":
+		return true
+	}
+	return strings.HasPrefix(t, "text/")
+}
+
+// the type of the file at path, from its contents
+func typeOf(path string) (contentType, error) {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return contentType{}, err
+	}
+	if info.IsDir() {
+		return contentType{Path: path, MIME: "inode/directory", Kind: "directory"}, nil
+	}
+	head, err := sniffFile(path)
+	if err != nil {
+		return contentType{}, err
+	}
+	return detectType(head, path), nil
+}
+
+// report the MIME type and kind of files, told by their contents
+func runType(args []string) error {
+	flags := newFlagSet("type")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("detecting file type", err)
+	}
+	var results []contentType
+	for _, path := range paths {
+		t, err := typeOf(path)
+		if err != nil {
+			return fail("detecting file type", err)
+		}
+		if opts.JSON {
+			results = append(results, t)
+			continue
+		}
+		fmt.Printf("%s: %s (%s)\n", path, t.MIME, tr(t.Kind))
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	return nil
+}
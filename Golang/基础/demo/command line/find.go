@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// criteria a file must meet to be reported by find
+type findOptions struct {
+	Name      string
+	Regex     *regexp.Regexp
+	MinSize   int64
+	MaxSize   int64
+	NewerThan time.Time
+	OlderThan time.Time
+	Type      string
+	Filter    *treeFilter
+}
+
+// report whether an entry meets every criterion
+func (o findOptions) match(path string, info fs.FileInfo) bool {
+	switch o.Type {
+	case "f":
+		if !info.Mode().IsRegular() {
+			return false
+		}
+	case "d":
+		if !info.IsDir() {
+			return false
+		}
+	}
+	if o.Name != "" {
+		if ok, _ := filepath.Match(o.Name, info.Name()); !ok {
+			return false
+		}
+	}
+	if o.Regex != nil && !o.Regex.MatchString(path) {
+		return false
+	}
+	if o.MinSize > 0 && info.Size() < o.MinSize {
+		return false
+	}
+	if o.MaxSize > 0 && info.Size() > o.MaxSize {
+		return false
+	}
+	if !o.NewerThan.IsZero() && !info.ModTime().After(o.NewerThan) {
+		return false
+	}
+	if !o.OlderThan.IsZero() && !info.ModTime().Before(o.OlderThan) {
+		return false
+	}
+	return true
+}
+
+// walk root and collect every entry that matches
+func findFiles(root string, o findOptions) ([]fileEntry, error) {
+	var found []fileEntry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if o.Filter.excluded(root, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if o.match(path, info) {
+			found = append(found, newFileEntry(path, path, info))
+		}
+		return nil
+	})
+	return found, err
+}
+
+// search directory trees by name, size, age and type
+func runFind(args []string) error {
+	flags := newFlagSet("find")
+	var o findOptions
+	flags.StringVar(&o.Name, "name", "", "Glob pattern the file name must match, e.g. *.log")
+	regex := flags.String("regex", "", "Regular expression the path must match")
+	minSize := flags.String("min-size", "", "Minimum size, e.g. 10K or 1M")
+	maxSize := flags.String("max-size", "", "Maximum size, e.g. 500M")
+	newer := flags.String("newer-than", "", "Only files modified after this age or time, e.g. 7d or 2024-01-02")
+	older := flags.String("older-than", "", "Only files modified before this age or time, e.g. 30d")
+	flags.StringVar(&o.Type, "type", "", "Only files (f) or directories (d)")
+	o.Filter = addTreeFilterFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	var err error
+	if o.Name != "" {
+		if _, err := filepath.Match(o.Name, ""); err != nil {
+			return usageError("finding files", fmt.Errorf("bad -name pattern: %w", err))
+		}
+	}
+	if *regex != "" {
+		if o.Regex, err = regexp.Compile(*regex); err != nil {
+			return usageError("finding files", err)
+		}
+	}
+	if *minSize != "" {
+		if o.MinSize, err = parseSize(*minSize); err != nil {
+			return usageError("finding files", err)
+		}
+	}
+	if *maxSize != "" {
+		if o.MaxSize, err = parseSize(*maxSize); err != nil {
+			return usageError("finding files", err)
+		}
+	}
+	now := time.Now()
+	if *newer != "" {
+		if o.NewerThan, err = parseTimeSpec(*newer, now); err != nil {
+			return usageError("finding files", err)
+		}
+	}
+	if *older != "" {
+		if o.OlderThan, err = parseTimeSpec(*older, now); err != nil {
+			return usageError("finding files", err)
+		}
+	}
+	if o.Type != "" && o.Type != "f" && o.Type != "d" {
+		return usageError("finding files", fmt.Errorf("-type must be f or d"))
+	}
+
+	if err := confine(flags.Args()...); err != nil {
+		return fail("finding files", err)
+	}
+	var results []fileEntry
+	for _, root := range flags.Args() {
+		found, err := findFiles(root, o)
+		if err != nil {
+			return fail("finding files", err)
+		}
+		if opts.JSON {
+			results = append(results, found...)
+			continue
+		}
+		for _, file := range found {
+			if formatting() {
+				if err := printFormatted(file); err != nil {
+					return fail("formatting output", err)
+				}
+				continue
+			}
+			fmt.Println(file.Name)
+		}
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	return nil
+}
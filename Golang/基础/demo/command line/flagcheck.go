@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+// the flags given on the command line; a boolean flag set to false does not count
+func flagsGiven(flags *flag.FlagSet) map[string]bool {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && f.Value.String() == "false" {
+			return
+		}
+		given[f.Name] = true
+	})
+	return given
+}
+
+// reject giving more than one of the named flags, which pick different
+// behaviours of a command, instead of letting one win silently
+func exclusiveFlags(flags *flag.FlagSet, names ...string) error {
+	given := flagsGiven(flags)
+	var both []string
+	for _, name := range names {
+		if given[name] {
+			both = append(both, "-"+name)
+		}
+	}
+	if len(both) > 1 {
+		return errors.New(tr("%s cannot be combined (see \"fileutil help %s\")", joinWords(both, tr("and")), flags.Name()))
+	}
+	return nil
+}
+
+// reject a flag given without any of the flags it only has an effect with
+func requireFlags(flags *flag.FlagSet, name string, needs ...string) error {
+	given := flagsGiven(flags)
+	if !given[name] {
+		return nil
+	}
+	for _, need := range needs {
+		if given[need] {
+			return nil
+		}
+	}
+	var names []string
+	for _, need := range needs {
+		names = append(names, "-"+need)
+	}
+	return errors.New(tr("-%s only applies with %s (see \"fileutil help %s\")", name, joinWords(names, tr("or")), flags.Name()))
+}
+
+// apply the rules for the flags several commands share: the backup,
+// overwrite and symlink flags. Rules for flags the set does not define pass
+func checkSharedFlags(flags *flag.FlagSet) error {
+	for _, pair := range [][2]string{
+		{"no-clobber", "update"},
+		{"no-clobber", "interactive"},
+		{"no-clobber", "backup"},
+		{"follow", "no-follow"},
+	} {
+		if err := exclusiveFlags(flags, pair[0], pair[1]); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"backup-dir", "backup-suffix"} {
+		if err := requireFlags(flags, name, "backup"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// join words as in "a, b and c"
+func joinWords(words []string, conjunction string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " " + conjunction + " " + words[len(words)-1]
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// interval between checks for new data in follow mode
+const followInterval = 500 * time.Millisecond
+
+// number of lines shown before following when -tail is not given
+const defaultFollowLines = 10
+
+// print the last lines of a file, then keep streaming lines as they are appended;
+// a truncated file is read again from the start and a rotated file is reopened
+func followFile(w io.Writer, path string, tail int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	if tail > 0 {
+		err = copyTail(w, file, tail)
+	} else {
+		_, err = file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		return err
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, streamBufferSize)
+	for {
+		n, err := io.CopyBuffer(w, file, buf)
+		if err != nil {
+			return err
+		}
+		offset += n
+		time.Sleep(followInterval)
+
+		openInfo, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		// the path now names a different file: finish the old one and switch over
+		if pathInfo, err := os.Stat(path); err == nil && !os.SameFile(openInfo, pathInfo) {
+			if _, err := io.CopyBuffer(w, file, buf); err != nil {
+				return err
+			}
+			next, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			file.Close()
+			file, offset = next, 0
+			continue
+		}
+
+		if openInfo.Size() < offset {
+			if offset, err = file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// expand glob patterns into the paths they match; plain paths are passed through
+func expandPaths(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if !hasGlobMeta(pattern) {
+			paths = append(paths, pattern)
+			continue
+		}
+
+		var matches []string
+		var err error
+		if strings.Contains(pattern, "**") {
+			matches, err = globRecursive(pattern)
+		} else {
+			matches, err = filepath.Glob(pattern)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	if err := confine(paths...); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// report whether a path contains glob metacharacters
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expand a pattern containing ** by walking from its literal prefix
+func globRecursive(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	segments := strings.Split(pattern, "/")
+
+	// walk from the longest prefix that has no wildcards
+	var rootSegments []string
+	for _, segment := range segments {
+		if hasGlobMeta(segment) {
+			break
+		}
+		rootSegments = append(rootSegments, segment)
+	}
+	root := strings.Join(rootSegments, "/")
+	if root == "" {
+		root = "."
+		if strings.HasPrefix(pattern, "/") {
+			root = "/"
+		}
+	}
+	rest := segments[len(rootSegments):]
+
+	var matches []string
+	err := filepath.WalkDir(filepath.FromSlash(root), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(root), path)
+		if err != nil || rel == "." {
+			return err
+		}
+		ok, err := matchSegments(rest, strings.Split(filepath.ToSlash(rel), "/"))
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// match path segments against pattern segments where ** spans any number of directories
+func matchSegments(pattern []string, path []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				ok, err := matchSegments(pattern[1:], path[i:])
+				if ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(path) == 0 {
+			return false, nil
+		}
+		ok, err := filepath.Match(pattern[0], path[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0, nil
+}
+
+// repeatable flag holding glob patterns such as -include and -exclude
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %w", pattern, err)
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+// report whether a slash-separated relative path matches a pattern; patterns
+// without a slash match the base name, others match the whole path and may use **
+func matchPattern(pattern string, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, path.Base(rel))
+		return ok
+	}
+	ok, _ := matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+	return ok
+}
+
+// report whether a path matches any of the patterns
+func (p patternList) matches(rel string) bool {
+	for _, pattern := range p {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// report whether a file passes the include and exclude patterns; directories
+// are only checked against exclude so their contents can still be included
+func selected(rel string, isDir bool, include patternList, exclude patternList) bool {
+	if exclude.matches(rel) {
+		return false
+	}
+	return isDir || len(include) == 0 || include.matches(rel)
+}
@@ -1,3 +1,24 @@
 module cmdline
 
 go 1.23.2
+
+require (
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/klauspost/compress v1.17.11
+	github.com/mattn/go-runewidth v0.0.16
+	github.com/peterh/liner v1.2.2
+	github.com/pkg/xattr v0.4.12
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/crypto v0.36.0
+	golang.org/x/sys v0.31.0
+	golang.org/x/term v0.30.0
+	golang.org/x/text v0.23.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/gdamore/encoding v1.0.1 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/rivo/uniseg v0.4.3 // indirect
+)
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// one matching line found by grep
+type grepMatch struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// how grep prints what it finds
+type grepOptions struct {
+	LineNumbers bool
+	Context     int
+	ShowPath    bool
+	Filter      *treeFilter // which files a recursive search leaves out
+	Binary      bool        // search binary files too
+}
+
+// a line kept for printing as context before a match
+type grepLine struct {
+	number int
+	text   string
+}
+
+// scan r line by line, calling emit for every matching line and printing
+// matches with surrounding context to w when w is not nil
+func grepReader(r io.Reader, path string, re *regexp.Regexp, o grepOptions, w io.Writer, emit func(grepMatch)) error {
+	reader := bufio.NewReaderSize(r, streamBufferSize)
+	var before []grepLine
+	after, lastPrinted := 0, 0
+
+	printLine := func(number int, text string, sep string) {
+		if w == nil {
+			return
+		}
+		if o.Context > 0 && lastPrinted > 0 && number > lastPrinted+1 {
+			fmt.Fprintln(w, "--")
+		}
+		prefix := ""
+		if o.ShowPath {
+			prefix = path + sep
+		}
+		if o.LineNumbers {
+			prefix += fmt.Sprintf("%d%s", number, sep)
+		}
+		fmt.Fprintln(w, prefix+text)
+		lastPrinted = number
+	}
+
+	for number := 1; ; number++ {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		text := strings.TrimRight(line, "\r\n")
+
+		if re.MatchString(text) {
+			for _, prev := range before {
+				printLine(prev.number, prev.text, "-")
+			}
+			before = before[:0]
+			printLine(number, text, ":")
+			emit(grepMatch{Path: path, Line: number, Text: text})
+			after = o.Context
+		} else if after > 0 {
+			printLine(number, text, "-")
+			after--
+		} else if o.Context > 0 {
+			before = append(before, grepLine{number, text})
+			if len(before) > o.Context {
+				before = before[1:]
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// search a file, or every file under a directory when recursive
+func grepPath(path string, re *regexp.Regexp, recursive bool, o grepOptions, w io.Writer, emit func(grepMatch)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return grepFile(path, re, o, w, emit)
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (use -recursive)", path)
+	}
+	return filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if o.Filter.excluded(path, file, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return grepFile(file, re, o, w, emit)
+	})
+}
+
+// search one file, unless it is binary and o.Binary is not set
+func grepFile(path string, re *regexp.Regexp, o grepOptions, w io.Writer, emit func(grepMatch)) error {
+	if !o.Binary {
+		if binary, err := isBinaryFile(path); err != nil || binary {
+			if binary {
+				printVerbose("skipped binary file %s\n", path)
+			}
+			return err
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return grepReader(file, path, re, o, w, emit)
+}
+
+// search file contents for a regular expression
+func runGrep(args []string) error {
+	flags := newFlagSet("grep")
+	ignoreCase := flags.Bool("i", false, "Match case-insensitively")
+	recursive := flags.Bool("recursive", false, "Search directories recursively")
+	var o grepOptions
+	flags.BoolVar(&o.LineNumbers, "n", false, "Show line numbers")
+	flags.IntVar(&o.Context, "context", 0, "Show N lines of context around each match")
+	o.Filter = addTreeFilterFlags(flags)
+	flags.BoolVar(&o.Binary, "binary", false, "Search binary files too instead of skipping them")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	pattern := flags.Arg(0)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return usageError("searching files", err)
+	}
+	paths, err := expandPaths(flags.Args()[1:])
+	if err != nil {
+		return fail("searching files", err)
+	}
+	o.ShowPath = len(paths) > 1 || *recursive
+
+	var w io.Writer = os.Stdout
+	if opts.JSON {
+		w = nil
+	}
+	var matches []grepMatch
+	collect := func(m grepMatch) {
+		if opts.JSON {
+			matches = append(matches, m)
+		}
+	}
+	for _, path := range paths {
+		if err := grepPath(path, re, *recursive, o, w, collect); err != nil {
+			return fail("searching files", err)
+		}
+	}
+	if opts.JSON {
+		printJSON(matches)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// default algorithm used by hash and the commands built on it
+const defaultHashAlgo = "sha256"
+
+// supported digest algorithms and their constructors
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// create a hasher for the named algorithm
+func newHasher(algo string) (hash.Hash, error) {
+	newHash, ok := hashAlgorithms[strings.ToLower(algo)]
+	if !ok {
+		return nil, errors.New(tr("unsupported hash algorithm %q (use md5, sha1, sha256 or sha512)", algo))
+	}
+	return newHash(), nil
+}
+
+// compute the hex digest of a file
+func hashFile(path string, algo string) (string, error) {
+	return hashFileProgress(path, algo, nil)
+}
+
+// hash a file, counting the bytes read towards p
+func hashFileProgress(path string, algo string, p *progress) (string, error) {
+	hasher, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(hasher, p.reader(interruptible(cmdCtx, file))); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// compare the digests of a copied file or tree against its source,
+// leaving out what filter kept from being copied
+func verifyCopy(src string, dest string, filter *treeFilter) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return compareFiles(src, dest)
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filter.excluded(src, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		return compareFiles(path, filepath.Join(dest, rel))
+	})
+}
+
+// return an error when two files do not have the same digest
+func compareFiles(src string, dest string) error {
+	srcSum, err := hashFile(src, defaultHashAlgo)
+	if err != nil {
+		return err
+	}
+	destSum, err := hashFile(dest, defaultHashAlgo)
+	if err != nil {
+		return err
+	}
+	if srcSum != destSum {
+		return fmt.Errorf("checksum mismatch: %s (%s) != %s (%s)", src, srcSum, dest, destSum)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bytes shown on each line of a hex dump, as xxd does
+const hexDumpWidth = 16
+
+// a byte range of a file for read -offset and -length; a negative offset
+// counts back from the end and a length of 0 means up to the end
+type byteRange struct {
+	Offset int64
+	Length int64
+}
+
+// report whether r asks for less than the whole file
+func (r byteRange) partial() bool {
+	return r.Offset != 0 || r.Length > 0
+}
+
+// parse a byte count such as 512, 4K or, as hex dumps show offsets, 0x1f0
+func parseByteCount(text string) (int64, error) {
+	if hex, ok := strings.CutPrefix(strings.ToLower(text), "0x"); ok {
+		n, err := strconv.ParseInt(hex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hex number %q", text)
+		}
+		return n, nil
+	}
+	return parseSize(text)
+}
+
+// add the -offset and -length flags to flags, the latter with the given usage
+func addByteRangeFlags(flags *flag.FlagSet, lengthUsage string) *byteRange {
+	r := &byteRange{}
+	flags.Func("offset", "Start at this byte, e.g. 4K or 0x1f0, or this many bytes before the end when negative", func(text string) error {
+		size, err := parseByteCount(strings.TrimPrefix(text, "-"))
+		if strings.HasPrefix(text, "-") {
+			size = -size
+		}
+		r.Offset = size
+		return err
+	})
+	flags.Func("length", lengthUsage, func(text string) error {
+		size, err := parseByteCount(text)
+		if err == nil && size <= 0 {
+			err = fmt.Errorf("length must be above 0")
+		}
+		r.Length = size
+		return err
+	})
+	return r
+}
+
+// open the file at path and position it at the start of r, returning a
+// reader limited to r and the offset it starts at
+func openRange(path string, r byteRange) (io.ReadCloser, int64, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	whence := io.SeekStart
+	if r.Offset < 0 {
+		whence = io.SeekEnd
+	}
+	start, err := file.Seek(r.Offset, whence)
+	if err != nil {
+		// past the start of a file shorter than -offset asks for
+		if r.Offset >= 0 {
+			file.Close()
+			return nil, 0, err
+		}
+		if start, err = file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+	}
+	var reader io.Reader = file
+	if r.Length > 0 {
+		reader = io.LimitReader(file, r.Length)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, start, nil
+}
+
+// copy a byte range of a file to w without loading the rest of it
+func streamRange(w io.Writer, path string, r byteRange) error {
+	reader, _, err := openRange(path, r)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.CopyBuffer(w, reader, make([]byte, streamBufferSize))
+	return err
+}
+
+// write a byte range of a file to w as a hex dump
+func dumpRange(w io.Writer, path string, r byteRange) error {
+	reader, start, err := openRange(path, r)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return hexDump(w, reader, start)
+}
+
+// write r to w in the format of xxd: the offset of each line, starting at
+// offset, its bytes in hex in pairs, and the bytes again with anything
+// not printable ASCII shown as a dot
+func hexDump(w io.Writer, r io.Reader, offset int64) error {
+	out := bufio.NewWriterSize(w, streamBufferSize)
+	reader := bufio.NewReaderSize(r, streamBufferSize)
+	buf := make([]byte, hexDumpWidth)
+	var line strings.Builder
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			line.Reset()
+			fmt.Fprintf(&line, "%08x: ", offset)
+			for i := 0; i < hexDumpWidth; i++ {
+				if i < n {
+					fmt.Fprintf(&line, "%02x", buf[i])
+				} else {
+					line.WriteString("  ")
+				}
+				if i%2 == 1 {
+					line.WriteByte(' ')
+				}
+			}
+			line.WriteByte(' ')
+			for _, b := range buf[:n] {
+				if b < 0x20 || b > 0x7e {
+					b = '.'
+				}
+				line.WriteByte(b)
+			}
+			line.WriteByte('\n')
+			if _, err := out.WriteString(line.String()); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return out.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// print a byte range of a file for read, as a hex dump when hex is set; in
+// JSON mode it is returned instead. A binary file is skipped unless it is
+// dumped in hex or binary is set.
+func readRange(path string, r byteRange, hex bool, binary bool, header bool) (*fileContent, error) {
+	if !hex && !binary {
+		if isBinary, err := isBinaryFile(path); err != nil {
+			return nil, err
+		} else if isBinary {
+			if !opts.JSON {
+				printInfo("Skipped binary file %s (use -binary)\n", path)
+			}
+			return nil, nil
+		}
+	}
+	write := streamRange
+	if hex {
+		write = dumpRange
+	}
+	if opts.JSON {
+		var b strings.Builder
+		if err := write(&b, path, r); err != nil {
+			return nil, err
+		}
+		return &fileContent{Path: path, Content: b.String()}, nil
+	}
+	if header {
+		fmt.Printf("==> %s <==\n", path)
+	}
+	return nil, write(os.Stdout, path, r)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// report whether a file is hidden, which outside Windows means a dotfile
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
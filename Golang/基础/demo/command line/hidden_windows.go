@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// report whether a file is hidden: a dotfile, or marked hidden or system in its attributes
+func isHidden(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return true
+	}
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	attrs, err := syscall.GetFileAttributes(name)
+	if err != nil {
+		return false
+	}
+	return attrs&(syscall.FILE_ATTRIBUTE_HIDDEN|syscall.FILE_ATTRIBUTE_SYSTEM) != 0
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// message catalogs, one JSON object per language mapping an English message,
+// often a fmt format, to its translation, and the prose of the help text
+//
+//go:embed locales
+var locales embed.FS
+
+// the language messages are written in when no catalog applies
+const sourceLanguage = "en"
+
+// language of messages, set with -lang; when empty it is taken from the environment
+type language string
+
+func (l *language) String() string {
+	return string(*l)
+}
+
+func (l *language) Set(s string) error {
+	if s != sourceLanguage && !hasCatalog(s) {
+		return fmt.Errorf("must be one of %s", strings.Join(languages(), ", "))
+	}
+	*l = language(s)
+	return nil
+}
+
+// the languages messages can be shown in
+func languages() []string {
+	langs := []string{sourceLanguage}
+	entries, _ := locales.ReadDir("locales")
+	for _, entry := range entries {
+		if lang, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+func hasCatalog(lang string) bool {
+	_, err := locales.Open(path.Join("locales", lang+".json"))
+	return err == nil
+}
+
+// the language in effect: -lang, or else the first of LC_ALL, LC_MESSAGES
+// and LANG that is set, such as zh_CN.UTF-8; anything without a catalog is English
+func activeLanguage() string {
+	if opts.Lang != "" {
+		return string(opts.Lang)
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		lang, _, _ := strings.Cut(value, "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		if hasCatalog(lang) {
+			return lang
+		}
+		return sourceLanguage
+	}
+	return sourceLanguage
+}
+
+var (
+	catalogMu sync.Mutex
+	catalogs  = map[string]map[string]string{}
+)
+
+// the catalog of a language, read from the embedded files the first time it is needed
+func catalog(lang string) map[string]string {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	if messages, ok := catalogs[lang]; ok {
+		return messages
+	}
+	var messages map[string]string
+	if data, err := locales.ReadFile(path.Join("locales", lang+".json")); err == nil {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			// only a broken build can get here
+			panic(fmt.Sprintf("locales/%s.json: %v", lang, err))
+		}
+	}
+	catalogs[lang] = messages
+	return messages
+}
+
+// translate a message into the active language and, given args, format it
+// like fmt.Sprintf. Messages without a translation are shown in English
+func tr(message string, args ...any) string {
+	if translated, ok := catalog(activeLanguage())[message]; ok {
+		message = translated
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// the prose of the help text in the active language
+func helpProse() string {
+	data, err := locales.ReadFile(path.Join("locales", "help."+activeLanguage()+".txt"))
+	if err != nil {
+		data, _ = locales.ReadFile(path.Join("locales", "help."+sourceLanguage+".txt"))
+	}
+	return string(data)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// a text encoding with the name it is reported by
+type textEncoding struct {
+	Name string
+	enc  encoding.Encoding
+}
+
+// UTF-8, the default target of -iconv
+var utf8Encoding = textEncoding{"utf-8", xunicode.UTF8}
+
+// look up an encoding by one of its WHATWG labels, such as gbk,
+// shift_jis, latin1 or utf-16le
+func lookupEncoding(label string) (textEncoding, error) {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return textEncoding{}, fmt.Errorf("unknown encoding %q (try utf-8, gbk, gb18030, shift_jis or latin1)", label)
+	}
+	name, _ := htmlindex.Name(enc)
+	return textEncoding{name, enc}, nil
+}
+
+// report whether data starts with a UTF-16 byte order mark; such text is
+// full of NUL bytes but not binary
+func hasUTF16BOM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF})
+}
+
+// decode data with enc, reporting whether every byte was valid in it
+func decodeClean(enc encoding.Encoding, data []byte) (string, bool) {
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", false
+	}
+	return string(text), !bytes.ContainsRune(text, utf8.RuneError)
+}
+
+// count the runes of text in the given ranges
+func countRunes(text string, tables ...*unicode.RangeTable) int {
+	n := 0
+	for _, r := range text {
+		if unicode.In(r, tables...) {
+			n++
+		}
+	}
+	return n
+}
+
+// guess the encoding of text: a byte order mark decides, valid UTF-8 is
+// taken as such, then Shift-JIS when the text decodes cleanly and has
+// kana, GBK or GB18030 when it decodes cleanly as Chinese, and Latin-1,
+// which accepts any bytes, last
+func detectEncoding(data []byte) textEncoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return textEncoding{"utf-16le", xunicode.UTF16(xunicode.LittleEndian, xunicode.ExpectBOM)}
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return textEncoding{"utf-16be", xunicode.UTF16(xunicode.BigEndian, xunicode.ExpectBOM)}
+	case utf8.Valid(data):
+		return utf8Encoding
+	}
+	// Chinese text often also decodes as Shift-JIS, but then mostly as
+	// kanji and half-width katakana; real Japanese has hiragana
+	if text, ok := decodeClean(japanese.ShiftJIS, data); ok && countRunes(text, unicode.Hiragana) > 0 {
+		return textEncoding{"shift_jis", japanese.ShiftJIS}
+	}
+	if _, ok := decodeClean(simplifiedchinese.GBK, data); ok {
+		return textEncoding{"gbk", simplifiedchinese.GBK}
+	}
+	if _, ok := decodeClean(simplifiedchinese.GB18030, data); ok {
+		return textEncoding{"gb18030", simplifiedchinese.GB18030}
+	}
+	return textEncoding{"windows-1252", charmap.Windows1252}
+}
+
+// turn data in from into UTF-8; the byte order mark of UTF-16 is dropped,
+// since it belongs to that encoding
+func decodeText(data []byte, from textEncoding) ([]byte, error) {
+	if from.Name == utf8Encoding.Name {
+		return data, nil
+	}
+	text, err := from.enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(text, utf8BOM), nil
+}
+
+// turn UTF-8 text into to, failing on characters it cannot represent
+func encodeText(text []byte, to textEncoding) ([]byte, error) {
+	if to.Name == utf8Encoding.Name {
+		return text, nil
+	}
+	return to.enc.NewEncoder().Bytes(text)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// name of the ignore files honoured by recursive operations; they use
+// .gitignore syntax and apply to the directory they are in and below it
+const ignoreFileName = ".fileutilignore"
+
+// one pattern line of an ignore file
+type ignoreRule struct {
+	pattern  string // slash-separated, without a leading or trailing slash
+	negate   bool   // the line started with !, so a match is included again
+	dirOnly  bool   // the line ended with /, so only directories match
+	anchored bool   // the pattern has a slash, so it is matched from the file's directory
+}
+
+// parse the lines of an ignore file; blank lines, comments and bad patterns are skipped
+func parseIgnoreFile(data string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		var rule ignoreRule
+		switch {
+		case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+			line = line[1:]
+		case line == "", line[0] == '#':
+			continue
+		case line[0] == '!':
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimRight(line, " ")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern == "" {
+			continue
+		}
+		if _, err := path.Match(rule.pattern, ""); err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// report whether a rule matches rel, a slash-separated path relative to
+// the directory of its ignore file
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		ok, _ := matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+		return ok
+	}
+	ok, _ := path.Match(r.pattern, path.Base(rel))
+	return ok
+}
+
+// decides which paths under a root a recursive operation leaves out: those
+// not matching -include, those matching -exclude or the config file's
+// ignore list, and those the ignore files in the tree rule out. A nil
+// filter leaves out nothing
+type treeFilter struct {
+	Include  patternList
+	Exclude  patternList
+	NoIgnore bool
+
+	rules map[string][]ignoreRule // by directory, read the first time it is needed
+}
+
+// register -include, -exclude and -no-ignore; -exclude starts out with the
+// config file's ignore patterns
+func addTreeFilterFlags(flags *flag.FlagSet) *treeFilter {
+	f := &treeFilter{Exclude: append(patternList(nil), cfg.Ignore...)}
+	flags.Var(&f.Include, "include", "Only take files matching this pattern (repeatable)")
+	flags.Var(&f.Exclude, "exclude", "Leave out files and directories matching this pattern (repeatable)")
+	flags.BoolVar(&f.NoIgnore, "no-ignore", false, "Do not read "+ignoreFileName+" files")
+	return f
+}
+
+// report whether path, found while walking root, is left out; root itself never is
+func (f *treeFilter) excluded(root string, path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !selected(rel, isDir, f.Include, f.Exclude) {
+		return true
+	}
+	return !f.NoIgnore && f.ignored(root, rel, isDir)
+}
+
+// apply the ignore files of root and every directory between it and rel;
+// as in git, deeper files and later lines take precedence
+func (f *treeFilter) ignored(root string, rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	ignored := false
+	for i := range parts {
+		dir := filepath.Join(root, filepath.FromSlash(strings.Join(parts[:i], "/")))
+		sub := strings.Join(parts[i:], "/")
+		for _, rule := range f.rulesIn(dir) {
+			if rule.matches(sub, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// the rules of the ignore file in dir, if it has one
+func (f *treeFilter) rulesIn(dir string) []ignoreRule {
+	if rules, ok := f.rules[dir]; ok {
+		return rules
+	}
+	if f.rules == nil {
+		f.rules = map[string][]ignoreRule{}
+	}
+	var rules []ignoreRule
+	data, err := os.ReadFile(filepath.Join(dir, ignoreFileName))
+	switch {
+	case err == nil:
+		rules = parseIgnoreFile(string(data))
+	case !errors.Is(err, fs.ErrNotExist):
+		logger().Warn("ignore file skipped", "dir", dir, "error", err)
+	}
+	f.rules[dir] = rules
+	return rules
+}
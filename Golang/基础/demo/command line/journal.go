@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// one mutating operation, with what is needed to reverse it
+type journalEntry struct {
+	ID      string     `json:"id"`
+	Op      string     `json:"op"`
+	Path    string     `json:"path"`
+	Dest    string     `json:"dest,omitempty"`
+	Existed bool       `json:"existed,omitempty"`
+	Saved   string     `json:"saved,omitempty"`
+	Size    int64      `json:"size,omitempty"`
+	Offset  int64      `json:"offset,omitempty"`
+	Undoes  string     `json:"undoes,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Time    time.Time  `json:"time"`
+	// a copy into an existing directory saves only the files it replaces,
+	// under their paths relative to Dest, and lists the ones it creates
+	Partial  bool     `json:"partial,omitempty"`
+	Created  []string `json:"created,omitempty"`
+	Replaced []string `json:"replaced,omitempty"`
+
+	created map[string]bool
+}
+
+// a batch transaction in progress: the operations it journaled, which are
+// the only ones its rollback may undo, since other fileutil processes can
+// write to the journal at the same time
+type batchTransaction struct {
+	ids []string
+}
+
+// set while batch -transaction runs its steps
+var activeTransaction *batchTransaction
+
+// how often operations older than journal_keep are pruned
+const journalPruneInterval = 24 * time.Hour
+
+// directory holding the journal file and the saved copies it refers to
+func journalDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "journal"), nil
+}
+
+// start recording an operation; whatever it is about to overwrite is saved
+// first. A nil entry is returned when journaling is disabled.
+func journalPrepare(op string, path string, dest string) (*journalEntry, error) {
+	if opts.DryRun {
+		return nil, nil
+	}
+	// the audit log is kept even when the journal is turned off
+	if err := auditJournaled(op, path, dest); err != nil {
+		return nil, fmt.Errorf("writing audit log: %w", err)
+	}
+	if opts.NoJournal {
+		return nil, nil
+	}
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	autoPruneJournal(dir)
+
+	now := time.Now()
+	entry := &journalEntry{ID: fmt.Sprintf("%d", now.UnixNano()), Op: op, Time: now}
+	if op == "write" {
+		// an atomic write replaces what a symlink points to, so that is
+		// what undo must put back
+		if path, err = fileops.FollowLinks(fsys, path); err != nil {
+			return nil, err
+		}
+	}
+	if entry.Path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+	if op == "copy" {
+		// so does a copy over one
+		if dest, err = fileops.FollowLinks(fsys, dest); err != nil {
+			return nil, err
+		}
+	}
+	if dest != "" {
+		if entry.Dest, err = filepath.Abs(dest); err != nil {
+			return nil, err
+		}
+	}
+
+	// the path whose previous state must be kept
+	target := entry.Path
+	if op == "copy" || op == "rename" {
+		target = entry.Dest
+	}
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return entry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Existed = true
+	entry.Saved = filepath.Join(dir, "store", entry.ID)
+
+	switch op {
+	case "trash":
+		// the trash keeps the data itself
+		entry.Saved = ""
+	case "append", "patch":
+		// a patch saves the bytes it overwrites itself
+		entry.Size = info.Size()
+		entry.Saved = ""
+	case "delete":
+		// the data is going away anyway, so move it into the store instead
+		// of copying; the limit still applies, as a delete that keeps it
+		// all would free no space until the journal is pruned
+		if ok, err := journalCanCopy(target); !ok {
+			return nil, err
+		}
+		if err := checkHostMove(target); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.Saved), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(target, entry.Saved); err == nil {
+			break
+		}
+		// on another file system it has to be copied after all
+		if err := moveFileOn(fileops.OS, target, entry.Saved); err != nil {
+			return nil, err
+		}
+	default:
+		if src, err := os.Stat(entry.Path); op == "copy" && info.IsDir() && err == nil && src.IsDir() {
+			// the copy is merged into the directory: the files it replaces
+			// are saved one by one, by saveBefore, as it goes
+			entry.Partial = true
+			break
+		}
+		if ok, err := journalCanCopy(target); !ok {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.Saved), 0700); err != nil {
+			return nil, err
+		}
+		c := treeCopier{Host: true}
+		if err := c.copy(target, entry.Saved); err != nil {
+			os.RemoveAll(entry.Saved)
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// report whether path is small enough to keep in the journal store under
+// journal_max_copy; a larger one is left out of the journal, with a
+// warning, rather than filling the home directory. A transaction could not
+// roll such an operation back, so there it is an error instead
+func journalCanCopy(path string) (bool, error) {
+	if cfg.journalMaxCopy <= 0 {
+		return true, nil
+	}
+	size, err := treeSize(path)
+	if err != nil || size <= cfg.journalMaxCopy {
+		return true, nil
+	}
+	if activeTransaction != nil {
+		return false, fmt.Errorf("%s holds %s, more than journal_max_copy (%s), so the transaction could not roll it back",
+			path, humanSize(size), humanSize(cfg.journalMaxCopy))
+	}
+	logger().Warn("not journaled, so it cannot be undone: more than journal_max_copy would be saved",
+		"path", path, "size", humanSize(size), "journal_max_copy", humanSize(cfg.journalMaxCopy))
+	return false, nil
+}
+
+// save what a copy into an existing directory is about to replace at path,
+// or note that it creates path, so undo reverses just that
+func (e *journalEntry) saveBefore(path string) error {
+	if e == nil || !e.Partial {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(e.Dest, abs)
+	if err != nil {
+		return err
+	}
+	// what lands in a directory the copy created goes with it
+	for parent := filepath.Dir(rel); parent != "."; parent = filepath.Dir(parent) {
+		if e.created[parent] {
+			return nil
+		}
+	}
+	info, err := os.Lstat(abs)
+	if os.IsNotExist(err) {
+		if e.created == nil {
+			e.created = map[string]bool{}
+		}
+		e.created[rel] = true
+		e.Created = append(e.Created, rel)
+		return nil
+	}
+	if err != nil || info.IsDir() {
+		// an existing directory is merged into, not replaced
+		return err
+	}
+	saved := filepath.Join(e.Saved, rel)
+	if err := os.MkdirAll(filepath.Dir(saved), 0700); err != nil {
+		return err
+	}
+	c := treeCopier{Host: true}
+	if err := c.copy(abs, saved); err != nil {
+		return err
+	}
+	e.Replaced = append(e.Replaced, rel)
+	return nil
+}
+
+// delete a path by moving it into the journal store, so the delete can be undone
+func deleteJournaled(path string, recursive bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && !recursive {
+		// without -recursive only empty directories may go; let os.Remove report the error
+		if entries, err := os.ReadDir(path); err != nil || len(entries) > 0 {
+			return fileops.Delete(cmdCtx, fsys, path, fileops.DeleteOptions{})
+		}
+	}
+
+	entry, err := journalPrepare("delete", path, "")
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fileops.Delete(cmdCtx, fsys, path, fileops.DeleteOptions{Recursive: recursive})
+	}
+	return journalFinish(entry, nil)
+}
+
+// append the entry to the journal once the operation succeeded, or drop
+// the saved copy when it failed. An interrupted or timed out operation is still recorded,
+// so undo can put back whatever it had already changed
+func journalFinish(entry *journalEntry, opErr error) error {
+	if entry == nil {
+		return opErr
+	}
+	if isCanceled(opErr) {
+		if err := appendJournal(*entry); err != nil {
+			return errors.Join(opErr, err)
+		}
+		return opErr
+	}
+	if opErr != nil {
+		if entry.Saved != "" {
+			os.RemoveAll(entry.Saved)
+		}
+		return opErr
+	}
+	logger().Debug("journaled operation", "id", entry.ID, "op", entry.Op, "path", entry.Path, "dest", entry.Dest)
+	return appendJournal(*entry)
+}
+
+// append a record to the journal file
+func appendJournal(entry journalEntry) error {
+	dir, err := journalDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "journal.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	record, err := json.Marshal(entry)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(append(record, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if activeTransaction != nil {
+		activeTransaction.ids = append(activeTransaction.ids, entry.ID)
+	}
+	return file.Close()
+}
+
+// read every journal record, oldest first
+func readJournal() ([]journalEntry, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(dir, "journal.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("bad journal record: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// operations that can still be undone, newest first
+func undoableEntries() ([]journalEntry, error) {
+	entries, err := readJournal()
+	if err != nil {
+		return nil, err
+	}
+	undone := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Op == "undo" {
+			undone[entry.Undoes] = true
+		}
+	}
+
+	var pending []journalEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Op != "undo" && !undone[entries[i].ID] {
+			pending = append(pending, entries[i])
+		}
+	}
+	return pending, nil
+}
+
+// reverse a journaled operation and record that it was undone
+func undoEntry(entry journalEntry) error {
+	var err error
+	switch entry.Op {
+	case "write", "symlink", "hardlink":
+		err = restoreSaved(entry, entry.Path)
+	case "copy":
+		if entry.Partial {
+			err = undoPartialCopy(entry)
+		} else {
+			err = restoreSaved(entry, entry.Dest)
+		}
+	case "append":
+		err = fsys.Truncate(entry.Path, entry.Size)
+	case "patch":
+		err = undoPatch(entry)
+	case "delete":
+		if exists(entry.Path) {
+			return fmt.Errorf("%s already exists", entry.Path)
+		}
+		if err = checkHostMove(entry.Path); err == nil {
+			err = moveFileOn(fileops.OS, entry.Saved, entry.Path)
+		}
+	case "rename":
+		if exists(entry.Path) {
+			return fmt.Errorf("%s already exists", entry.Path)
+		}
+		if err = moveFile(entry.Dest, entry.Path); err == nil && entry.Saved != "" {
+			err = moveFileOn(fileops.OS, entry.Saved, entry.Dest)
+		}
+	case "mkdir":
+		err = removeEmptyDirs(entry.Path)
+	case "mktemp":
+		err = fsys.RemoveAll(entry.Path)
+	case "trash":
+		var trashed trashEntry
+		if trashed, err = findTrashEntry(entry.Dest); err == nil {
+			err = restoreFromTrash(trashed)
+		}
+	default:
+		return fmt.Errorf("cannot undo %q operations", entry.Op)
+	}
+	if err != nil {
+		return err
+	}
+	return appendUndone(entry)
+}
+
+// record that an operation was undone, so it is no longer offered
+func appendUndone(entry journalEntry) error {
+	return appendJournal(journalEntry{
+		ID:     fmt.Sprintf("%d", time.Now().UnixNano()),
+		Op:     "undo",
+		Path:   entry.Path,
+		Undoes: entry.ID,
+		Time:   time.Now(),
+	})
+}
+
+// record that trashed entries left the trash through restore or
+// empty-trash, so undo no longer tries to restore them
+func journalTrashGone(ids ...string) error {
+	gone := map[string]bool{}
+	for _, id := range ids {
+		gone[id] = true
+	}
+	pending, err := undoableEntries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range pending {
+		if entry.Op == "trash" && gone[entry.Dest] {
+			if err := appendUndone(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove a directory tree that holds nothing but directories
+func removeEmptyDirs(path string) error {
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			return fmt.Errorf("%s is not empty", path)
+		}
+		if err := removeEmptyDirs(filepath.Join(path, e.Name())); err != nil {
+			return err
+		}
+	}
+	return fsys.Remove(path)
+}
+
+// put back the saved previous state of target, or remove target if it did not exist
+func restoreSaved(entry journalEntry, target string) error {
+	if err := fsys.RemoveAll(target); err != nil {
+		return err
+	}
+	if !entry.Existed {
+		return nil
+	}
+	if err := checkHostMove(target); err != nil {
+		return err
+	}
+	return moveFileOn(fileops.OS, entry.Saved, target)
+}
+
+// undo a copy into an existing directory: remove what it created and put
+// back the files it replaced
+func undoPartialCopy(entry journalEntry) error {
+	for i := len(entry.Created) - 1; i >= 0; i-- {
+		if err := fsys.RemoveAll(filepath.Join(entry.Dest, entry.Created[i])); err != nil {
+			return err
+		}
+	}
+	for _, rel := range entry.Replaced {
+		target := filepath.Join(entry.Dest, rel)
+		if err := fsys.RemoveAll(target); err != nil {
+			return err
+		}
+		if err := checkHostMove(target); err != nil {
+			return err
+		}
+		if err := moveFileOn(fileops.OS, filepath.Join(entry.Saved, rel), target); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(entry.Saved)
+}
+
+// forget the operations journaled before a point in time and delete what
+// was saved for them, along with saved copies nothing refers to any more.
+// Temporary files still waiting for their -cleanup are kept. Returns how
+// many operations were forgotten.
+func pruneJournal(before time.Time) (int, error) {
+	entries, err := readJournal()
+	if err != nil {
+		return 0, err
+	}
+	undone := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Op == "undo" {
+			undone[entry.Undoes] = true
+		}
+	}
+	forgotten, err := rewriteJournal(entries, func(entry journalEntry) bool {
+		return entry.Time.After(before) || entry.Op == "mktemp" && !undone[entry.ID]
+	}, os.RemoveAll)
+	if err != nil {
+		return forgotten, err
+	}
+
+	// copies left behind by operations that were interrupted
+	dir, err := journalDir()
+	if err != nil {
+		return forgotten, err
+	}
+	kept, err := readJournal()
+	if err != nil {
+		return forgotten, err
+	}
+	referenced := map[string]bool{}
+	for _, entry := range kept {
+		if entry.Saved != "" {
+			referenced[filepath.Base(entry.Saved)] = true
+		}
+	}
+	stored, err := os.ReadDir(filepath.Join(dir, "store"))
+	if err != nil && !os.IsNotExist(err) {
+		return forgotten, err
+	}
+	for _, d := range stored {
+		info, err := d.Info()
+		if err != nil || referenced[d.Name()] || info.ModTime().After(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, "store", d.Name())); err != nil {
+			return forgotten, err
+		}
+	}
+	return forgotten, nil
+}
+
+// write the journal again with only the entries keep accepts, removing
+// what was saved for the others with drop first. Returns how many
+// operations, not counting undo records, were left out.
+func rewriteJournal(entries []journalEntry, keep func(journalEntry) bool, drop func(string) error) (int, error) {
+	var kept []journalEntry
+	forgotten := 0
+	for _, entry := range entries {
+		if keep(entry) {
+			kept = append(kept, entry)
+			continue
+		}
+		if entry.Saved != "" {
+			if err := drop(entry.Saved); err != nil && !os.IsNotExist(err) {
+				return forgotten, err
+			}
+		}
+		if entry.Op != "undo" {
+			forgotten++
+		}
+	}
+	if len(kept) == len(entries) {
+		return 0, nil
+	}
+
+	dir, err := journalDir()
+	if err != nil {
+		return forgotten, err
+	}
+	var data []byte
+	for _, entry := range kept {
+		record, err := json.Marshal(entry)
+		if err != nil {
+			return forgotten, err
+		}
+		data = append(append(data, record...), '\n')
+	}
+	path := filepath.Join(dir, "journal.jsonl")
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return forgotten, err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return forgotten, err
+	}
+	return forgotten, nil
+}
+
+// prune the operations older than journal_keep, at most once a day; a
+// failure is only logged, so the operation being journaled goes ahead
+func autoPruneJournal(dir string) {
+	if cfg.journalKeep == 0 {
+		return
+	}
+	stamp := filepath.Join(dir, "pruned")
+	if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < journalPruneInterval {
+		return
+	}
+	if _, err := pruneJournal(time.Now().Add(-cfg.journalKeep)); err != nil {
+		logger().Warn("pruning the journal failed", "error", err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	now := time.Now()
+	if err := os.WriteFile(stamp, nil, 0600); err == nil {
+		os.Chtimes(stamp, now, now)
+	}
+}
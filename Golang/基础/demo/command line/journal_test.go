@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a delete over journal_max_copy is not kept in the journal store, even
+// when moving it there would cost nothing, so it frees the space at once
+func TestDeleteOverJournalMaxCopy(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	savedCfg := cfg
+	t.Cleanup(func() { cfg = savedCfg })
+	cfg.journalMaxCopy = 4
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small")
+	big := filepath.Join(dir, "big")
+	if err := os.WriteFile(small, []byte("tiny"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(big, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(big, "file"), []byte("more than four bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{small, big} {
+		if err := deleteJournaled(path, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", path, err)
+		}
+	}
+	entries, err := readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != small {
+		t.Fatalf("journal = %+v, want only the delete of %s", entries, small)
+	}
+	store, err := os.ReadDir(filepath.Join(data, "fileutil", "journal", "store"))
+	if err != nil || len(store) != 1 {
+		t.Errorf("journal store holds %d entries (%v), want only the small file", len(store), err)
+	}
+}
+
+// hardlink -force over a symlink replaces the symlink, not the file it
+// points to, so undo must put the symlink back and leave that file alone
+func TestUndoHardlinkOverSymlink(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	pointed := filepath.Join(dir, "pointed")
+	link := filepath.Join(dir, "link")
+	if err := os.WriteFile(target, []byte("target"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pointed, []byte("pointed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("pointed", link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	if err := runHardlink([]string{"-force", target, link}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("journal = %+v, want one entry", entries)
+	}
+	if err := undoEntry(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if dest, err := os.Readlink(link); err != nil || dest != "pointed" {
+		t.Errorf("link = %q, %v; want a symlink to pointed", dest, err)
+	}
+	if got := readString(t, pointed); got != "pointed" {
+		t.Errorf("pointed = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// a directory entry as reported by list
+type fileEntry struct {
+	Name    string      `json:"name"`
+	Path    string      `json:"-"`
+	IsDir   bool        `json:"is_dir"`
+	IsLink  bool        `json:"is_link,omitempty"`
+	Target  string      `json:"target,omitempty"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"-"`
+	Perm    string      `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+// name of the entry, colored by kind, with a trailing / for directories
+// and @ for symlinks
+func (e fileEntry) displayName() string {
+	name := paint(os.Stdout, modeColor(e.Mode), e.Name)
+	switch {
+	case e.IsLink:
+		return name + "@"
+	case e.IsDir:
+		return name + "/"
+	}
+	return name
+}
+
+// ls -l style line: permissions, size, modification time and name
+func (e fileEntry) longFormat(human bool) string {
+	size := fmt.Sprintf("%d", e.Size)
+	if human {
+		size = humanSize(e.Size)
+	}
+	line := fmt.Sprintf("%s %10s %s %s", e.Mode, size, e.ModTime.Format("2006-01-02 15:04"), e.displayName())
+	if e.IsLink {
+		line += " -> " + e.Target
+	}
+	return line
+}
+
+// list files in a directory, leaving out what filter excludes
+func listFiles(path string, filter *treeFilter) ([]fileEntry, error) {
+	var files []fileEntry
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if filter.excluded(path, filepath.Join(path, entry.Name()), entry.IsDir()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, newFileEntry(entry.Name(), filepath.Join(path, entry.Name()), info))
+	}
+
+	return files, nil
+}
+
+// list a directory tree; depth 1 is the root's own entries and a
+// maxDepth of 0 means no limit. Names are relative to root when requested
+func listTree(root string, maxDepth int, relative bool, skipHidden bool, filter *treeFilter) ([]fileEntry, error) {
+	var files []fileEntry
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		depth := strings.Count(filepath.ToSlash(rel), "/") + 1
+		if maxDepth > 0 && depth > maxDepth || skipHidden && isHidden(path) || filter.excluded(root, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := path
+		if relative {
+			name = rel
+		}
+		files = append(files, newFileEntry(name, path, info))
+		return nil
+	})
+	return files, err
+}
+
+// options that select and order listing entries
+type listFilter struct {
+	Sort      string
+	Reverse   bool
+	Exts      []string
+	DirsOnly  bool
+	FilesOnly bool
+	NoHidden  bool
+}
+
+// check the filter options before any listing is done
+func (f listFilter) validate() error {
+	switch f.Sort {
+	case "", "name", "size", "mtime":
+	default:
+		return fmt.Errorf("unknown sort key %q (use name, size or mtime)", f.Sort)
+	}
+	if f.DirsOnly && f.FilesOnly {
+		return fmt.Errorf("-dirs-only and -files-only cannot be combined")
+	}
+	return nil
+}
+
+// drop entries the filter excludes and sort the rest
+func (f listFilter) apply(files []fileEntry) []fileEntry {
+	kept := files[:0]
+	for _, file := range files {
+		if f.DirsOnly && !file.IsDir || f.FilesOnly && file.IsDir {
+			continue
+		}
+		if f.NoHidden && isHidden(file.Path) {
+			continue
+		}
+		if len(f.Exts) > 0 && !hasExt(file.Name, f.Exts) {
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	var compare func(a, b fileEntry) int
+	switch f.Sort {
+	case "name":
+		compare = func(a, b fileEntry) int { return strings.Compare(a.Name, b.Name) }
+	case "size":
+		compare = func(a, b fileEntry) int { return cmp.Compare(a.Size, b.Size) }
+	case "mtime":
+		compare = func(a, b fileEntry) int { return a.ModTime.Compare(b.ModTime) }
+	}
+	if compare != nil {
+		slices.SortStableFunc(kept, compare)
+	}
+	if f.Reverse {
+		slices.Reverse(kept)
+	}
+	return kept
+}
+
+// report whether name ends with one of the extensions (compared case-insensitively)
+func hasExt(name string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, want := range exts {
+		if ext == want {
+			return true
+		}
+	}
+	return false
+}
+
+// split a comma separated extension list, adding the leading dot when missing
+func parseExts(list string) []string {
+	var exts []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// build a listing entry from file info
+func newFileEntry(name string, path string, info fs.FileInfo) fileEntry {
+	entry := fileEntry{
+		Name:    name,
+		Path:    path,
+		IsDir:   info.IsDir(),
+		IsLink:  info.Mode()&fs.ModeSymlink != 0,
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		Perm:    info.Mode().String(),
+		ModTime: info.ModTime(),
+	}
+	if entry.IsLink {
+		entry.Target, _ = os.Readlink(path)
+	}
+	return entry
+}
+
+// format a byte count with binary units, e.g. 1.5K, 20M, 3.2G
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// list files in one or more directories
+func runList(args []string) error {
+	flags := newFlagSet("list")
+	long := flags.Bool("long", false, "Show permissions, size and modification time")
+	human := flags.Bool("human", false, "Show sizes in K, M and G with -long")
+	recursive := flags.Bool("recursive", false, "List subdirectories recursively")
+	maxDepth := flags.Int("max-depth", 0, "Descend at most N levels with -recursive (0 means no limit)")
+	relative := flags.Bool("relative", false, "Print paths relative to the listed directory with -recursive")
+	var filter listFilter
+	flags.StringVar(&filter.Sort, "sort", "", "Sort by name, size or mtime")
+	flags.BoolVar(&filter.Reverse, "reverse", false, "Reverse the order")
+	ext := flags.String("ext", "", "Only show files with these extensions, e.g. .go or .jpg,.png")
+	flags.BoolVar(&filter.DirsOnly, "dirs-only", false, "Only show directories")
+	flags.BoolVar(&filter.FilesOnly, "files-only", false, "Only show files")
+	all := flags.Bool("all", false, "Include hidden files, overriding -no-hidden")
+	flags.BoolVar(&filter.NoHidden, "no-hidden", false, "Exclude dotfiles and, on Windows, hidden or system files")
+	follow := false
+	addFollowFlags(flags, &follow)
+	tree := addTreeFilterFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := checkSharedFlags(flags); err != nil {
+		return usageError("listing files", err)
+	}
+	filter.Exts = parseExts(*ext)
+	if *all {
+		filter.NoHidden = false
+	}
+	if err := filter.validate(); err != nil {
+		return usageError("listing files", err)
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("listing files", err)
+	}
+
+	var listings []dirListing
+	for _, path := range paths {
+		var files []fileEntry
+		if *recursive {
+			files, err = listTree(path, *maxDepth, *relative, filter.NoHidden, tree)
+		} else {
+			files, err = listFiles(path, tree)
+		}
+		if err != nil {
+			return fail("listing files", err)
+		}
+		if follow {
+			files = followLinks(files)
+		}
+		files = filter.apply(files)
+		if opts.JSON {
+			listings = append(listings, dirListing{Path: path, Entries: files})
+			continue
+		}
+		if formatting() {
+			for _, file := range files {
+				if err := printFormatted(file); err != nil {
+					return fail("formatting output", err)
+				}
+			}
+			continue
+		}
+		if len(paths) > 1 {
+			fmt.Println(tr("Files in %s:", path))
+		} else {
+			fmt.Println(tr("Files in directory:"))
+		}
+		for _, file := range files {
+			if *long {
+				fmt.Println(file.longFormat(*human))
+			} else {
+				fmt.Println(file.displayName())
+			}
+		}
+	}
+	if opts.JSON {
+		printJSON(listings)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// format of log messages, set with -log-format
+type logFormat string
+
+func (f *logFormat) String() string {
+	return string(*f)
+}
+
+func (f *logFormat) Set(s string) error {
+	if s != "text" && s != "json" {
+		return fmt.Errorf("must be text or json")
+	}
+	*f = logFormat(s)
+	return nil
+}
+
+// the log settings a logger was built for
+type logSettings struct {
+	Level  slog.Level
+	Format logFormat
+	File   string
+}
+
+var (
+	logMu      sync.Mutex
+	logBuiltAs logSettings
+	logCurrent *slog.Logger
+	logFile    *os.File
+)
+
+// logger for the current -log-level, -log-format and -log-file. It is built
+// again when they change, since they may be given among a command's flags
+// and differ between the steps of a batch
+func logger() *slog.Logger {
+	logMu.Lock()
+	defer logMu.Unlock()
+	want := logSettings{opts.LogLevel, opts.LogFormat, opts.LogFile}
+	if logCurrent != nil && want == logBuiltAs {
+		return logCurrent
+	}
+
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+	var w io.Writer = stderrLog{}
+	if want.File != "" {
+		file, err := os.OpenFile(want.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening log file: %v\n", err)
+		} else {
+			logFile = file
+			w = io.MultiWriter(w, file)
+		}
+	}
+	handlerOpts := &slog.HandlerOptions{Level: want.Level}
+	var handler slog.Handler = slog.NewTextHandler(w, handlerOpts)
+	if want.Format == "json" {
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	}
+	logCurrent, logBuiltAs = slog.New(handler), want
+	return logCurrent
+}
+
+// stderr for log messages, with any progress line cleared first so the two do not mix
+type stderrLog struct{}
+
+func (stderrLog) Write(p []byte) (int, error) {
+	clearProgress()
+	return os.Stderr.Write(p)
+}
+
+// run a command, logging when it starts and how it ended
+func runCommand(cmd command, args []string) error {
+	if err := checkReadOnly(cmd.name, args); err != nil {
+		return err
+	}
+	start := time.Now()
+	logger().Debug("command started", "command", cmd.name, "args", args)
+	err := cmd.run(args)
+	if err != nil {
+		logger().Info("command failed", "command", cmd.name, "error", err, "code", exitCode(err), "duration", time.Since(start))
+	} else {
+		logger().Info("command finished", "command", cmd.name, "duration", time.Since(start))
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// default name of the checksum file written by manifest
+const manifestName = "SHA256SUMS"
+
+// differences between a directory and its checksum file
+type manifestReport struct {
+	Changed []string `json:"changed"`
+	Missing []string `json:"missing"`
+	New     []string `json:"new"`
+	OK      int      `json:"ok"`
+}
+
+// read a checksum file into a map from file name to digest
+func readChecksums(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// sha256sum writes "DIGEST  NAME", or "DIGEST *NAME" in binary mode
+		digest, name, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || (!strings.HasPrefix(name, " ") && !strings.HasPrefix(name, "*")) {
+			return nil, fmt.Errorf("bad line in %s: %q", path, scanner.Text())
+		}
+		sums[name[1:]] = digest
+	}
+	return sums, scanner.Err()
+}
+
+// compute the sha256 of every regular file under dir, keyed by slash-separated
+// relative path, leaving out the checksum file itself
+func treeChecksums(dir string, skip string) (map[string]string, error) {
+	skipAbs, _ := filepath.Abs(skip)
+	sums := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if abs, _ := filepath.Abs(path); abs == skipAbs {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		digest, err := hashFile(path, "sha256")
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = digest
+		return nil
+	})
+	return sums, err
+}
+
+// format checksums the way sha256sum does, sorted by name
+func formatChecksums(sums map[string]string) string {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return b.String()
+}
+
+// compare a directory with the checksums recorded for it
+func checkManifest(dir string, manifest string) (manifestReport, error) {
+	report := manifestReport{Changed: []string{}, Missing: []string{}, New: []string{}}
+	want, err := readChecksums(manifest)
+	if err != nil {
+		return report, err
+	}
+	got, err := treeChecksums(dir, manifest)
+	if err != nil {
+		return report, err
+	}
+	for name, digest := range want {
+		actual, ok := got[name]
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, name)
+		case actual != digest:
+			report.Changed = append(report.Changed, name)
+		default:
+			report.OK++
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			report.New = append(report.New, name)
+		}
+	}
+	sort.Strings(report.Changed)
+	sort.Strings(report.Missing)
+	sort.Strings(report.New)
+	return report, nil
+}
+
+// write a sha256sum-compatible checksum file for a directory tree
+func runManifest(args []string) error {
+	flags := newFlagSet("manifest")
+	output := flags.String("o", "", "Checksum file to write (default: DIR/"+manifestName+")")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	dir := flags.Arg(0)
+	dest := *output
+	if dest == "" {
+		dest = filepath.Join(dir, manifestName)
+	}
+	if err := confine(dir, dest); err != nil {
+		return fail("writing manifest", err)
+	}
+
+	sums, err := treeChecksums(dir, dest)
+	if err != nil {
+		return fail("writing manifest", err)
+	}
+	text := formatChecksums(sums)
+	if opts.DryRun {
+		plan, err := planWrite("write", dest, int64(len(text)))
+		if err != nil {
+			return fail("writing manifest", err)
+		}
+		printPlan(plan)
+		return nil
+	}
+	entry, err := journalPrepare("write", dest, "")
+	if err != nil {
+		return fail("journaling write", err)
+	}
+	if err := journalFinish(entry, writeFileAtomic(dest, strings.NewReader(text))); err != nil {
+		return fail("writing manifest", err)
+	}
+	printDone(opResult{Op: "manifest", Path: dir, Dest: dest}, tr("Wrote checksums of %d files to %s", len(sums), dest))
+	return nil
+}
+
+// verify a directory tree against its checksum file
+func runCheck(args []string) error {
+	flags := newFlagSet("check")
+	manifest := flags.String("manifest", "", "Checksum file to check against (default: DIR/"+manifestName+")")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	dir := flags.Arg(0)
+	if *manifest == "" {
+		*manifest = filepath.Join(dir, manifestName)
+	}
+	if err := confine(dir, *manifest); err != nil {
+		return fail("checking manifest", err)
+	}
+
+	report, err := checkManifest(dir, *manifest)
+	if err != nil {
+		return fail("checking manifest", err)
+	}
+	problems := len(report.Changed) + len(report.Missing) + len(report.New)
+	if opts.JSON {
+		printJSON(report)
+	} else {
+		for _, name := range report.Changed {
+			fmt.Print(tr("changed: %s\n", name))
+		}
+		for _, name := range report.Missing {
+			fmt.Print(tr("missing: %s\n", name))
+		}
+		for _, name := range report.New {
+			fmt.Print(tr("new:     %s\n", name))
+		}
+		printInfo("%d files OK, %d changed, %d missing, %d new\n", report.OK, len(report.Changed), len(report.Missing), len(report.New))
+	}
+	if problems > 0 {
+		return fail("checking manifest", errors.New(tr("%s does not match %s", dir, *manifest)))
+	}
+	return nil
+}
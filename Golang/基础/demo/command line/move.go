@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"cmdline/fileops"
+)
+
+// report whether a rename failed because source and destination are on different devices
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// rename a path; across filesystems it is copied with its metadata, checked
+// against the original and only then removed. A failed copy is cleaned up
+// so the source is never lost
+func moveFile(src string, dest string) error {
+	return moveFileOn(fsys, src, dest)
+}
+
+// moveFile through the file system on, which is fileops.OS for moves into
+// and out of the journal and trash, as they lie outside any -root
+func moveFileOn(on fileops.FS, src string, dest string) error {
+	err := on.Rename(src, dest)
+	if !isCrossDevice(err) {
+		return err
+	}
+	// the copy goes through on as well
+	c := treeCopier{Preserve: preserveSet{Mode: true, Times: true, Owner: true, Xattr: true}, Host: on != fsys}
+	if err := c.copy(src, dest); err != nil {
+		on.RemoveAll(dest)
+		return err
+	}
+	if !isSymlink(src) {
+		if err := verifyCopy(src, dest, nil); err != nil {
+			on.RemoveAll(dest)
+			return fmt.Errorf("copy to other filesystem could not be verified: %w", err)
+		}
+	}
+	return on.RemoveAll(src)
+}
+
+// move files or directories, also between filesystems
+func runMove(args []string) error {
+	flags := newFlagSet("move")
+	backup := addBackupFlags(flags)
+	overwrite := addOverwriteFlags(flags, true)
+	addCopyTuningFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := checkSharedFlags(flags); err != nil {
+		return usageError("moving file", err)
+	}
+	srcs, err := expandPaths(flags.Args()[:flags.NArg()-1])
+	if err != nil {
+		return fail("moving file", err)
+	}
+	dest := flags.Arg(flags.NArg() - 1)
+	if err := confine(dest); err != nil {
+		return fail("moving file", err)
+	}
+
+	// like mv, an existing directory as DST receives the sources
+	info, err := os.Stat(dest)
+	intoDir := err == nil && info.IsDir()
+	if len(srcs) > 1 && !intoDir {
+		return fail("moving file", fmt.Errorf("destination %s is not a directory", dest))
+	}
+
+	for _, src := range srcs {
+		target := dest
+		if intoDir {
+			target = filepath.Join(dest, filepath.Base(src))
+		}
+		if ok, err := overwrite.allow(src, target); err != nil {
+			return fail("moving file", err)
+		} else if !ok {
+			printDone(opResult{Op: "move", Path: src, Dest: target, Skipped: true}, tr("Skipped %s", src))
+			continue
+		}
+		if opts.DryRun {
+			plan, err := planRename(src, target)
+			if err != nil {
+				return fail("moving file", err)
+			}
+			plan.Op = "move"
+			printPlan(plan)
+			continue
+		}
+		backupPath, err := backupFile(target, backup)
+		if err != nil {
+			return fail("backing up file", err)
+		}
+		entry, err := journalPrepare("rename", src, target)
+		if err != nil {
+			return fail("journaling move", err)
+		}
+		if err := journalFinish(entry, moveFile(src, target)); err != nil {
+			return fail("moving file", err)
+		}
+		printDone(opResult{Op: "move", Path: src, Dest: target, Backup: backupPath},
+			withBackup(tr("Moved %s to %s", src, target), backupPath))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// result of a command that changes the filesystem
+type opResult struct {
+	Op        string `json:"op"`
+	Path      string `json:"path,omitempty"`
+	Dest      string `json:"dest,omitempty"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	DryRun    bool   `json:"dry_run,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Offset    *int64 `json:"offset,omitempty"`
+}
+
+// contents of a file returned by read
+type fileContent struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// entries of one directory returned by list
+type dirListing struct {
+	Path    string      `json:"path"`
+	Entries []fileEntry `json:"entries"`
+}
+
+// digest of one file returned by hash
+type hashResult struct {
+	Path   string `json:"path"`
+	Algo   string `json:"algo"`
+	Digest string `json:"digest"`
+}
+
+// error reported in JSON mode
+type errorResult struct {
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error"`
+	Code   int    `json:"code"`
+}
+
+// emit a value as indented JSON on stdout
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		logger().Error("encoding JSON failed", "error", err)
+	}
+}
+
+// emit a value as a single line of JSON, for streams of results
+func printJSONLine(v any) {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		logger().Error("encoding JSON failed", "error", err)
+	}
+}
+
+// a -format template, parsed when the flag is set so a mistake is a usage error
+type outputFormat struct {
+	text string
+	tmpl *template.Template
+}
+
+func (f *outputFormat) String() string {
+	return f.text
+}
+
+func (f *outputFormat) Set(s string) error {
+	tmpl, err := template.New("format").Funcs(formatFuncs).Parse(s)
+	if err != nil {
+		return err
+	}
+	f.text, f.tmpl = s, tmpl
+	return nil
+}
+
+// functions available in -format templates besides the built-in ones
+var formatFuncs = template.FuncMap{
+	"human": humanSize,
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// report whether records are printed with a -format template; -json takes precedence
+func formatting() bool {
+	return opts.Format.tmpl != nil && !opts.JSON
+}
+
+// print one result record, such as a file entry, hash result or sync
+// action, with the -format template and a newline
+func printFormatted(v any) error {
+	var buf bytes.Buffer
+	if err := opts.Format.tmpl.Execute(&buf, v); err != nil {
+		return &invalidUsage{err: err}
+	}
+	buf.WriteByte('\n')
+	clearProgress()
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// report a completed operation as text or JSON
+func printDone(result opResult, message string) {
+	clearProgress()
+	if opts.JSON {
+		printJSON(result)
+		return
+	}
+	if !opts.Quiet {
+		fmt.Println(message)
+	}
+}
+
+// print a status message, such as a summary, that -q suppresses; format
+// is translated
+func printInfo(format string, args ...any) {
+	if opts.Quiet {
+		return
+	}
+	clearProgress()
+	fmt.Print(tr(format, args...))
+}
+
+// print per-file detail, shown only with -v and never with -q or -json;
+// format is translated
+func printVerbose(format string, args ...any) {
+	if !opts.Verbose || opts.Quiet || opts.JSON {
+		return
+	}
+	clearProgress()
+	fmt.Print(tr(format, args...))
+}
+
+// with -v, print every path under root with format before a recursive
+// operation is applied to them
+func printTreeVerbose(format string, root string) {
+	if !opts.Verbose || opts.Quiet || opts.JSON {
+		return
+	}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil {
+			printVerbose(format, path)
+		}
+		return nil
+	})
+}
+
+// report a failed operation as text or JSON
+func printError(err error) {
+	action := ""
+	var actionErr *actionError
+	if errors.As(err, &actionErr) {
+		action, err = actionErr.action, actionErr.err
+	}
+
+	if opts.JSON {
+		printJSON(errorResult{Action: action, Error: err.Error(), Code: exitCode(err)})
+		return
+	}
+	label := tr("Error")
+	if action != "" {
+		label = tr("Error %s", tr(action))
+	}
+	fmt.Printf("%s: %v\n", paint(os.Stdout, colorError, label), err)
+}
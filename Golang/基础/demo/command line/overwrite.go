@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// what to do when the destination of write, copy or rename already exists
+type overwriteOptions struct {
+	NoClobber   bool
+	Update      bool
+	Interactive bool
+}
+
+// register the overwrite policy flags shared by write, copy and rename;
+// -update needs a source file to compare with, so write leaves it out
+func addOverwriteFlags(flags *flag.FlagSet, withUpdate bool) *overwriteOptions {
+	o := &overwriteOptions{}
+	flags.BoolVar(&o.NoClobber, "no-clobber", false, "Fail instead of replacing an existing destination")
+	if withUpdate {
+		flags.BoolVar(&o.Update, "update", false, "Only replace a destination that is older than the source")
+	}
+	flags.BoolVar(&o.Interactive, "interactive", false, "Ask before replacing an existing destination")
+	return o
+}
+
+// check the policy for replacing dest with src (empty for write); false
+// means the destination is to be left alone, and -no-clobber is an error
+func (o *overwriteOptions) allow(src string, dest string) (bool, error) {
+	destInfo, err := os.Lstat(dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if o.NoClobber {
+		return false, fmt.Errorf("%s already exists", dest)
+	}
+	if o.Update && src != "" {
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			return false, err
+		}
+		if !srcInfo.ModTime().After(destInfo.ModTime()) {
+			return false, nil
+		}
+	}
+	if o.Interactive && !opts.DryRun {
+		return confirm(tr("Overwrite %s?", dest)), nil
+	}
+	return true, nil
+}
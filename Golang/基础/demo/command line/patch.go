@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// the start of a patch of a file of the given size: a negative offset
+// counts back from the end, and a patch may not start past the end, which
+// would leave a hole
+func patchOffset(path string, offset int64, size int64) (int64, error) {
+	if offset < 0 {
+		offset += size
+	}
+	if offset < 0 || offset > size {
+		return 0, fmt.Errorf("offset %d is outside %s (%d bytes)", offset, path, size)
+	}
+	return offset, nil
+}
+
+// write data over the bytes of an existing file starting at offset,
+// growing the file when data runs past its end; the rest is left as it is
+func patchFile(path string, offset int64, data []byte) error {
+	file, err := fsys.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// start recording a patch of n bytes at offset; only the bytes it
+// overwrites are saved, not the whole file
+func journalPatch(path string, offset int64, n int64) (*journalEntry, error) {
+	entry, err := journalPrepare("patch", path, "")
+	if entry == nil || err != nil {
+		return entry, err
+	}
+	entry.Offset = offset
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	entry.Saved = filepath.Join(dir, "store", entry.ID)
+	if err := os.MkdirAll(filepath.Dir(entry.Saved), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	saved, err := os.OpenFile(entry.Saved, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(saved, file, n); err != nil && err != io.EOF {
+		saved.Close()
+		os.Remove(entry.Saved)
+		return nil, err
+	}
+	if err := saved.Close(); err != nil {
+		os.Remove(entry.Saved)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// put back the bytes a patch overwrote and cut off what it appended
+func undoPatch(entry journalEntry) error {
+	data, err := os.ReadFile(entry.Saved)
+	if err != nil {
+		return err
+	}
+	file, err := fsys.OpenFile(entry.Path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(entry.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := fsys.Truncate(entry.Path, entry.Size); err != nil {
+		return err
+	}
+	return os.Remove(entry.Saved)
+}
+
+// write -offset: patch the content from input into an existing file
+// without rewriting the rest of it. The content is read into memory
+// first, since patches are small and its size must be known up front.
+func writePatch(path string, r byteRange, input io.Reader, backup *backupOptions) error {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	offset, err := patchOffset(path, r.Offset, info.Size())
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	if r.Length > 0 && int64(len(data)) != r.Length {
+		return fmt.Errorf("content is %d bytes, not the %d of -length", len(data), r.Length)
+	}
+
+	result := opResult{Op: "patch", Path: path, Bytes: int64(len(data)), Offset: &offset}
+	if opts.DryRun {
+		result.DryRun = true
+		printDone(result, tr("Would patch %d bytes of %s at offset %d", result.Bytes, path, offset))
+		return nil
+	}
+	if result.Backup, err = backupFile(path, backup); err != nil {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+	entry, err := journalPatch(path, offset, result.Bytes)
+	if err != nil {
+		return err
+	}
+	if err := journalFinish(entry, patchFile(path, offset, data)); err != nil {
+		return err
+	}
+	printDone(result, withBackup(tr("Patched %d bytes of %s at offset %d", result.Bytes, path, offset), result.Backup))
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// call fn for 0..n-1 on up to jobs goroutines. With a single job the work
+// stops at the first error; with more, every item is tried and all errors
+// are returned together. Once ctx is canceled no more items are started
+func runPool(ctx context.Context, jobs int, n int, fn func(i int) error) error {
+	if jobs <= 1 {
+		for i := range n {
+			if err := canceled(ctx); err != nil {
+				return err
+			}
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	next := make(chan int)
+	for range min(jobs, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := fn(i); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range n {
+		if canceled(ctx) != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if err := canceled(ctx); err != nil {
+		// what was cut short failed for the same reason
+		return err
+	}
+	if len(errs) > 1 {
+		return fmt.Errorf("%d files failed:\n%w", len(errs), errors.Join(errs...))
+	}
+	return errors.Join(errs...)
+}
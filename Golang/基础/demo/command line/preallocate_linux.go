@@ -0,0 +1,19 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reserve size bytes of dest from off with fallocate, without changing its
+// length, so an interrupted copy still looks partial to -resume. Filesystems
+// without fallocate are left to allocate as the data is written
+func preallocate(dest *os.File, off int64, size int64) error {
+	err := unix.Fallocate(int(dest.Fd()), unix.FALLOC_FL_KEEP_SIZE, off, size)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return nil
+	}
+	return err
+}
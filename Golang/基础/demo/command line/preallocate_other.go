@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// space is only reserved ahead on Linux; elsewhere it is allocated as the
+// data is written
+func preallocate(dest *os.File, off int64, size int64) error {
+	return nil
+}
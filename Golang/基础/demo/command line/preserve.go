@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/pkg/xattr"
+
+	"cmdline/fileops"
+)
+
+// metadata that copy keeps from the source, chosen with -preserve
+type preserveSet struct {
+	Mode  bool
+	Times bool
+	Owner bool
+	Xattr bool
+}
+
+// parse a comma separated list of mode, times, owner and xattr, or all
+func parsePreserve(list string) (preserveSet, error) {
+	var p preserveSet
+	for _, name := range strings.Split(list, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "mode":
+			p.Mode = true
+		case "times":
+			p.Times = true
+		case "owner":
+			p.Owner = true
+		case "xattr":
+			p.Xattr = true
+		case "all":
+			p = preserveSet{Mode: true, Times: true, Owner: true, Xattr: true}
+		default:
+			return p, fmt.Errorf("unknown -preserve attribute %q (use mode, times, owner, xattr or all)", name)
+		}
+	}
+	return p, nil
+}
+
+// give dest, on the file system on, the selected metadata of the source
+// described by info. Ownership
+// is only changed when allowed, as only root may give files away, and extended
+// attributes are skipped on file systems without them. A symlink only gets its
+// owner and attributes, since its mode and times cannot be set portably.
+func preserveMetadata(on fileops.FS, src string, dest string, info fs.FileInfo, p preserveSet) error {
+	link := info.Mode()&fs.ModeSymlink != 0
+	if p.Owner {
+		if uid, gid, ok := ownerIDs(info); ok {
+			if err := on.Lchown(dest, uid, gid); err != nil && !errors.Is(err, fs.ErrPermission) {
+				return err
+			}
+		}
+	}
+	if p.Xattr {
+		if err := copyXattrs(src, dest); err != nil {
+			return err
+		}
+	}
+	if link {
+		return nil
+	}
+	if p.Mode {
+		// chown clears the setuid and setgid bits, so the mode comes after it
+		if err := on.Chmod(dest, info.Mode()&(fs.ModePerm|specialBits)); err != nil {
+			return err
+		}
+	}
+	if p.Times {
+		// a zero access time leaves it as the copy left it
+		if err := on.Chtimes(dest, time.Time{}, info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy the extended attributes of src to dest, without following symlinks
+func copyXattrs(src string, dest string) error {
+	names, err := xattr.LList(src)
+	if err != nil {
+		if unsupportedXattr(err) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		value, err := xattr.LGet(src, name)
+		if err != nil {
+			return err
+		}
+		if err := xattr.LSet(dest, name, value); err != nil && !unsupportedXattr(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// report whether an xattr error means the platform or file system has no
+// extended attributes, or this namespace may not be written
+func unsupportedXattr(err error) bool {
+	return errors.Is(err, xattr.ENOATTR) || errors.Is(err, errors.ErrUnsupported) || errors.Is(err, fs.ErrPermission)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"cmdline/fileops"
+)
+
+// the structured format of a file for read -pretty and -validate: JSON
+// or YAML by its extension, or else JSON when it parses as such
+func dataFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl", ".ndjson", ".geojson":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	if json.Valid(data) {
+		return "json"
+	}
+	return "yaml"
+}
+
+// a syntax error of a file, as read -validate reports it; Line and Column
+// are 1-based and 0 when the parser does not tell
+type syntaxCheck struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Valid  bool   `json:"valid"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (c syntaxCheck) String() string {
+	switch {
+	case c.Valid:
+		return fmt.Sprintf("%s: %s", c.Path, tr("valid %s", strings.ToUpper(c.Format)))
+	case c.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", c.Path, c.Line, c.Column, c.Error)
+	case c.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", c.Path, c.Line, c.Error)
+	}
+	return fmt.Sprintf("%s: %s", c.Path, c.Error)
+}
+
+// the line and column of a byte offset into data
+func lineColumn(data []byte, offset int64) (int, int) {
+	offset = min(offset, int64(len(data)))
+	before := data[:offset]
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// the JSON values of data, which may hold several, one after another as
+// in JSON Lines
+func jsonValues(data []byte) ([]json.RawMessage, error) {
+	var values []json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value json.RawMessage
+		err := dec.Decode(&value)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				// the offset is just past the byte that did not fit
+				return nil, &dataError{syntax.Offset - 1, err}
+			}
+			if err == io.ErrUnexpectedEOF {
+				// the value runs to the end of the data
+				return nil, &dataError{int64(len(data)), err}
+			}
+			return nil, &dataError{dec.InputOffset(), err}
+		}
+		values = append(values, value)
+	}
+}
+
+// a JSON error at a byte offset
+type dataError struct {
+	offset int64
+	err    error
+}
+
+func (e *dataError) Error() string { return e.err.Error() }
+func (e *dataError) Unwrap() error { return e.err }
+
+// the documents of YAML data
+func yamlDocuments(data []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, &doc)
+	}
+}
+
+// yaml.v3 puts the line, but not the column, into its messages
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// check the syntax of data in format
+func checkSyntax(path string, format string, data []byte) syntaxCheck {
+	check := syntaxCheck{Path: path, Format: format, Valid: true}
+	var err error
+	if format == "json" {
+		_, err = jsonValues(data)
+	} else {
+		_, err = yamlDocuments(data)
+	}
+	if err == nil {
+		return check
+	}
+	check.Valid = false
+	check.Error = err.Error()
+	var at *dataError
+	if errors.As(err, &at) {
+		check.Line, check.Column = lineColumn(data, at.offset)
+	} else if m := yamlErrorLine.FindStringSubmatch(check.Error); m != nil {
+		check.Line, _ = strconv.Atoi(m[1])
+		check.Error = strings.TrimPrefix(check.Error, m[0])
+	}
+	check.Error = strings.TrimPrefix(check.Error, "yaml: ")
+	return check
+}
+
+// re-indent data in format with two spaces; YAML keeps its comments and
+// the order of keys
+func prettyData(format string, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	if format == "json" {
+		values, err := jsonValues(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if err := json.Indent(&b, value, "", "  "); err != nil {
+				return nil, err
+			}
+			b.WriteByte('\n')
+		}
+		return b.Bytes(), nil
+	}
+	docs, err := yamlDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// color indented JSON for a terminal: keys, strings, numbers and the
+// literals true, false and null each get their own color
+func colorJSON(data []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(data))
+			code := colorString
+			if rest := bytes.TrimLeft(data[end:], " \t"); len(rest) > 0 && rest[0] == ':' {
+				code = colorKey
+			}
+			b.WriteString(paint(os.Stdout, code, string(data[i:end])))
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(data) && strings.IndexByte("+-0123456789.eE", data[end]) >= 0 {
+				end++
+			}
+			b.WriteString(paint(os.Stdout, colorNumber, string(data[i:end])))
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(data) && data[end] >= 'a' && data[end] <= 'z' {
+				end++
+			}
+			b.WriteString(paint(os.Stdout, colorLiteral, string(data[i:end])))
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// a YAML line starting with a key, after any indentation and list dashes
+var yamlKey = regexp.MustCompile(`^(\s*(?:- )*)("[^"]*"|'[^']*'|[^\s#'"{\[][^:#]*?):(\s|$)`)
+
+// color YAML for a terminal: keys and comments stand out
+func colorYAML(data []byte) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		body := strings.TrimRight(line, "\n")
+		switch m := yamlKey.FindStringSubmatchIndex(body); {
+		case strings.HasPrefix(strings.TrimSpace(body), "#"):
+			body = paint(os.Stdout, colorComment, body)
+		case m != nil:
+			body = body[:m[3]] + paint(os.Stdout, colorKey, body[m[4]:m[5]]) + body[m[5]:]
+		}
+		b.WriteString(body)
+		if strings.HasSuffix(line, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// read -pretty and -validate: re-indent JSON and YAML files, or only check
+// their syntax and report where it breaks
+func readData(paths []string, validate bool) error {
+	var checks []syntaxCheck
+	var results []fileContent
+	invalid := 0
+	for _, path := range paths {
+		data, err := fileops.Read(cmdCtx, fsys, path)
+		if err != nil {
+			return fail("reading file", err)
+		}
+		format := dataFormat(path, data)
+		check := checkSyntax(path, format, data)
+		if validate {
+			if !check.Valid {
+				invalid++
+			}
+			switch {
+			case opts.JSON:
+				checks = append(checks, check)
+			case check.Valid:
+				printVerbose("%s\n", check)
+			default:
+				fmt.Println(check)
+			}
+			continue
+		}
+		if !check.Valid {
+			return fail("reading file", errors.New(check.String()))
+		}
+		pretty, err := prettyData(format, data)
+		if err != nil {
+			return fail("reading file", err)
+		}
+		if opts.JSON {
+			results = append(results, fileContent{Path: path, Content: string(pretty)})
+			continue
+		}
+		if len(paths) > 1 {
+			fmt.Printf("==> %s <==\n", path)
+		}
+		if format == "json" {
+			fmt.Print(colorJSON(pretty))
+		} else {
+			fmt.Print(colorYAML(pretty))
+		}
+	}
+	if !validate {
+		if opts.JSON {
+			printJSON(results)
+		}
+		return nil
+	}
+	if opts.JSON {
+		printJSON(checks)
+	} else {
+		printInfo("%d files valid, %d invalid\n", len(paths)-invalid, invalid)
+	}
+	if invalid > 0 {
+		return fail("validating file", fmt.Errorf("%d of %d files have syntax errors", invalid, len(paths)))
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// nothing is shown for operations that finish sooner than this
+	progressDelay = 500 * time.Millisecond
+	// redraw interval of the bar on a terminal
+	progressRedraw = 200 * time.Millisecond
+	// interval between plain progress lines when stderr is not a terminal
+	progressLineInterval = 10 * time.Second
+	// width of the bar itself, between the brackets
+	progressBarWidth = 30
+)
+
+// byte progress of a long transfer, drawn on stderr as a bar on a terminal
+// and as a periodic line otherwise. A nil *progress ignores every call, so
+// callers need not check whether progress is enabled
+type progress struct {
+	label string
+	total int64
+	done  atomic.Int64
+	start time.Time
+	bar   bool
+
+	mu    sync.Mutex // serializes drawing with clearProgress
+	drawn bool
+	stop  chan struct{}
+	ended chan struct{}
+}
+
+// the progress being drawn, so other output can clear the bar first
+var activeProgress *progress
+
+// start reporting progress towards total bytes (0 if unknown); nil is
+// returned when progress is turned off with -no-progress, -q or -dry-run
+func startProgress(label string, total int64) *progress {
+	if opts.NoProgress || opts.Quiet || opts.DryRun {
+		return nil
+	}
+	p := &progress{
+		label: label,
+		total: total,
+		start: time.Now(),
+		bar:   term.IsTerminal(int(os.Stderr.Fd())),
+		stop:  make(chan struct{}),
+		ended: make(chan struct{}),
+	}
+	activeProgress = p
+	go p.run()
+	return p
+}
+
+// sum of the sizes of the regular files at or under paths, for a progress total
+func totalSize(paths ...string) int64 {
+	var total int64
+	for _, path := range paths {
+		size, _ := treeSize(path)
+		total += size
+	}
+	return total
+}
+
+// record n more bytes done
+func (p *progress) add(n int64) {
+	if p != nil {
+		p.done.Add(n)
+	}
+}
+
+// wrap r so bytes read from it count as done
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r, p}
+}
+
+// stop reporting and remove the bar
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.ended
+	clearProgress()
+	activeProgress = nil
+}
+
+// draw until finished, first waiting to see whether the work is quick
+func (p *progress) run() {
+	defer close(p.ended)
+	select {
+	case <-p.stop:
+		return
+	case <-time.After(progressDelay):
+	}
+	interval := progressRedraw
+	if !p.bar {
+		interval = progressLineInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.draw()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// write the current state on stderr
+func (p *progress) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", p.status(true))
+		p.drawn = true
+		return
+	}
+	fmt.Fprintln(os.Stderr, p.status(false))
+}
+
+// one line: label, optional bar, bytes done of total, percentage, rate and ETA
+func (p *progress) status(withBar bool) string {
+	done := p.done.Load()
+	elapsed := time.Since(p.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+
+	var b strings.Builder
+	b.WriteString(p.label)
+	if p.total <= 0 {
+		fmt.Fprintf(&b, "  %s  %s/s", humanSize(done), humanSize(int64(rate)))
+		return b.String()
+	}
+	fraction := min(float64(done)/float64(p.total), 1)
+	if withBar {
+		filled := int(fraction * progressBarWidth)
+		fmt.Fprintf(&b, " [%s%s]", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled))
+	}
+	fmt.Fprintf(&b, "  %s / %s  %3.0f%%  %s/s", humanSize(done), humanSize(p.total), fraction*100, humanSize(int64(rate)))
+	if rate > 0 && done < p.total {
+		eta := time.Duration(float64(p.total-done) / rate * float64(time.Second))
+		fmt.Fprintf(&b, "  ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+// erase the bar, if one is drawn, before other output is printed; it is
+// drawn again at the next redraw
+func clearProgress() {
+	p := activeProgress
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// reader that counts the bytes read through it
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	r.p.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"cmdline/fileops"
+)
+
+// size of the chunks used when streaming file contents
+const streamBufferSize = 32 * 1024
+
+// write a file, or only its first or last lines, to w without loading it whole
+func streamFile(w io.Writer, path string, head int, tail int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch {
+	case head > 0:
+		return copyHead(w, file, head)
+	case tail > 0:
+		return copyTail(w, file, tail)
+	default:
+		_, err := io.CopyBuffer(w, file, make([]byte, streamBufferSize))
+		return err
+	}
+}
+
+// copy the first n lines of r to w
+func copyHead(w io.Writer, r io.Reader, n int) error {
+	reader := bufio.NewReaderSize(r, streamBufferSize)
+	for i := 0; i < n; i++ {
+		line, err := reader.ReadBytes('\n')
+		if _, werr := w.Write(line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy the last n lines of a file to w by scanning backwards from the end
+func copyTail(w io.Writer, file *os.File, n int) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	// a trailing newline ends the last line rather than starting a new one
+	offset, newlines := size, 0
+	buf := make([]byte, streamBufferSize)
+	for offset > 0 {
+		chunk := int64(len(buf))
+		if offset < chunk {
+			chunk = offset
+		}
+		offset -= chunk
+		if _, err := file.ReadAt(buf[:chunk], offset); err != nil {
+			return err
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			if buf[i] != '\n' || offset+i == size-1 {
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return copyFrom(w, file, offset+i+1)
+			}
+		}
+	}
+	return copyFrom(w, file, 0)
+}
+
+// copy a file from the given offset to the end
+func copyFrom(w io.Writer, file *os.File, offset int64) error {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyBuffer(w, file, make([]byte, streamBufferSize))
+	return err
+}
+
+// read a file, or only its first or last lines, into a string
+func readPart(path string, head int, tail int) (string, error) {
+	if head <= 0 && tail <= 0 {
+		data, err := fileops.Read(cmdCtx, fsys, path)
+		return string(data), err
+	}
+	var buf bytes.Buffer
+	if err := streamFile(&buf, path, head, tail); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// make dest a copy-on-write clone of src with FICLONE; works within one
+// btrfs, XFS or similar filesystem and fails everywhere else
+func cloneFile(dest *os.File, src *os.File) error {
+	return unix.IoctlFileClone(int(dest.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// copy-on-write clones are only made on Linux
+func cloneFile(dest *os.File, src *os.File) error {
+	return fmt.Errorf("reflinks are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"cmdline/fileops"
+)
+
+// a single source and target of a bulk rename
+type renamePair struct {
+	Src  string `json:"src"`
+	Dest string `json:"dest"`
+}
+
+// the new base name for -match and -to; names the pattern does not match
+// as a whole are kept
+func matchRename(re *regexp.Regexp, template string) func(string) string {
+	return func(base string) string {
+		match := re.FindStringSubmatchIndex(base)
+		if match == nil || match[0] != 0 || match[1] != len(base) {
+			return base
+		}
+		return string(re.ExpandString(nil, template, base, match))
+	}
+}
+
+// work out the new base names of paths with rename, rejecting renames that
+// would collide with each other or with existing files
+func planBulkRename(paths []string, rename func(base string) string) ([]renamePair, error) {
+	var pairs []renamePair
+	targets := map[string]string{}
+	for _, path := range paths {
+		base := filepath.Base(path)
+		newBase := rename(base)
+		if newBase == base {
+			continue
+		}
+		if newBase == "" || newBase == "." || newBase == ".." || filepath.Base(newBase) != newBase {
+			return nil, fmt.Errorf("%s would be renamed to invalid name %q", path, newBase)
+		}
+
+		dest := filepath.Join(filepath.Dir(path), newBase)
+		if other, ok := targets[dest]; ok {
+			return nil, fmt.Errorf("%s and %s would both be renamed to %s", other, path, dest)
+		}
+		targets[dest] = path
+		pairs = append(pairs, renamePair{Src: path, Dest: dest})
+	}
+
+	// an existing target is only safe when it is itself being renamed away first
+	sources := map[string]bool{}
+	for _, pair := range pairs {
+		sources[pair.Src] = true
+	}
+	for _, pair := range pairs {
+		if exists(pair.Dest) && !sources[pair.Dest] {
+			return nil, fmt.Errorf("%s would overwrite existing %s", pair.Src, pair.Dest)
+		}
+	}
+	return orderRenames(pairs)
+}
+
+// order renames so that a target which is also a source is moved out of the way first
+func orderRenames(pairs []renamePair) ([]renamePair, error) {
+	var ordered []renamePair
+	done := map[string]bool{}
+	for len(ordered) < len(pairs) {
+		progress := false
+		for _, pair := range pairs {
+			if done[pair.Src] {
+				continue
+			}
+			blocked := false
+			for _, other := range pairs {
+				if other.Src == pair.Dest && !done[other.Src] {
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				ordered = append(ordered, pair)
+				done[pair.Src] = true
+				progress = true
+			}
+		}
+		if !progress {
+			// a cycle such as a->b, b->a would overwrite one of the files
+			return nil, fmt.Errorf("renames form a cycle; rename through a temporary name instead")
+		}
+	}
+	return ordered, nil
+}
+
+// rename one file, keeping a backup of and a journal entry for the destination
+func renameOne(src string, dest string, backup *backupOptions, overwrite *overwriteOptions) error {
+	if ok, err := overwrite.allow(src, dest); err != nil {
+		return fail("renaming file", err)
+	} else if !ok {
+		printDone(opResult{Op: "rename", Path: src, Dest: dest, Skipped: true}, tr("Skipped %s", src))
+		return nil
+	}
+	if opts.DryRun {
+		plan, err := planRename(src, dest)
+		if err != nil {
+			return fail("renaming file", err)
+		}
+		printPlan(plan)
+		return nil
+	}
+	backupPath, err := backupFile(dest, backup)
+	if err != nil {
+		return fail("backing up file", err)
+	}
+	entry, err := journalPrepare("rename", src, dest)
+	if err != nil {
+		return fail("journaling rename", err)
+	}
+	if err := journalFinish(entry, fileops.Rename(cmdCtx, fsys, src, dest)); err != nil {
+		return fail("renaming file", err)
+	}
+	printDone(opResult{Op: "rename", Path: src, Dest: dest, Backup: backupPath},
+		withBackup(tr("File renamed successfully from %s to %s", src, dest), backupPath))
+	return nil
+}
+
+// rename a file, or many files with a match pattern and replacement template
+func runRename(args []string) error {
+	flags := newFlagSet("rename")
+	backup := addBackupFlags(flags)
+	overwrite := addOverwriteFlags(flags, true)
+	match := flags.String("match", "", "Regular expression the whole base name must match, e.g. (.*)\\.jpeg")
+	to := flags.String("to", "", "Replacement name for -match, with $1 style group references, e.g. $1.jpg")
+	sanitize := flags.Bool("sanitize", false, "Rename to names valid on Windows, macOS and Linux: normalize Unicode, replace invalid characters and collapse whitespace")
+	clean := sanitizeOptions{Form: norm.NFC, Replacement: "_"}
+	flags.Func("normalize", "Unicode normalization for -sanitize: nfc, as Linux and Windows use, or nfd (default nfc)", func(text string) error {
+		form, err := parseNormForm(text)
+		clean.Form = form
+		return err
+	})
+	flags.StringVar(&clean.Replacement, "replace-with", clean.Replacement, "Text put in place of characters -sanitize removes; empty drops them")
+	recursive := flags.Bool("recursive", false, "With -sanitize, rename everything inside the directories given instead of the directories themselves")
+	flags.Parse(args)
+	if err := checkSharedFlags(flags); err != nil {
+		return usageError("renaming files", err)
+	}
+	if err := requireFlags(flags, "to", "match"); err != nil {
+		return usageError("renaming files", err)
+	}
+	if err := requireFlags(flags, "match", "to"); err != nil {
+		return usageError("renaming files", err)
+	}
+	for _, name := range []string{"normalize", "replace-with", "recursive"} {
+		if err := requireFlags(flags, name, "sanitize"); err != nil {
+			return usageError("renaming files", err)
+		}
+	}
+	if err := exclusiveFlags(flags, "match", "sanitize"); err != nil {
+		return usageError("renaming files", err)
+	}
+	if strings.ContainsAny(clean.Replacement, invalidNameChars) {
+		return usageError("renaming files", fmt.Errorf("-replace-with %q holds characters that are invalid in names", clean.Replacement))
+	}
+
+	if *sanitize {
+		if flags.NArg() < 1 {
+			flags.Usage()
+			return errUsage
+		}
+		rename := func(base string) string { return sanitizeName(base, clean) }
+		return runBulkRename(flags.Args(), *recursive, rename, tr("All names are already valid"), backup, overwrite)
+	}
+	if *match == "" {
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return errUsage
+		}
+		if err := confine(flags.Arg(0), flags.Arg(1)); err != nil {
+			return fail("renaming file", err)
+		}
+		return renameOne(flags.Arg(0), flags.Arg(1), backup, overwrite)
+	}
+
+	if *to == "" || flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	re, err := regexp.Compile(*match)
+	if err != nil {
+		return usageError("renaming files", err)
+	}
+	return runBulkRename(flags.Args(), false, matchRename(re, *to), tr("No files matched %s", *match), backup, overwrite)
+}
+
+// rename every path the patterns expand to, and with recursive everything
+// inside them, to the base name rename gives it; none is reported when no
+// name changes
+func runBulkRename(patterns []string, recursive bool, rename func(base string) string, none string, backup *backupOptions, overwrite *overwriteOptions) error {
+	paths, err := expandPaths(patterns)
+	if err != nil {
+		return fail("renaming files", err)
+	}
+	if recursive {
+		if paths, err = sanitizeWalk(paths); err != nil {
+			return fail("renaming files", err)
+		}
+	}
+	pairs, err := planBulkRename(paths, rename)
+	if err != nil {
+		return fail("renaming files", err)
+	}
+	if len(pairs) == 0 {
+		printDone(opResult{Op: "rename", Skipped: true}, none)
+		return nil
+	}
+	for _, pair := range pairs {
+		if err := renameOne(pair.Src, pair.Dest, backup, overwrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
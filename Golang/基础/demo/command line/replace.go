@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"cmdline/fileops"
+)
+
+// apply a regular expression replacement to a file's content and report
+// whether anything changed
+func replaceInFile(path string, re *regexp.Regexp, replacement string) (before string, after string, err error) {
+	data, err := fileops.Read(cmdCtx, fsys, path)
+	if err != nil {
+		return "", "", err
+	}
+	before = string(data)
+	return before, re.ReplaceAllString(before, replacement), nil
+}
+
+// print the lines a replacement changes, as -old/+new pairs with line numbers
+func printChangePreview(w io.Writer, path string, before string, after string) {
+	oldLines, newLines := strings.Split(before, "\n"), strings.Split(after, "\n")
+	if len(oldLines) != len(newLines) {
+		fmt.Fprintf(w, "%s: %d lines become %d lines\n", path, len(oldLines), len(newLines))
+		return
+	}
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			fmt.Fprintf(w, "%s:%d\n-%s\n+%s\n", path, i+1, oldLines[i], newLines[i])
+		}
+	}
+}
+
+// find and replace text in files with a regular expression
+func runReplace(args []string) error {
+	flags := newFlagSet("replace")
+	inPlace := flags.Bool("in-place", false, "Rewrite the files instead of printing the result")
+	noBackup := flags.Bool("no-backup", false, "Do not keep a .bak copy of files changed in place")
+	ignoreCase := flags.Bool("i", false, "Match case-insensitively")
+	binary := flags.Bool("binary", false, "Change binary files too instead of skipping them")
+	flags.Parse(args)
+	if flags.NArg() < 3 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := requireFlags(flags, "no-backup", "in-place"); err != nil {
+		return usageError("replacing text", err)
+	}
+
+	pattern := flags.Arg(0)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return usageError("replacing text", err)
+	}
+	replacement := flags.Arg(1)
+	paths, err := expandPaths(flags.Args()[2:])
+	if err != nil {
+		return fail("replacing text", err)
+	}
+	backup := &backupOptions{Enabled: !*noBackup, Suffix: ".bak"}
+
+	for _, path := range paths {
+		if !*binary {
+			if isBinary, err := isBinaryFile(path); err != nil {
+				return fail("replacing text", err)
+			} else if isBinary {
+				printDone(opResult{Op: "replace", Path: path, Skipped: true}, tr("Skipped binary file %s (use -binary)", path))
+				continue
+			}
+		}
+		before, after, err := replaceInFile(path, re, replacement)
+		if err != nil {
+			return fail("replacing text", err)
+		}
+
+		switch {
+		case opts.DryRun:
+			if !opts.JSON {
+				printChangePreview(os.Stdout, path, before, after)
+				continue
+			}
+			printDone(opResult{Op: "replace", Path: path, DryRun: true, Skipped: before == after}, "")
+		case !*inPlace:
+			if opts.JSON {
+				printJSON(fileContent{Path: path, Content: after})
+				continue
+			}
+			fmt.Print(after)
+		case before == after:
+			printDone(opResult{Op: "replace", Path: path, Skipped: true}, tr("No changes: %s", path))
+		default:
+			backupPath, err := backupFile(path, backup)
+			if err != nil {
+				return fail("backing up file", err)
+			}
+			entry, err := journalPrepare("write", path, "")
+			if err != nil {
+				return fail("journaling write", err)
+			}
+			if err := journalFinish(entry, writeFileAtomic(path, strings.NewReader(after))); err != nil {
+				return fail("replacing text", err)
+			}
+			printDone(opResult{Op: "replace", Path: path, Backup: backupPath},
+				withBackup(tr("File updated successfully: %s", path), backupPath))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"cmdline/fileops"
+)
+
+// size of the blocks compared when checking what a partial copy already holds
+const resumeBlockSize = 1 << 20
+
+// continue an interrupted copy on the file system on: the part of dest that
+// matches src is kept and only the rest is copied. Returns the offset the
+// copy resumed at, which is 0 when dest is missing or is longer than src and
+// so cannot be a partial copy
+func resumeCopy(on fileops.FS, src string, dest string, p *progress) (int64, error) {
+	srcFile, err := on.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer srcFile.Close()
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	destFile, err := on.OpenFile(dest, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer destFile.Close()
+	destInfo, err := destFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	if destInfo.Size() <= srcInfo.Size() {
+		if offset, err = matchingPrefix(srcFile, destFile, destInfo.Size()); err != nil {
+			return 0, err
+		}
+	}
+	p.add(offset)
+	if err := on.Truncate(dest, offset); err != nil {
+		return 0, err
+	}
+	if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := destFile.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	destOS, destOK := destFile.(*os.File)
+	srcOS, srcOK := srcFile.(*os.File)
+	if !destOK || !srcOK {
+		if err := copyBuffered(destFile, srcFile, p); err != nil {
+			return offset, err
+		}
+		return offset, destFile.Close()
+	}
+	if err := copyContents(destOS, srcOS, p); err != nil {
+		return offset, err
+	}
+	if err := finishCopy(destOS); err != nil {
+		return offset, err
+	}
+	return offset, destFile.Close()
+}
+
+// length of the common prefix of a and b within their first size bytes,
+// compared block by block
+func matchingPrefix(a io.Reader, b io.Reader, size int64) (int64, error) {
+	bufA := make([]byte, resumeBlockSize)
+	bufB := make([]byte, resumeBlockSize)
+	var offset int64
+	for offset < size {
+		n := int(min(resumeBlockSize, size-offset))
+		if _, err := io.ReadFull(a, bufA[:n]); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(b, bufB[:n]); err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(bufA[:n], bufB[:n]) {
+			for i := range n {
+				if bufA[i] != bufB[i] {
+					return offset + int64(i), nil
+				}
+			}
+		}
+		offset += int64(n)
+	}
+	return offset, nil
+}
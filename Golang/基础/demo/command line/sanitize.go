@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"cmdline/fileops"
+)
+
+// characters Windows does not allow in a file name; it is the strictest
+// of the platforms, and / is invalid everywhere
+const invalidNameChars = `<>:"/\|?*`
+
+// settings for rename -sanitize
+type sanitizeOptions struct {
+	// Unicode normalization form, NFC by default: macOS has long written
+	// NFD, so the same name arrives from it decomposed
+	Form norm.Form
+	// put in place of each invalid character; empty drops them
+	Replacement string
+}
+
+// parse the -normalize value
+func parseNormForm(text string) (norm.Form, error) {
+	switch strings.ToLower(text) {
+	case "nfc":
+		return norm.NFC, nil
+	case "nfd":
+		return norm.NFD, nil
+	}
+	return 0, fmt.Errorf("use nfc or nfd")
+}
+
+// a base name that is valid on Windows, macOS and Linux: Unicode
+// normalized, invalid bytes and characters replaced, runs of whitespace
+// collapsed to one space, trailing dots and spaces dropped and device
+// names such as CON given a suffix
+func sanitizeName(name string, o sanitizeOptions) string {
+	name = o.Form.String(strings.ToValidUTF8(name, o.Replacement))
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case r < 0x20 || r == 0x7f || strings.ContainsRune(invalidNameChars, r):
+			b.WriteString(o.Replacement)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name = strings.Join(strings.Fields(b.String()), " ")
+	// Windows drops them, so two names would end up the same
+	name = strings.TrimRight(name, ". ")
+	if fileops.IsReservedName(name) {
+		stem, ext, _ := strings.Cut(name, ".")
+		name = stem + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// the paths rename -sanitize -recursive looks at: everything under each
+// directory, deepest first so a directory is renamed after its contents.
+// The directories named are left as they are, so . or a path to a
+// project is never renamed itself.
+func sanitizeWalk(paths []string) ([]string, error) {
+	var all []string
+	for _, root := range paths {
+		var found []string
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != root || !d.IsDir() {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// WalkDir lists a directory before its contents
+		for i := len(found) - 1; i >= 0; i-- {
+			all = append(all, found[i])
+		}
+	}
+	return all, nil
+}
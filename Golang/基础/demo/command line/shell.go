@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/peterh/liner"
+)
+
+// commands handled by the shell itself rather than dispatched like batch steps
+var shellBuiltins = []string{"cd", "pwd", "help", "exit", "quit"}
+
+// file the shell history is kept in between sessions, next to the journal
+func shellHistoryPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "shell_history"), nil
+}
+
+// prompt showing the current directory, with the home directory as ~
+func shellPrompt() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = "?"
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(home, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			dir = filepath.Join("~", rel)
+		}
+	}
+	return "fileutil " + dir + "> "
+}
+
+// complete the word before the cursor: a command name as the first word,
+// a path after that. Spaces in completed names are escaped with a backslash
+func completeShellWord(line string, pos int) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+	start := strings.LastIndexAny(head, " \t") + 1
+	for start > 1 && head[start-2] == '\\' {
+		// an escaped space is part of the word
+		start = strings.LastIndexAny(head[:start-2], " \t") + 1
+	}
+	word := strings.ReplaceAll(head[start:], `\ `, " ")
+
+	var candidates []string
+	if strings.TrimSpace(head[:start]) == "" {
+		for _, cmd := range commands {
+			candidates = append(candidates, cmd.name)
+		}
+		candidates = append(candidates, shellBuiltins...)
+		matches := candidates[:0]
+		for _, c := range candidates {
+			if strings.HasPrefix(c, word) {
+				matches = append(matches, c+" ")
+			}
+		}
+		sort.Strings(matches)
+		return head[:start], matches, tail
+	}
+
+	dir, prefix := filepath.Split(word)
+	entries, err := os.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return head[:start], nil, tail
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		match := dir + name
+		if e.IsDir() {
+			match += string(filepath.Separator)
+		}
+		candidates = append(candidates, strings.ReplaceAll(match, " ", `\ `))
+	}
+	return head[:start], candidates, tail
+}
+
+// run a built-in shell command, reporting whether line was one
+func runShellBuiltin(args []string) (handled bool, exit bool, err error) {
+	switch args[0] {
+	case "exit", "quit":
+		return true, true, nil
+	case "pwd":
+		dir, err := os.Getwd()
+		if err == nil {
+			fmt.Println(dir)
+		}
+		return true, false, err
+	case "cd":
+		dir := ""
+		switch len(args) {
+		case 1:
+			// home, or the root when confined to one
+			if dir = opts.Root; dir != "" {
+				break
+			}
+			if dir, err = os.UserHomeDir(); err != nil {
+				return true, false, err
+			}
+		case 2:
+			dir = args[1]
+		default:
+			return true, false, errors.New("usage: cd [DIR]")
+		}
+		if err := confine(dir); err != nil {
+			return true, false, err
+		}
+		return true, false, os.Chdir(dir)
+	case "help":
+		if len(args) > 1 {
+			return true, false, runBatchStep([]string{args[1], "-help"})
+		}
+		printHelp()
+		fmt.Println("Shell commands: cd [DIR], pwd, help [COMMAND], exit. Tab completes commands and paths.")
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+// run commands interactively with history and completion
+func runREPL(args []string) error {
+	flags := newFlagSet("shell")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(completeShellWord)
+	historyPath, err := shellHistoryPath()
+	if err == nil {
+		if file, err := os.Open(historyPath); err == nil {
+			line.ReadHistory(file)
+			file.Close()
+		}
+	}
+
+	// every command runs like a batch step, so bad flags do not end the shell
+	defer func(saved flag.ErrorHandling) { flagErrorHandling = saved }(flagErrorHandling)
+	flagErrorHandling = flag.PanicOnError
+	for {
+		input, err := line.Prompt(shellPrompt())
+		if err == liner.ErrPromptAborted {
+			// Ctrl-C drops the line being typed
+			continue
+		}
+		if err == io.EOF {
+			fmt.Println()
+			break
+		}
+		if err != nil {
+			return fail("reading command", err)
+		}
+		args, err := splitCommandLine(input)
+		if err != nil {
+			printError(fail("parsing command", err))
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		line.AppendHistory(input)
+
+		handled, exit, err := runShellBuiltin(args)
+		if exit {
+			break
+		}
+		if !handled {
+			// Ctrl-C while a command runs stops that command, not the shell
+			stop := handleSignals()
+			err = runBatchStep(args)
+			stop()
+		}
+		if err != nil && err != errUsage {
+			printError(err)
+		}
+	}
+
+	if historyPath != "" {
+		if err := os.MkdirAll(filepath.Dir(historyPath), 0700); err != nil {
+			return fail("saving history", err)
+		}
+		file, err := os.OpenFile(historyPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return fail("saving history", err)
+		}
+		defer file.Close()
+		if _, err := line.WriteHistory(file); err != nil {
+			return fail("saving history", err)
+		}
+	}
+	return nil
+}
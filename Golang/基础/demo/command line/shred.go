@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"cmdline/fileops"
+)
+
+// logged before shredding, since overwriting a file in place cannot reach every copy of its data
+const shredWarning = "Shredding is best effort. SSDs, copy-on-write filesystems such as btrfs and ZFS, " +
+	"snapshots and backups may still hold the old contents."
+
+// overwrite a regular file on the file system on with random data,
+// flushing every pass to disk, then truncate and remove it
+func shredFile(on fileops.FS, path string, passes int) error {
+	info, err := on.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		// a read-only file is still ours to destroy
+		if err := on.Chmod(path, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+	}
+	file, err := on.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for range passes {
+		if err := canceled(cmdCtx); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(file, rand.Reader, info.Size()); err != nil {
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := on.Truncate(path, 0); err != nil {
+		return err
+	}
+	return on.Remove(path)
+}
+
+// shred a file, or with recursive every regular file under a directory
+// before removing it; symlinks are removed without touching their targets
+func shredPath(on fileops.FS, path string, recursive bool, passes int) error {
+	info, err := on.Lstat(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode().IsRegular():
+		return shredFile(on, path, passes)
+	case !info.IsDir():
+		return on.Remove(path)
+	case !recursive:
+		// only an empty directory; Remove reports anything else
+		return on.Remove(path)
+	}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			return shredFile(on, p, passes)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("shredding %s: %w", path, err)
+	}
+	return on.RemoveAll(path)
+}
+
+// shred what the journal saved of path, or of anything under or above it,
+// and forget the operations those copies were kept for, so the old
+// contents do not outlive the shred in the journal store; returns how many
+// operations were forgotten
+func shredJournalCopies(path string, passes int) (int, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := readJournal()
+	if err != nil {
+		return 0, err
+	}
+	overlaps := func(p string) bool {
+		return p != "" && (isWithin(abs, p) || isWithin(p, abs))
+	}
+	return rewriteJournal(entries, func(entry journalEntry) bool {
+		return entry.Saved == "" || !overlaps(entry.Path) && !overlaps(entry.Dest)
+	}, func(saved string) error {
+		return shredPath(fileops.OS, saved, true, passes)
+	})
+}
+
+// warn that the trash still holds earlier versions of a shredded path,
+// which shred leaves alone
+func warnTrashedCopies(path string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	entries, err := listTrash()
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if isWithin(abs, entry.OriginalPath) || isWithin(entry.OriginalPath, abs) {
+			logger().Warn("the trash still holds an earlier copy; remove it with empty-trash", "path", entry.OriginalPath, "id", entry.ID)
+		}
+	}
+}
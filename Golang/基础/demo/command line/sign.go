@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cmdline/fileops"
+)
+
+// signatures are made over the SHA-512 digest of a file (Ed25519ph), so
+// files of any size can be signed without reading them into memory
+var signOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+// suffix of detached signature files
+const signatureSuffix = ".sig"
+
+// result of verifying one file
+type verifyResult struct {
+	Path  string `json:"path"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// write a new key pair as PEM files NAME.key (private, owner only) and NAME.pub
+func generateKeys(name string) (string, string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", "", err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", "", err
+	}
+
+	privPath, pubPath := name+".key", name+".pub"
+	for _, path := range []string{privPath, pubPath} {
+		if exists(path) {
+			return "", "", fmt.Errorf("%s already exists", path)
+		}
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	if err := fileops.Write(cmdCtx, fsys, privPath, bytes.NewReader(privPEM), fileops.WriteOptions{Perm: 0600}); err != nil {
+		return "", "", err
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	if err := fileops.Write(cmdCtx, fsys, pubPath, bytes.NewReader(pubPEM), fileops.WriteOptions{Perm: 0644}); err != nil {
+		return "", "", err
+	}
+	return privPath, pubPath, nil
+}
+
+// read the PEM block from a key file
+func readPEM(path string, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %s", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// load an ed25519 private key written by keygen
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// load an ed25519 public key written by keygen
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return pub, nil
+}
+
+// SHA-512 digest of a file, the message that is actually signed
+func signingDigest(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hasher := sha512.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// sign a file and write the base64 signature next to it
+func signFile(path string, sigPath string, priv ed25519.PrivateKey) error {
+	digest, err := signingDigest(path)
+	if err != nil {
+		return err
+	}
+	sig, err := priv.Sign(nil, digest, signOptions)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sigPath, strings.NewReader(base64.StdEncoding.EncodeToString(sig)+"\n"))
+}
+
+// check a file against its detached signature
+func verifyFile(path string, sigPath string, pub ed25519.PublicKey) error {
+	data, err := os.ReadFile(sigPath)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("bad signature file %s: %w", sigPath, err)
+	}
+	digest, err := signingDigest(path)
+	if err != nil {
+		return err
+	}
+	if err := ed25519.VerifyWithOptions(pub, digest, sig, signOptions); err != nil {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// create a signing key pair
+func runKeygen(args []string) error {
+	flags := newFlagSet("keygen")
+	name := flags.String("o", "fileutil", "Base name of the key files; NAME.key and NAME.pub are written")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := confine(*name); err != nil {
+		return fail("generating keys", err)
+	}
+	privPath, pubPath, err := generateKeys(*name)
+	if err != nil {
+		return fail("generating keys", err)
+	}
+	printDone(opResult{Op: "keygen", Path: privPath, Dest: pubPath},
+		tr("Wrote private key %s and public key %s", privPath, pubPath))
+	return nil
+}
+
+// write detached signatures for files
+func runSign(args []string) error {
+	flags := newFlagSet("sign")
+	keyPath := flags.String("key", "", "Private key written by keygen (required)")
+	flags.Parse(args)
+	if flags.NArg() < 1 || *keyPath == "" {
+		flags.Usage()
+		return errUsage
+	}
+	if err := confine(*keyPath); err != nil {
+		return fail("loading key", err)
+	}
+	priv, err := loadPrivateKey(*keyPath)
+	if err != nil {
+		return fail("loading key", err)
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("signing file", err)
+	}
+
+	for _, path := range paths {
+		sigPath := path + signatureSuffix
+		if opts.DryRun {
+			plan, _ := planWrite("write", sigPath, int64(base64.StdEncoding.EncodedLen(ed25519.SignatureSize)+1))
+			printPlan(plan)
+			continue
+		}
+		if err := signFile(path, sigPath, priv); err != nil {
+			return fail("signing file", err)
+		}
+		printDone(opResult{Op: "sign", Path: path, Dest: sigPath}, tr("Signed %s: %s", path, sigPath))
+	}
+	return nil
+}
+
+// check files against their detached signatures
+func runVerify(args []string) error {
+	flags := newFlagSet("verify")
+	pubPath := flags.String("pub", "", "Public key written by keygen (required)")
+	sigPath := flags.String("sig", "", "Signature file, when verifying a single file (default: FILE.sig)")
+	flags.Parse(args)
+	if flags.NArg() < 1 || *pubPath == "" {
+		flags.Usage()
+		return errUsage
+	}
+	if *sigPath != "" && flags.NArg() > 1 {
+		return usageError("verifying signature", fmt.Errorf("-sig can only be used with a single file"))
+	}
+	if err := confine(*pubPath, *sigPath); err != nil {
+		return fail("loading key", err)
+	}
+	pub, err := loadPublicKey(*pubPath)
+	if err != nil {
+		return fail("loading key", err)
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("verifying signature", err)
+	}
+
+	var results []verifyResult
+	failed := 0
+	for _, path := range paths {
+		sig := *sigPath
+		if sig == "" {
+			sig = path + signatureSuffix
+		}
+		result := verifyResult{Path: path, Valid: true}
+		if err := verifyFile(path, sig, pub); err != nil {
+			result.Valid, result.Error = false, err.Error()
+			failed++
+		}
+		results = append(results, result)
+		if !opts.JSON {
+			if result.Valid {
+				printInfo("%s: OK\n", path)
+			} else {
+				fmt.Printf("%s: FAILED (%s)\n", path, result.Error)
+			}
+		}
+	}
+	if opts.JSON {
+		printJSON(results)
+	}
+	if failed > 0 {
+		return fail("verifying signature", fmt.Errorf("%d of %d files failed verification", failed, len(paths)))
+	}
+	return nil
+}
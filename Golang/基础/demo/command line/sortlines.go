@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// how much text sort keeps in memory before it spills sorted runs to
+// temporary files, and how many files one merge pass reads at once
+const (
+	defaultSortMemory = 64 << 20
+	mergeFanIn        = 64
+)
+
+// settings shared by sort and merge
+type sortOptions struct {
+	Numeric bool
+	Reverse bool
+	Unique  bool
+	Memory  int64  // bytes of lines sort holds before spilling
+	TempDir string // where spilled runs go
+}
+
+// add the flags sort and merge share
+func addSortFlags(flags *flag.FlagSet, o *sortOptions) {
+	flags.BoolVar(&o.Numeric, "n", false, "Compare the numbers lines start with instead of the text")
+	flags.BoolVar(&o.Reverse, "r", false, "Sort in reverse order")
+	flags.BoolVar(&o.Unique, "u", false, "Print only the first of lines that compare equal")
+}
+
+// the number a line starts with for -n; lines without one count as 0
+func leadingNumber(line string) float64 {
+	line = strings.TrimLeft(line, " \t")
+	end := 0
+	for end < len(line) && strings.IndexByte("+-0123456789.eE", line[end]) >= 0 {
+		end++
+	}
+	// back off until the prefix parses, so "12e" or "3-4" read as 12 and 3
+	for ; end > 0; end-- {
+		if n, err := strconv.ParseFloat(line[:end], 64); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// compare two lines by the sort key alone: their number with -n, or else
+// their bytes
+func (o sortOptions) compareKeys(a, b string) int {
+	if !o.Numeric {
+		return strings.Compare(a, b)
+	}
+	x, y := leadingNumber(a), leadingNumber(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compare two lines in output order; lines with equal numbers are ordered
+// by their bytes, except with -u, which keeps the one that came first
+func (o sortOptions) compare(a, b string) int {
+	c := o.compareKeys(a, b)
+	if c == 0 && o.Numeric && !o.Unique {
+		c = strings.Compare(a, b)
+	}
+	if o.Reverse {
+		return -c
+	}
+	return c
+}
+
+// a writer of sorted lines that drops repeats with -u
+type lineWriter struct {
+	w    *bufio.Writer
+	o    sortOptions
+	last *string
+}
+
+func newLineWriter(w io.Writer, o sortOptions) *lineWriter {
+	return &lineWriter{w: bufio.NewWriterSize(w, streamBufferSize), o: o}
+}
+
+func (l *lineWriter) write(line string) error {
+	if l.o.Unique && l.last != nil && l.o.compareKeys(*l.last, line) == 0 {
+		return nil
+	}
+	l.last = &line
+	if _, err := l.w.WriteString(line); err != nil {
+		return err
+	}
+	return l.w.WriteByte('\n')
+}
+
+func (l *lineWriter) flush() error {
+	return l.w.Flush()
+}
+
+// a reader of lines without their newline
+type lineReader struct {
+	r     *bufio.Reader
+	line  string
+	index int // position among the inputs of a merge
+}
+
+// read the next line into l.line, reporting false at the end
+func (l *lineReader) next() (bool, error) {
+	line, err := l.r.ReadString('\n')
+	if line == "" && err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	l.line = strings.TrimSuffix(line, "\n")
+	return true, nil
+}
+
+// the current lines of the inputs of a merge, smallest on top; of equal
+// lines the one from the earlier input comes first
+type mergeHeap struct {
+	o       sortOptions
+	readers []*lineReader
+}
+
+func (h *mergeHeap) Len() int { return len(h.readers) }
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := h.o.compare(h.readers[i].line, h.readers[j].line); c != 0 {
+		return c < 0
+	}
+	return h.readers[i].index < h.readers[j].index
+}
+func (h *mergeHeap) Swap(i, j int) { h.readers[i], h.readers[j] = h.readers[j], h.readers[i] }
+func (h *mergeHeap) Push(x any)    { h.readers = append(h.readers, x.(*lineReader)) }
+func (h *mergeHeap) Pop() any {
+	last := h.readers[len(h.readers)-1]
+	h.readers = h.readers[:len(h.readers)-1]
+	return last
+}
+
+// merge inputs that are each sorted already into w, holding one line of
+// each in memory
+func mergeSorted(w io.Writer, inputs []io.Reader, o sortOptions) error {
+	h := &mergeHeap{o: o}
+	for i, r := range inputs {
+		l := &lineReader{r: bufio.NewReaderSize(interruptible(cmdCtx, r), streamBufferSize), index: i}
+		ok, err := l.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.readers = append(h.readers, l)
+		}
+	}
+	heap.Init(h)
+	out := newLineWriter(w, o)
+	for h.Len() > 0 {
+		l := h.readers[0]
+		if err := out.write(l.line); err != nil {
+			return err
+		}
+		ok, err := l.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return out.flush()
+}
+
+// open files for reading, closing them all if one fails
+func openAll(paths []string) ([]io.Reader, func(), error) {
+	var files []io.ReadCloser
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	var readers []io.Reader
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+	return readers, closeAll, nil
+}
+
+// a sort that spills sorted runs of its lines to temporary files once
+// they outgrow the memory it may use, and merges the runs at the end
+type externalSort struct {
+	o     sortOptions
+	lines []string
+	size  int64
+	runs  []string // temporary files, each sorted
+}
+
+// add a line, spilling what is held when it grows too large
+func (s *externalSort) add(line string) error {
+	s.lines = append(s.lines, line)
+	// a string header on top of the text
+	s.size += int64(len(line)) + 16
+	if s.size < s.o.Memory {
+		return nil
+	}
+	return s.spill()
+}
+
+// write the lines held, sorted, to a new temporary file
+func (s *externalSort) spill() error {
+	slices.SortStableFunc(s.lines, s.o.compare)
+	file, err := os.CreateTemp(s.o.TempDir, "fileutil-sort-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file.Name())
+	printVerbose("spilled %d lines to %s\n", len(s.lines), file.Name())
+	out := newLineWriter(file, s.o)
+	for _, line := range s.lines {
+		if err := out.write(line); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := out.flush(); err != nil {
+		file.Close()
+		return err
+	}
+	s.lines, s.size = s.lines[:0], 0
+	return file.Close()
+}
+
+// merge runs mergeFanIn at a time until few enough are left to merge in
+// one pass, so the number of open files stays bounded; the merged run
+// takes the place of the ones it replaces, keeping the input order
+func (s *externalSort) reduceRuns() error {
+	for len(s.runs) > mergeFanIn {
+		group := s.runs[:mergeFanIn]
+		inputs, closeAll, err := openAll(group)
+		if err != nil {
+			return err
+		}
+		file, err := os.CreateTemp(s.o.TempDir, "fileutil-sort-*")
+		if err != nil {
+			closeAll()
+			return err
+		}
+		err = mergeSorted(file, inputs, s.o)
+		closeAll()
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		s.runs = append([]string{file.Name()}, s.runs[mergeFanIn:]...)
+		for _, run := range group {
+			os.Remove(run)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write every line added so far to w in order
+func (s *externalSort) finish(w io.Writer) error {
+	if len(s.runs) == 0 {
+		slices.SortStableFunc(s.lines, s.o.compare)
+		out := newLineWriter(w, s.o)
+		for _, line := range s.lines {
+			if err := out.write(line); err != nil {
+				return err
+			}
+		}
+		return out.flush()
+	}
+	if len(s.lines) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	if err := s.reduceRuns(); err != nil {
+		return err
+	}
+	inputs, closeAll, err := openAll(s.runs)
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+	return mergeSorted(w, inputs, s.o)
+}
+
+// remove the temporary files
+func (s *externalSort) cleanup() {
+	for _, run := range s.runs {
+		os.Remove(run)
+	}
+}
+
+// sort the lines of inputs into w
+func sortLines(w io.Writer, inputs []io.Reader, o sortOptions) error {
+	s := &externalSort{o: o}
+	defer s.cleanup()
+	for _, r := range inputs {
+		l := &lineReader{r: bufio.NewReaderSize(interruptible(cmdCtx, r), streamBufferSize)}
+		for {
+			ok, err := l.next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			if err := s.add(l.line); err != nil {
+				return err
+			}
+		}
+	}
+	return s.finish(w)
+}
+
+// the inputs of sort or merge: the named files, or stdin for none or -
+func lineInputs(args []string) ([]io.Reader, func(), error) {
+	if len(args) == 0 {
+		return []io.Reader{os.Stdin}, func() {}, nil
+	}
+	var readers []io.Reader
+	var files []io.Closer
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for _, path := range args {
+		if path == "-" {
+			readers = append(readers, os.Stdin)
+			continue
+		}
+		file, err := fsys.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+	return readers, closeAll, nil
+}
+
+// run sort or merge: read the inputs and write the result to -o or stdout
+func runLines(name string, action string, args []string, arrange func(io.Writer, []io.Reader, sortOptions) error) error {
+	flags := newFlagSet(name)
+	o := sortOptions{Memory: defaultSortMemory}
+	addSortFlags(flags, &o)
+	output := flags.String("o", "", "File to write (default: stdout); it may be one of the inputs")
+	force := flags.Bool("force", false, "Overwrite the output file if it exists")
+	if name == "sort" {
+		flags.Func("memory", "Sort this much in memory before spilling sorted runs to temporary files, e.g. 256M (default 64M)", func(text string) error {
+			size, err := parseSize(text)
+			if err == nil && size <= 0 {
+				err = fmt.Errorf("memory must be above 0")
+			}
+			o.Memory = size
+			return err
+		})
+		flags.StringVar(&o.TempDir, "temp-dir", "", "Directory for the temporary files of large sorts (default: the system's)")
+	}
+	flags.Parse(args)
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail(action, err)
+	}
+	if err := confine(*output); err != nil {
+		return fail(action, err)
+	}
+	inputs, closeAll, err := lineInputs(paths)
+	if err != nil {
+		return fail(action, err)
+	}
+	defer closeAll()
+
+	result := opResult{Op: name, Path: strings.Join(paths, " "), Dest: *output}
+	err = writeOutput(&result, *output, *force, func(w io.Writer) error {
+		return arrange(w, inputs, o)
+	})
+	if err != nil {
+		return fail(action, err)
+	}
+	switch {
+	case *output == "":
+	case result.DryRun:
+		printDone(result, tr("Would write the %s result to %s", tr(name), *output))
+	default:
+		printDone(result, tr("Wrote the %s result to %s", tr(name), *output))
+	}
+	return nil
+}
+
+// sort the lines of files or stdin
+func runSort(args []string) error {
+	return runLines("sort", "sorting lines", args, sortLines)
+}
+
+// merge files that are each sorted already
+func runMerge(args []string) error {
+	return runLines("merge", "merging files", args, mergeSorted)
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// holes cannot be found on other platforms, so sparse copies fall back to
+// copying everything
+func nextData(f *os.File, off int64) (int64, int64, error) {
+	return 0, 0, errors.ErrUnsupported
+}
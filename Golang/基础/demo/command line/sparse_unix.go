@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// find the next run of data in f at or after off with SEEK_DATA and
+// SEEK_HOLE; io.EOF means only holes are left
+func nextData(f *os.File, off int64) (int64, int64, error) {
+	data, err := f.Seek(off, unix.SEEK_DATA)
+	if errors.Is(err, unix.ENXIO) {
+		return 0, 0, io.EOF
+	}
+	if errors.Is(err, unix.EINVAL) {
+		return 0, 0, errors.ErrUnsupported
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	hole, err := f.Seek(data, unix.SEEK_HOLE)
+	if err != nil {
+		return 0, 0, err
+	}
+	return data, hole, nil
+}
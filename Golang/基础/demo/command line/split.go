@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// name of the n-th chunk of a split file, counting from 1
+func chunkName(base string, n int) string {
+	return fmt.Sprintf("%s.%03d", base, n)
+}
+
+// name of the checksum file written next to the chunks
+func chunkManifestName(base string) string {
+	return base + ".sha256"
+}
+
+// reader that hashes what passes through it and fails at EOF if the digest is wrong
+type verifyingReader struct {
+	r      io.Reader
+	hasher hash.Hash
+	want   string
+	name   string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hasher.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(v.hasher.Sum(nil)); got != v.want {
+			return n, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", v.name, v.want, got)
+		}
+	}
+	return n, err
+}
+
+// wrap r so that reading it to the end checks its digest
+func newVerifyingReader(r io.Reader, want string, name string) io.Reader {
+	hasher, _ := newHasher(defaultHashAlgo)
+	return &verifyingReader{r, hasher, want, name}
+}
+
+// break a file into chunks of at most size bytes in dir, and write a checksum
+// file listing every chunk and the original
+func splitFile(path string, size int64, dir string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Join(dir, filepath.Base(path))
+	whole, _ := newHasher(defaultHashAlgo)
+	var chunks []string
+	var manifest strings.Builder
+	for n, remaining := 1, info.Size(); n == 1 || remaining > 0; n++ {
+		name := chunkName(base, n)
+		part, _ := newHasher(defaultHashAlgo)
+		r := io.TeeReader(io.LimitReader(file, size), io.MultiWriter(whole, part))
+		if err := writeFileAtomic(name, r); err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, name)
+		fmt.Fprintf(&manifest, "%x  %s\n", part.Sum(nil), filepath.Base(name))
+		remaining -= size
+	}
+	fmt.Fprintf(&manifest, "%x  %s\n", whole.Sum(nil), filepath.Base(path))
+	if err := writeFileAtomic(chunkManifestName(base), strings.NewReader(manifest.String())); err != nil {
+		return chunks, err
+	}
+	return chunks, nil
+}
+
+// reassemble the chunks of base into dest, checking every chunk and the
+// result against the checksum file when there is one
+func joinFile(base string, dest string) (int, error) {
+	sums, err := readChecksums(chunkManifestName(base))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	var readers []io.Reader
+	for n := 1; ; n++ {
+		name := chunkName(base, n)
+		file, err := os.Open(name)
+		if os.IsNotExist(err) && n > 1 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+
+		var r io.Reader = file
+		if sums != nil {
+			want, ok := sums[filepath.Base(name)]
+			if !ok {
+				return 0, fmt.Errorf("%s is not listed in %s", name, chunkManifestName(base))
+			}
+			r = newVerifyingReader(r, want, name)
+		}
+		readers = append(readers, r)
+	}
+	var joined io.Reader = io.MultiReader(readers...)
+	if want, ok := sums[filepath.Base(base)]; ok {
+		if len(sums) != len(readers)+1 {
+			return 0, fmt.Errorf("expected %d chunks, found %d", len(sums)-1, len(readers))
+		}
+		joined = newVerifyingReader(joined, want, dest)
+	}
+	return len(readers), writeFileAtomic(dest, joined)
+}
+
+// break a large file into numbered chunks
+func runSplit(args []string) error {
+	flags := newFlagSet("split")
+	sizeText := flags.String("size", "", "Maximum size of each chunk, such as 100MB (required)")
+	dir := flags.String("dir", "", "Directory to write the chunks to (default: next to the file)")
+	flags.Parse(args)
+	if flags.NArg() != 1 || *sizeText == "" {
+		flags.Usage()
+		return errUsage
+	}
+	size, err := parseSize(*sizeText)
+	if err != nil {
+		return usageError("splitting file", err)
+	}
+	if size <= 0 {
+		return usageError("splitting file", fmt.Errorf("-size must be positive"))
+	}
+
+	path := flags.Arg(0)
+	if *dir == "" {
+		*dir = filepath.Dir(path)
+	}
+	if err := confine(path, *dir); err != nil {
+		return fail("splitting file", err)
+	}
+	if opts.DryRun {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fail("splitting file", err)
+		}
+		base := filepath.Join(*dir, filepath.Base(path))
+		for n, remaining := 1, info.Size(); n == 1 || remaining > 0; n++ {
+			plan, _ := planWrite("write", chunkName(base, n), min(size, remaining))
+			printPlan(plan)
+			remaining -= size
+		}
+		return nil
+	}
+
+	chunks, err := splitFile(path, size, *dir)
+	if err != nil {
+		return fail("splitting file", err)
+	}
+	printDone(opResult{Op: "split", Path: path, Dest: *dir},
+		tr("File split into %d chunks: %s ... %s", len(chunks), chunks[0], chunks[len(chunks)-1]))
+	return nil
+}
+
+// reassemble a file from chunks written by split
+func runJoin(args []string) error {
+	flags := newFlagSet("join")
+	output := flags.String("o", "", "File to write (default: the name the chunks were split from)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	// accept either the original name or the name of the first chunk
+	base := strings.TrimSuffix(flags.Arg(0), ".001")
+	dest := *output
+	if dest == "" {
+		dest = base
+	}
+	if err := confine(base, dest); err != nil {
+		return fail("joining file", err)
+	}
+	if opts.DryRun {
+		size, err := treeSize(chunkName(base, 1))
+		if err != nil {
+			return fail("joining file", err)
+		}
+		for n := 2; exists(chunkName(base, n)); n++ {
+			chunk, _ := treeSize(chunkName(base, n))
+			size += chunk
+		}
+		plan, _ := planWrite("write", dest, size)
+		printPlan(plan)
+		return nil
+	}
+
+	count, err := joinFile(base, dest)
+	if err != nil {
+		return fail("joining file", err)
+	}
+	printDone(opResult{Op: "join", Path: base, Dest: dest},
+		tr("Joined %d chunks into %s", count, dest))
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// metadata reported by stat
+type fileStat struct {
+	Path       string     `json:"path"`
+	Type       string     `json:"type"`
+	Size       int64      `json:"size"`
+	Mode       string     `json:"mode"`
+	Perm       string     `json:"perm"`
+	ModTime    time.Time  `json:"mtime"`
+	AccessTime *time.Time `json:"atime,omitempty"`
+	ChangeTime *time.Time `json:"ctime,omitempty"`
+	BirthTime  *time.Time `json:"btime,omitempty"`
+	UID        *int       `json:"uid,omitempty"`
+	GID        *int       `json:"gid,omitempty"`
+	Owner      string     `json:"owner,omitempty"`
+	Group      string     `json:"group,omitempty"`
+	LinkTarget string     `json:"link_target,omitempty"`
+}
+
+// collect metadata for a path; a final symlink is reported as a link
+// unless follow is set, in which case its target is described
+func statFile(path string, follow bool) (fileStat, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return fileStat{}, err
+		}
+		if follow {
+			if info, err = os.Stat(path); err != nil {
+				return fileStat{}, err
+			}
+		}
+	}
+
+	st := fileStat{
+		Path:       path,
+		Type:       fileType(info.Mode()),
+		Size:       info.Size(),
+		Mode:       info.Mode().String(),
+		Perm:       fmt.Sprintf("%04o", info.Mode().Perm()),
+		ModTime:    info.ModTime(),
+		LinkTarget: link,
+	}
+	fillPlatformStat(&st, info)
+	return st, nil
+}
+
+// short name for the kind of file a mode describes
+func fileType(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "directory"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	default:
+		return "other"
+	}
+}
+
+// human readable form of the metadata
+func (st fileStat) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  File: %s", st.Path)
+	if st.LinkTarget != "" {
+		fmt.Fprintf(&b, " -> %s", st.LinkTarget)
+	}
+	fmt.Fprintf(&b, "\n  Type: %s\n  Size: %d\n  Mode: %s (%s)\n", st.Type, st.Size, st.Mode, st.Perm)
+	if st.UID != nil {
+		fmt.Fprintf(&b, " Owner: %s (%d)\n Group: %s (%d)\n", st.Owner, *st.UID, st.Group, *st.GID)
+	}
+	fmt.Fprintf(&b, "Modify: %s\n", st.ModTime.Format(time.RFC3339))
+	for _, t := range []struct {
+		label string
+		value *time.Time
+	}{{"Access", st.AccessTime}, {"Change", st.ChangeTime}, {" Birth", st.BirthTime}} {
+		if t.value != nil {
+			fmt.Fprintf(&b, "%s: %s\n", t.label, t.value.Format(time.RFC3339))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// add owner, group and the extra timestamps from the Darwin stat structure
+func fillPlatformStat(st *fileStat, info os.FileInfo) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	atime := time.Unix(sys.Atimespec.Unix())
+	ctime := time.Unix(sys.Ctimespec.Unix())
+	btime := time.Unix(sys.Birthtimespec.Unix())
+	st.AccessTime, st.ChangeTime, st.BirthTime = &atime, &ctime, &btime
+	fillOwner(st, int(sys.Uid), int(sys.Gid))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// add owner, group and the extra timestamps from the Linux stat structure;
+// the birth time is only in statx, and only on filesystems that record it
+func fillPlatformStat(st *fileStat, info os.FileInfo) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	atime := time.Unix(sys.Atim.Unix())
+	ctime := time.Unix(sys.Ctim.Unix())
+	st.AccessTime, st.ChangeTime = &atime, &ctime
+	fillOwner(st, int(sys.Uid), int(sys.Gid))
+
+	// info describes the link itself only when the link was not followed
+	flags := 0
+	if info.Mode()&fs.ModeSymlink != 0 {
+		flags = unix.AT_SYMLINK_NOFOLLOW
+	}
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, st.Path, flags, unix.STATX_BTIME, &stx); err == nil && stx.Mask&unix.STATX_BTIME != 0 {
+		btime := time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+		st.BirthTime = &btime
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "os"
+
+// no extra metadata is collected on other platforms
+func fillPlatformStat(st *fileStat, info os.FileInfo) {}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// record numeric ids and, where they resolve, user and group names
+func fillOwner(st *fileStat, uid int, gid int) {
+	st.UID, st.GID = &uid, &gid
+	st.Owner, st.Group = strconv.Itoa(uid), strconv.Itoa(gid)
+	if u, err := user.LookupId(st.Owner); err == nil {
+		st.Owner = u.Username
+	}
+	if g, err := user.LookupGroupId(st.Group); err == nil {
+		st.Group = g.Name
+	}
+}
+
+// numeric owner and group of a file
+func ownerIDs(info fs.FileInfo) (int, int, bool) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(sys.Uid), int(sys.Gid), true
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// add the access and creation times Windows keeps for every file
+func fillPlatformStat(st *fileStat, info os.FileInfo) {
+	sys, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return
+	}
+	atime := time.Unix(0, sys.LastAccessTime.Nanoseconds())
+	btime := time.Unix(0, sys.CreationTime.Nanoseconds())
+	st.AccessTime, st.BirthTime = &atime, &btime
+}
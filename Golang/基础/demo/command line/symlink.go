@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"cmdline/fileops"
+)
+
+// a symlink and what it points to, as printed by readlink and resolve
+type linkInfo struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// register -follow and -no-follow, which both set *follow; the caller
+// sets the command's default before calling
+func addFollowFlags(flags *flag.FlagSet, follow *bool) {
+	def := map[bool]string{true: " (default)", false: ""}
+	flags.BoolFunc("follow", "Act on the files symlinks point to"+def[*follow], func(string) error {
+		*follow = true
+		return nil
+	})
+	flags.BoolFunc("no-follow", "Act on symlinks themselves"+def[!*follow], func(string) error {
+		*follow = false
+		return nil
+	})
+}
+
+// report whether path is a symlink, without following it
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&fs.ModeSymlink != 0
+}
+
+// recreate the symlink src at dest on the file system on, pointing to the
+// same target
+func copyLink(on fileops.FS, src string, dest string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if isSymlink(dest) {
+		if err := on.Remove(dest); err != nil {
+			return err
+		}
+	}
+	return on.Symlink(target, dest)
+}
+
+// the absolute path with every symlink along it resolved
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// replace listing entries for symlinks with what they point to; links
+// whose target is missing are kept as they are
+func followLinks(files []fileEntry) []fileEntry {
+	for i, file := range files {
+		if !file.IsLink {
+			continue
+		}
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			continue
+		}
+		followed := newFileEntry(file.Name, file.Path, info)
+		followed.IsLink, followed.Target = true, file.Target
+		files[i] = followed
+	}
+	return files
+}
+
+// create a symbolic link
+func runSymlink(args []string) error {
+	flags := newFlagSet("symlink")
+	force := flags.Bool("force", false, "Replace LINK if it already exists and is not a directory")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	target, link := flags.Arg(0), flags.Arg(1)
+	// the link must stay inside the root and so must what it points to
+	pointsTo := target
+	if !filepath.IsAbs(target) {
+		pointsTo = filepath.Join(filepath.Dir(link), target)
+	}
+	if err := confine(link, pointsTo); err != nil {
+		return fail("creating symlink", err)
+	}
+
+	info, err := os.Lstat(link)
+	switch {
+	case err == nil && (!*force || info.IsDir()):
+		return fail("creating symlink", fmt.Errorf("%s already exists", link))
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return fail("creating symlink", err)
+	}
+	if opts.DryRun {
+		printPlan(opResult{Op: "symlink", Path: link, Dest: target, DryRun: true, Overwrite: err == nil})
+		return nil
+	}
+
+	// journaled as a symlink, since it replaces the link itself rather
+	// than what it points to
+	entry, err := journalPrepare("symlink", link, "")
+	if err != nil {
+		return fail("journaling symlink", err)
+	}
+	err = func() error {
+		if *force && exists(link) {
+			if err := fsys.Remove(link); err != nil {
+				return err
+			}
+		}
+		return fsys.Symlink(target, link)
+	}()
+	if err := journalFinish(entry, err); err != nil {
+		return fail("creating symlink", err)
+	}
+	printDone(opResult{Op: "symlink", Path: link, Dest: target}, tr("Symlink created: %s -> %s", link, target))
+	return nil
+}
+
+// create a hard link
+func runHardlink(args []string) error {
+	flags := newFlagSet("hardlink")
+	force := flags.Bool("force", false, "Replace LINK if it already exists and is not a directory")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	target, link := flags.Arg(0), flags.Arg(1)
+	if err := confine(target, link); err != nil {
+		return fail("creating hard link", err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return fail("creating hard link", err)
+	}
+	if info.IsDir() {
+		return fail("creating hard link", fmt.Errorf("%s is a directory", target))
+	}
+	linkInfo, err := os.Lstat(link)
+	switch {
+	case err == nil && (!*force || linkInfo.IsDir()):
+		return fail("creating hard link", fmt.Errorf("%s already exists", link))
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return fail("creating hard link", err)
+	}
+	if opts.DryRun {
+		printPlan(opResult{Op: "hardlink", Path: target, Dest: link, DryRun: true, Bytes: info.Size(), Overwrite: err == nil})
+		return nil
+	}
+
+	// replaceWithLink also works for a new name
+	if err := replaceWithLink(target, link); err != nil {
+		return fail("creating hard link", err)
+	}
+	printDone(opResult{Op: "hardlink", Path: target, Dest: link}, tr("Hard link created: %s => %s", link, target))
+	return nil
+}
+
+// print the target of symlinks
+func runReadlink(args []string) error {
+	flags := newFlagSet("readlink")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	if err := confine(flags.Args()...); err != nil {
+		return fail("reading symlink", err)
+	}
+	var links []linkInfo
+	for _, path := range flags.Args() {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fail("reading symlink", err)
+		}
+		links = append(links, linkInfo{Path: path, Target: target})
+		if !opts.JSON {
+			fmt.Println(target)
+		}
+	}
+	if opts.JSON {
+		printJSON(links)
+	}
+	return nil
+}
+
+// print the physical path of files, with every symlink resolved
+func runResolve(args []string) error {
+	flags := newFlagSet("resolve")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	if err := confine(flags.Args()...); err != nil {
+		return fail("resolving path", err)
+	}
+	var resolved []linkInfo
+	for _, path := range flags.Args() {
+		target, err := resolvePath(path)
+		if err != nil {
+			return fail("resolving path", err)
+		}
+		resolved = append(resolved, linkInfo{Path: path, Target: target})
+		if !opts.JSON {
+			fmt.Println(target)
+		}
+	}
+	if opts.JSON {
+		printJSON(resolved)
+	}
+	return nil
+}
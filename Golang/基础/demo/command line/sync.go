@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// modification times closer than this are treated as equal, since
+// filesystems store them with different precision
+const mtimeTolerance = time.Second
+
+// one change needed to make the destination mirror the source
+type syncAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+}
+
+// how sync decides what to change
+type syncOptions struct {
+	Hash        bool
+	DeleteExtra bool
+	Jobs        int
+	// files left out of the source are neither copied nor deleted from the destination
+	Filter *treeFilter
+}
+
+// counts of the actions a sync took
+type syncSummary struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+}
+
+// compare src and dst and list what must change, with paths relative to the roots
+func planSync(src string, dst string, o syncOptions) ([]syncAction, syncSummary, error) {
+	var actions []syncAction
+	var summary syncSummary
+	cases := newCaseCollisions(dst)
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if o.Filter.excluded(src, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target, err := fileops.SafeJoin(dst, rel)
+		if err != nil {
+			return err
+		}
+		cases.add(target)
+		targetInfo, statErr := os.Stat(target)
+
+		if d.IsDir() {
+			if statErr != nil {
+				actions = append(actions, syncAction{"mkdir", rel})
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if statErr != nil {
+			actions = append(actions, syncAction{"create", rel})
+			summary.Created++
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		same, err := sameContent(path, info, target, targetInfo, o.Hash)
+		if err != nil {
+			return err
+		}
+		if same {
+			summary.Unchanged++
+		} else {
+			actions = append(actions, syncAction{"update", rel})
+			summary.Updated++
+		}
+		return nil
+	})
+	if err != nil || !o.DeleteExtra {
+		return actions, summary, err
+	}
+
+	err = filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if o.Filter.excluded(src, filepath.Join(src, rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(src, rel)); os.IsNotExist(err) {
+			actions = append(actions, syncAction{"delete", rel})
+			summary.Deleted++
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return actions, summary, err
+}
+
+// report whether two files hold the same data, by size and mtime or by digest
+func sameContent(srcPath string, srcInfo fs.FileInfo, dstPath string, dstInfo fs.FileInfo, useHash bool) (bool, error) {
+	if dstInfo.IsDir() || srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+	if !useHash {
+		diff := srcInfo.ModTime().Sub(dstInfo.ModTime())
+		return diff.Abs() < mtimeTolerance, nil
+	}
+	srcSum, err := hashFile(srcPath, defaultHashAlgo)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := hashFile(dstPath, defaultHashAlgo)
+	if err != nil {
+		return false, err
+	}
+	return srcSum == dstSum, nil
+}
+
+// carry out planned sync actions, keeping source modification times on
+// copies; directories and deletions are handled first, then jobs files are
+// copied at once
+func applySync(src string, dst string, actions []syncAction, jobs int) error {
+	var copies []syncAction
+	var total int64
+	for _, action := range actions {
+		if err := canceled(cmdCtx); err != nil {
+			return err
+		}
+		from := filepath.Join(src, action.Path)
+		// removing a symlink does not follow it, so for a delete only the
+		// directory it is in has to stay inside dst
+		checked := action.Path
+		if action.Action == "delete" {
+			checked = filepath.Dir(action.Path)
+		}
+		if _, err := fileops.SafeJoin(dst, checked); err != nil {
+			return err
+		}
+		to := filepath.Join(dst, action.Path)
+		switch action.Action {
+		case "mkdir":
+			info, err := os.Stat(from)
+			if err != nil {
+				return err
+			}
+			if err := fsys.MkdirAll(to, info.Mode().Perm()); err != nil {
+				return err
+			}
+		case "create", "update":
+			if action.Action == "update" {
+				if err := auditChange(auditRecord{Op: "overwrite", Path: from, Dest: to}, "", to); err != nil {
+					return fmt.Errorf("writing audit log: %w", err)
+				}
+			}
+			copies = append(copies, action)
+			total += totalSize(from)
+		case "delete":
+			if err := auditChange(auditRecord{Op: "delete", Path: to}, to, ""); err != nil {
+				return fmt.Errorf("writing audit log: %w", err)
+			}
+			if err := fsys.RemoveAll(to); err != nil {
+				return err
+			}
+		}
+	}
+
+	p := startProgress("sync", total)
+	defer p.finish()
+	return runPool(cmdCtx, jobs, len(copies), func(i int) error {
+		action := copies[i]
+		from := filepath.Join(src, action.Path)
+		to, err := fileops.SafeJoin(dst, action.Path)
+		if err != nil {
+			return err
+		}
+		if err := fsys.RemoveAll(to); err != nil && action.Action == "update" {
+			return err
+		}
+		if err := copyFileProgress(from, to, p); err != nil {
+			return err
+		}
+		info, err := os.Stat(from)
+		if err != nil {
+			return err
+		}
+		return fsys.Chtimes(to, info.ModTime(), info.ModTime())
+	})
+}
+
+// sync two directories in both directions
+func runBisync(a string, b string, statePath string, prefer string) error {
+	policies := map[string]string{"": "", "newer": "newer", "src": "a", "dst": "b"}
+	policy, ok := policies[prefer]
+	if !ok {
+		return usageError("syncing directories", fmt.Errorf("unknown -prefer %q (use newer, src or dst)", prefer))
+	}
+	for _, dir := range []string{a, b} {
+		if err := fsys.MkdirAll(dir, 0755); err != nil {
+			return fail("syncing directories", err)
+		}
+	}
+	if statePath == "" {
+		var err error
+		if statePath, err = defaultBisyncState(a, b); err != nil {
+			return fail("syncing directories", err)
+		}
+	}
+	state, err := loadBisyncState(statePath)
+	if err != nil {
+		return fail("syncing directories", err)
+	}
+
+	actions, next, err := bisync(a, b, state, policy, opts.DryRun)
+	if err != nil {
+		return fail("syncing directories", err)
+	}
+	if !opts.DryRun {
+		if err := saveBisyncState(statePath, next); err != nil {
+			return fail("saving sync state", err)
+		}
+	}
+
+	conflicts := 0
+	for _, action := range actions {
+		if action.Action == "conflict" {
+			conflicts++
+		}
+	}
+	if opts.JSON {
+		printJSON(struct {
+			DryRun    bool           `json:"dry_run,omitempty"`
+			Actions   []bisyncAction `json:"actions"`
+			Conflicts int            `json:"conflicts"`
+		}{opts.DryRun, actions, conflicts})
+	} else if formatting() {
+		for _, action := range actions {
+			if err := printFormatted(action); err != nil {
+				return fail("formatting output", err)
+			}
+		}
+	} else {
+		for _, action := range actions {
+			if action.Detail != "" {
+				printInfo("%-15s %s (%s)\n", action.Action, action.Path, action.Detail)
+			} else {
+				printInfo("%-15s %s\n", action.Action, action.Path)
+			}
+		}
+		printInfo("Two-way sync of %s and %s: %d changes, %d conflicts\n", a, b, len(actions)-conflicts, conflicts)
+	}
+	if conflicts > 0 {
+		return fail("syncing directories", fmt.Errorf("%d conflicts left unresolved (use -prefer to pick a side)", conflicts))
+	}
+	return nil
+}
+
+// make a destination directory mirror a source directory
+func runSync(args []string) error {
+	flags := newFlagSet("sync")
+	var o syncOptions
+	flags.BoolVar(&o.Hash, "hash", false, "Compare file contents by checksum instead of size and modification time")
+	flags.BoolVar(&o.DeleteExtra, "delete-extra", false, "Delete destination files that are not in the source")
+	addBwlimitFlag(flags)
+	addCopyTuningFlags(flags)
+	flags.IntVar(&o.Jobs, "jobs", cfg.Jobs, "Number of files to copy at once; with more than one, every failure is reported instead of stopping at the first")
+	twoWay := flags.Bool("two-way", false, "Propagate changes in both directions using the state of the previous run")
+	statePath := flags.String("state", "", "State file for -two-way (default: one per directory pair in the fileutil data directory)")
+	prefer := flags.String("prefer", "", "Resolve -two-way conflicts automatically: newer, src or dst")
+	o.Filter = addTreeFilterFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	for _, name := range []string{"state", "prefer"} {
+		if err := requireFlags(flags, name, "two-way"); err != nil {
+			return usageError("syncing directories", err)
+		}
+	}
+	// two-way sync has its own rules for what to copy and delete
+	for _, name := range []string{"delete-extra", "hash", "jobs", "include", "exclude", "no-ignore"} {
+		if err := exclusiveFlags(flags, "two-way", name); err != nil {
+			return usageError("syncing directories", err)
+		}
+	}
+	if o.Jobs < 1 {
+		return usageError("syncing directories", fmt.Errorf("-jobs must be at least 1"))
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+	if err := confine(src, dst, *statePath); err != nil {
+		return fail("syncing directories", err)
+	}
+	if err := checkNotInside(src, dst); err != nil {
+		return fail("syncing directories", err)
+	}
+	if *twoWay {
+		if err := checkNotInside(dst, src); err != nil {
+			return fail("syncing directories", err)
+		}
+		return runBisync(src, dst, *statePath, *prefer)
+	}
+
+	if info, err := os.Stat(src); err != nil {
+		return fail("syncing directories", err)
+	} else if !info.IsDir() {
+		return usageError("syncing directories", fmt.Errorf("%s is not a directory", src))
+	}
+	actions, summary, err := planSync(src, dst, o)
+	if err != nil {
+		return fail("syncing directories", err)
+	}
+	if !opts.DryRun {
+		if err := fsys.MkdirAll(dst, 0755); err != nil {
+			return fail("syncing directories", err)
+		}
+		if err := applySync(src, dst, actions, o.Jobs); err != nil {
+			return fail("syncing directories", err)
+		}
+	}
+
+	if opts.JSON {
+		printJSON(struct {
+			DryRun  bool         `json:"dry_run,omitempty"`
+			Actions []syncAction `json:"actions"`
+			Summary syncSummary  `json:"summary"`
+		}{opts.DryRun, actions, summary})
+		return nil
+	}
+	if formatting() {
+		for _, action := range actions {
+			if err := printFormatted(action); err != nil {
+				return fail("formatting output", err)
+			}
+		}
+		return nil
+	}
+	for _, action := range actions {
+		printInfo("%-6s %s\n", action.Action, action.Path)
+	}
+	verb := tr("Synced")
+	if opts.DryRun {
+		verb = tr("Would sync")
+	}
+	printInfo("%s %s to %s: %d created, %d updated, %d deleted, %d unchanged\n",
+		verb, src, dst, summary.Created, summary.Updated, summary.Deleted, summary.Unchanged)
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// settings for read -table
+type tableOptions struct {
+	Rows      int
+	Columns   string // names or 1-based numbers, comma separated
+	Delimiter rune   // 0 to detect it
+	Header    string // auto, yes or no
+}
+
+// widest a column is shown before its cells are cut short
+const maxColumnWidth = 40
+
+// add the read -table flags to flags
+func addTableFlags(flags *flag.FlagSet, o *tableOptions) {
+	flags.IntVar(&o.Rows, "rows", 20, "With -table, show the first N rows")
+	flags.StringVar(&o.Columns, "columns", "", "With -table, show only these columns, by header name or number from 1, e.g. name,3")
+	flags.Func("delimiter", `With -table, the field separator, such as , ; | or \t (default: detected)`, func(text string) error {
+		if text == `\t` || text == "tab" {
+			text = "\t"
+		}
+		if len([]rune(text)) != 1 {
+			return fmt.Errorf("give a single character")
+		}
+		o.Delimiter = []rune(text)[0]
+		return nil
+	})
+	o.Header = "auto"
+	flags.Func("header", "With -table, whether the first row names the columns: auto, yes or no (default auto)", func(text string) error {
+		if text != "auto" && text != "yes" && text != "no" {
+			return fmt.Errorf("use auto, yes or no")
+		}
+		o.Header = text
+		return nil
+	})
+}
+
+// the delimiters detection picks from
+const tableDelimiters = ",\t;|"
+
+// guess the delimiter of delimited text from its first lines: .tsv files
+// use tabs, and otherwise the candidate found the same number of times on
+// the most lines, outside quotes, wins; comma when none is
+func detectDelimiter(path string, head []byte) rune {
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		return '\t'
+	}
+	lines := strings.Split(string(head), "\n")
+	if len(lines) > 1 {
+		// the last one may be cut short
+		lines = lines[:len(lines)-1]
+	}
+	lines = lines[:min(len(lines), 20)]
+	best, bestScore := ',', 0
+	for _, d := range tableDelimiters {
+		counts := map[int]int{}
+		for _, line := range lines {
+			n, quoted := 0, false
+			for _, r := range line {
+				switch {
+				case r == '"':
+					quoted = !quoted
+				case r == d && !quoted:
+					n++
+				}
+			}
+			if n > 0 {
+				counts[n]++
+			}
+		}
+		for _, lines := range counts {
+			if lines > bestScore {
+				best, bestScore = d, lines
+			}
+		}
+	}
+	return best
+}
+
+// report whether a cell holds a number
+func isNumeric(cell string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+	return err == nil
+}
+
+// guess whether the first row names the columns, as Python's csv.Sniffer
+// does: a column of numbers under text, or of values of one length under
+// a name of another, votes for a header. Empty cells say nothing.
+func detectHeader(rows [][]string) bool {
+	if len(rows) < 2 {
+		return false
+	}
+	votes := 0
+	for col, name := range rows[0] {
+		numeric, length := true, -1
+		for _, row := range rows[1:] {
+			if col >= len(row) || row[col] == "" {
+				continue
+			}
+			numeric = numeric && isNumeric(row[col])
+			switch n := len(row[col]); {
+			case length == -1:
+				length = n
+			case length != n:
+				length = -2
+			}
+		}
+		switch {
+		case length == -1:
+			// nothing but empty cells
+		case numeric:
+			if isNumeric(name) {
+				votes--
+			} else {
+				votes++
+			}
+		case length >= 0:
+			if len(name) != length {
+				votes++
+			} else {
+				votes--
+			}
+		}
+	}
+	return votes > 0
+}
+
+// the indices of the columns -columns picks, by header name or number
+func selectColumns(spec string, header []string, width int) ([]int, error) {
+	if spec == "" {
+		all := make([]int, width)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	var picked []int
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		found := -1
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				found = i
+				break
+			}
+		}
+		if n, err := strconv.Atoi(name); found < 0 && err == nil && n >= 1 && n <= width {
+			found = n - 1
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("no column %q (give a header name or a number from 1 to %d)", name, width)
+		}
+		picked = append(picked, found)
+	}
+	return picked, nil
+}
+
+// the first rows of a delimited file, ready to print
+type tablePreview struct {
+	Path    string     `json:"path"`
+	Columns []string   `json:"columns,omitempty"`
+	Rows    [][]string `json:"rows"`
+	More    bool       `json:"more"` // rows were left out
+}
+
+// read the header and the first o.Rows rows of a CSV or TSV file,
+// without reading the rest of it
+func previewTable(path string, o tableOptions) (tablePreview, error) {
+	preview := tablePreview{Path: path, Rows: [][]string{}}
+	file, err := fsys.Open(path)
+	if err != nil {
+		return preview, err
+	}
+	defer file.Close()
+	buffered := bufio.NewReaderSize(interruptible(cmdCtx, file), streamBufferSize)
+	head, _ := buffered.Peek(streamBufferSize)
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = o.Delimiter
+	if reader.Comma == 0 {
+		reader.Comma = detectDelimiter(path, head)
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	// one row more than shown tells whether any were left out, and the
+	// first may turn out to be the header
+	var rows [][]string
+	for len(rows) < o.Rows+2 {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return preview, err
+		}
+		rows = append(rows, record)
+	}
+	if len(rows) > 0 && (o.Header == "yes" || o.Header == "auto" && detectHeader(rows)) {
+		preview.Columns, rows = rows[0], rows[1:]
+	}
+	if len(rows) > o.Rows {
+		preview.More, rows = true, rows[:o.Rows]
+	}
+
+	width := len(preview.Columns)
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	picked, err := selectColumns(o.Columns, preview.Columns, width)
+	if err != nil {
+		return preview, err
+	}
+	pick := func(row []string) []string {
+		cells := make([]string, len(picked))
+		for i, col := range picked {
+			if col < len(row) {
+				cells[i] = row[col]
+			}
+		}
+		return cells
+	}
+	if preview.Columns != nil {
+		preview.Columns = pick(preview.Columns)
+	}
+	for _, row := range rows {
+		preview.Rows = append(preview.Rows, pick(row))
+	}
+	return preview, nil
+}
+
+// cut a cell to at most width columns on the terminal
+func fitCell(cell string, width int) string {
+	cell = strings.Join(strings.Fields(cell), " ")
+	if runewidth.StringWidth(cell) <= width {
+		return cell
+	}
+	return runewidth.Truncate(cell, width, "…")
+}
+
+// print a preview as a table: columns padded to their widest cell,
+// numbers aligned right and the header underlined
+func printTable(w io.Writer, preview tablePreview) {
+	columns := len(preview.Columns)
+	for _, row := range preview.Rows {
+		columns = max(columns, len(row))
+	}
+	widths := make([]int, columns)
+	numeric := make([]bool, columns)
+	for i := range numeric {
+		numeric[i] = len(preview.Rows) > 0
+	}
+	measure := func(row []string) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], runewidth.StringWidth(fitCell(cell, maxColumnWidth)))
+		}
+	}
+	measure(preview.Columns)
+	for _, row := range preview.Rows {
+		measure(row)
+		for i, cell := range row {
+			numeric[i] = numeric[i] && (cell == "" || isNumeric(cell))
+		}
+	}
+
+	line := func(row []string, code string) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cell = fitCell(cell, maxColumnWidth)
+			pad := strings.Repeat(" ", widths[i]-runewidth.StringWidth(cell))
+			if numeric[i] {
+				cells[i] = pad + cell
+			} else {
+				cells[i] = cell + pad
+			}
+		}
+		fmt.Fprintln(w, paint(os.Stdout, code, strings.TrimRight(strings.Join(cells, "  "), " ")))
+	}
+	if preview.Columns != nil {
+		line(preview.Columns, colorHeader)
+		rule := make([]string, columns)
+		for i, width := range widths {
+			rule[i] = strings.Repeat("-", width)
+		}
+		fmt.Fprintln(w, strings.Join(rule, "  "))
+	}
+	for _, row := range preview.Rows {
+		line(row, "")
+	}
+}
+
+// read -table: show the first rows of CSV or TSV files as aligned tables
+func readTables(paths []string, o tableOptions) error {
+	var previews []tablePreview
+	for i, path := range paths {
+		preview, err := previewTable(path, o)
+		if err != nil {
+			return fail("reading table", err)
+		}
+		if opts.JSON {
+			previews = append(previews, preview)
+			continue
+		}
+		if len(paths) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", path)
+		}
+		printTable(os.Stdout, preview)
+		if preview.More {
+			printInfo("(first %d rows shown)\n", len(preview.Rows))
+		}
+	}
+	if opts.JSON {
+		printJSON(previews)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// options shared by mktemp and mktempdir
+type tempOptions struct {
+	Prefix  string
+	Suffix  string
+	Dir     string
+	Cleanup time.Duration
+	Purge   bool
+}
+
+// register the flags shared by mktemp and mktempdir
+func addTempFlags(flags *flag.FlagSet, o *tempOptions) {
+	flags.StringVar(&o.Prefix, "prefix", "tmp", "Start of the generated name")
+	flags.StringVar(&o.Suffix, "suffix", "", "End of the generated name, e.g. .json")
+	flags.StringVar(&o.Dir, "dir", "", "Directory to create it in (default: the system temp directory)")
+	flags.DurationVar(&o.Cleanup, "cleanup", 0, "Record it in the journal so undo removes it, and remove it automatically once this long has passed, e.g. 24h")
+	flags.BoolVar(&o.Purge, "purge", false, "Only remove temporary entries whose -cleanup time has passed")
+}
+
+// create a uniquely named file or directory; CreateTemp and mkdirTemp pick
+// a random name with O_EXCL, and make it readable by the owner only
+func makeTemp(dir bool, o tempOptions) (string, error) {
+	parent := cmp.Or(o.Dir, os.TempDir())
+	if dir {
+		return mkdirTemp(parent, o.Prefix, o.Suffix)
+	}
+	file, err := fsys.CreateTemp(parent, o.Prefix+"*"+o.Suffix)
+	if err != nil {
+		return "", err
+	}
+	return file.Name(), file.Close()
+}
+
+// what os.MkdirTemp does, through fsys: random names are tried until
+// Mkdir finds one that is not taken
+func mkdirTemp(dir string, prefix string, suffix string) (string, error) {
+	for range 10000 {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		err := fsys.Mkdir(name, 0700)
+		if !errors.Is(err, fs.ErrExist) {
+			return name, err
+		}
+	}
+	return "", &fs.PathError{Op: "mkdirtemp", Path: filepath.Join(dir, prefix+"*"+suffix), Err: fs.ErrExist}
+}
+
+// record a temporary entry in the journal with the time it may be removed
+func registerTemp(path string, after time.Duration) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expires := now.Add(after)
+	return appendJournal(journalEntry{ID: fmt.Sprintf("%d", now.UnixNano()), Op: "mktemp", Path: abs, Expires: &expires, Time: now})
+}
+
+// remove the registered temporary entries whose cleanup time has passed,
+// returning their paths
+func purgeTemps() ([]string, error) {
+	entries, err := undoableEntries()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.Op != "mktemp" || entry.Expires == nil || entry.Expires.After(now) {
+			continue
+		}
+		if confine(entry.Path) != nil {
+			// made outside the -root, so left for a run that is not confined
+			continue
+		}
+		if opts.DryRun {
+			removed = append(removed, entry.Path)
+			continue
+		}
+		if err := undoEntry(entry); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry.Path)
+	}
+	return removed, nil
+}
+
+// create a temporary file and print its path
+func runMktemp(args []string) error {
+	return runTemp("mktemp", false, args)
+}
+
+// create a temporary directory and print its path
+func runMktempdir(args []string) error {
+	return runTemp("mktempdir", true, args)
+}
+
+// shared body of mktemp and mktempdir
+func runTemp(name string, dir bool, args []string) error {
+	flags := newFlagSet(name)
+	var o tempOptions
+	addTempFlags(flags, &o)
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if o.Cleanup < 0 {
+		return usageError("creating temporary file", errors.New("-cleanup must be positive"))
+	}
+	if o.Cleanup > 0 && opts.NoJournal {
+		return usageError("creating temporary file", errors.New("-cleanup needs the journal, so it cannot be used with -no-journal"))
+	}
+
+	// every run clears out what earlier runs left to expire
+	if !opts.NoJournal {
+		removed, err := purgeTemps()
+		if err != nil {
+			return fail("removing expired temporary files", err)
+		}
+		if o.Purge {
+			format := "Removed expired %s"
+			if opts.DryRun {
+				format = "Would remove expired %s"
+			}
+			for _, path := range removed {
+				printDone(opResult{Op: "delete", Path: path, DryRun: opts.DryRun}, tr(format, path))
+			}
+		}
+	}
+	if o.Purge {
+		return nil
+	}
+	if err := confine(cmp.Or(o.Dir, os.TempDir())); err != nil {
+		return fail("creating temporary file", err)
+	}
+
+	if opts.DryRun {
+		printPlan(opResult{Op: name, Path: filepath.Join(cmp.Or(o.Dir, os.TempDir()), o.Prefix+"*"+o.Suffix), DryRun: true})
+		return nil
+	}
+	path, err := makeTemp(dir, o)
+	if err != nil {
+		return fail("creating temporary file", err)
+	}
+	if o.Cleanup > 0 {
+		if err := registerTemp(path, o.Cleanup); err != nil {
+			fsys.RemoveAll(path)
+			return fail("journaling temporary file", err)
+		}
+	}
+	if opts.JSON {
+		printJSON(opResult{Op: name, Path: path})
+	} else {
+		// the path is the output, so -q does not hide it
+		fmt.Println(path)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// errTimeout is the cause of cmdCtx being canceled by -timeout
+var errTimeout = errors.New("timed out")
+
+// how long an operation gets to clean up after its deadline before the
+// process exits without it
+const timeoutGrace = 2 * time.Second
+
+// receives the cause once the deadline and its grace period have passed
+var timeoutExpired = make(chan error, 1)
+
+// timers started by setTimeout, so a batch can stop those of a finished step
+var timeoutTimers []*time.Timer
+
+// register -timeout, which bounds the whole operation
+func addTimeoutFlag(flags *flag.FlagSet) {
+	flags.Func("timeout", "Give up after this long, e.g. 30s, and exit with code 124", func(text string) error {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout must be positive")
+		}
+		setTimeout(d)
+		return nil
+	})
+}
+
+// cancel cmdCtx after d. An operation stuck in a call that cannot be
+// interrupted, such as I/O on a hung NFS mount, never sees that, so main
+// stops waiting for it once the grace period is over too
+func setTimeout(d time.Duration) {
+	cause := fmt.Errorf("%w after %s", errTimeout, d)
+	var cancel context.CancelFunc
+	cmdCtx, cancel = context.WithTimeoutCause(cmdCtx, d, cause)
+	timeoutTimers = append(timeoutTimers, time.AfterFunc(d+timeoutGrace, func() {
+		cancel()
+		select {
+		case timeoutExpired <- cause:
+		default:
+		}
+	}))
+}
+
+// stop the timers started after the first keep, whose operations are done
+func stopTimeouts(keep int) {
+	for _, timer := range timeoutTimers[keep:] {
+		timer.Stop()
+	}
+	timeoutTimers = timeoutTimers[:keep]
+}
+
+// report whether err means the operation was stopped by a signal or -timeout
+func isCanceled(err error) bool {
+	return errors.Is(err, errInterrupted) || errors.Is(err, errTimeout)
+}
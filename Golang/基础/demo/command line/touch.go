@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// access and modification times of a file; the access time falls back to
+// the modification time on platforms where stat does not report it
+func fileTimes(path string) (time.Time, time.Time, error) {
+	st, err := statFile(path, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if st.AccessTime == nil {
+		return st.ModTime, st.ModTime, nil
+	}
+	return *st.AccessTime, st.ModTime, nil
+}
+
+// create a file if it is missing and set its times; reports whether it was created
+func touchFile(path string, atime time.Time, mtime time.Time, noCreate bool) (bool, error) {
+	created := false
+	if _, err := fsys.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if noCreate {
+			return false, nil
+		}
+		file, err := fsys.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return false, err
+		}
+		file.Close()
+		created = true
+	} else if err != nil {
+		return false, err
+	}
+	return created, fsys.Chtimes(path, atime, mtime)
+}
+
+// create files or update their timestamps
+func runTouch(args []string) error {
+	flags := newFlagSet("touch")
+	mtimeFlag := flags.String("mtime", "", "Set the modification time to TIME (e.g. 2024-01-02T15:04:05 or 3d) instead of now")
+	reference := flags.String("reference", "", "Copy the access and modification times of FILE")
+	noCreate := flags.Bool("no-create", false, "Do not create missing files")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := exclusiveFlags(flags, "mtime", "reference"); err != nil {
+		return usageError("touching file", err)
+	}
+
+	now := time.Now()
+	atime, mtime := now, now
+	if *mtimeFlag != "" {
+		t, err := parseTimeSpec(*mtimeFlag, now)
+		if err != nil {
+			return usageError("parsing time", err)
+		}
+		mtime = t
+	}
+	if err := confine(append(flags.Args(), *reference)...); err != nil {
+		return fail("touching file", err)
+	}
+	if *reference != "" {
+		var err error
+		if atime, mtime, err = fileTimes(*reference); err != nil {
+			return fail("reading reference times", err)
+		}
+	}
+
+	for _, path := range flags.Args() {
+		result := opResult{Op: "touch", Path: path}
+		if opts.DryRun {
+			result.DryRun = true
+			format := "Would update times of %s (mtime %s)"
+			if !exists(path) {
+				if *noCreate {
+					continue
+				}
+				format = "Would create %s (mtime %s)"
+			}
+			printDone(result, tr(format, path, mtime.Format(time.RFC3339)))
+			continue
+		}
+		created, err := touchFile(path, atime, mtime, *noCreate)
+		if err != nil {
+			return fail("touching file", err)
+		}
+		if created {
+			printDone(result, tr("File created successfully: %s", path))
+		} else if exists(path) {
+			printDone(result, tr("Times of %s set to %s", path, mtime.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
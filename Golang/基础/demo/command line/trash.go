@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"cmdline/fileops"
+)
+
+// record kept alongside a trashed file so it can be restored
+type trashEntry struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+}
+
+// per-user data directory holding the trash, journal and shell history,
+// following the XDG data directory convention
+func dataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "fileutil"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "fileutil"), nil
+}
+
+// trash directory, unless the config file moves it elsewhere
+func trashDir() (string, error) {
+	if cfg.Trash != "" {
+		return cfg.Trash, nil
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trash"), nil
+}
+
+// move a file or directory into the trash and record where it came from
+func trashFile(path string) (trashEntry, error) {
+	var entry trashEntry
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return entry, err
+	}
+	if _, err := fsys.Lstat(abs); err != nil {
+		return entry, err
+	}
+	if err := checkHostMove(abs); err != nil {
+		return entry, err
+	}
+	dir, err := trashDir()
+	if err != nil {
+		return entry, err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return entry, err
+		}
+	}
+
+	now := time.Now()
+	entry = trashEntry{
+		ID:           fmt.Sprintf("%d-%s", now.UnixNano(), filepath.Base(abs)),
+		OriginalPath: abs,
+		DeletedAt:    now,
+	}
+	record, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return entry, err
+	}
+	infoPath := filepath.Join(dir, "info", entry.ID+".json")
+	if err := os.WriteFile(infoPath, record, 0600); err != nil {
+		return entry, err
+	}
+	if err := moveFileOn(fileops.OS, abs, filepath.Join(dir, "files", entry.ID)); err != nil {
+		os.Remove(infoPath)
+		return entry, err
+	}
+	return entry, nil
+}
+
+// list the trash contents, newest first
+func listTrash() ([]trashEntry, error) {
+	dir, err := trashDir()
+	if err != nil {
+		return nil, err
+	}
+	records, err := os.ReadDir(filepath.Join(dir, "info"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []trashEntry
+	for _, record := range records {
+		data, err := os.ReadFile(filepath.Join(dir, "info", record.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var entry trashEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("bad trash record %s: %w", record.Name(), err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DeletedAt.After(entries[j].DeletedAt) })
+	return entries, nil
+}
+
+// find the most recently trashed entry with the given id or original path
+func findTrashEntry(key string) (trashEntry, error) {
+	entries, err := listTrash()
+	if err != nil {
+		return trashEntry{}, err
+	}
+	abs, _ := filepath.Abs(key)
+	for _, entry := range entries {
+		if entry.ID == key || entry.OriginalPath == abs {
+			return entry, nil
+		}
+	}
+	return trashEntry{}, fmt.Errorf("%s: %w", key, errNotInTrash)
+}
+
+// errNotInTrash reports that no trash record matched a restore request
+var errNotInTrash = fmt.Errorf("not found in trash: %w", os.ErrNotExist)
+
+// move a trashed entry back to where it was deleted from
+func restoreFromTrash(entry trashEntry) error {
+	if exists(entry.OriginalPath) {
+		return fmt.Errorf("%s already exists", entry.OriginalPath)
+	}
+	dir, err := trashDir()
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(entry.OriginalPath), 0755); err != nil {
+		return err
+	}
+	if err := checkHostMove(entry.OriginalPath); err != nil {
+		return err
+	}
+	if err := moveFileOn(fileops.OS, filepath.Join(dir, "files", entry.ID), entry.OriginalPath); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(dir, "info", entry.ID+".json"))
+}
+
+// permanently delete everything in the trash
+func emptyTrash() (int, error) {
+	entries, err := listTrash()
+	if err != nil {
+		return 0, err
+	}
+	dir, err := trashDir()
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, "files", entry.ID)); err != nil {
+			return 0, err
+		}
+		if err := os.Remove(filepath.Join(dir, "info", entry.ID+".json")); err != nil {
+			return 0, err
+		}
+		ids = append(ids, entry.ID)
+	}
+	return len(entries), journalTrashGone(ids...)
+}
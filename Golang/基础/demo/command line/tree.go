@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// a node of the directory hierarchy printed by tree
+type treeNode struct {
+	Name     string      `json:"name"`
+	IsDir    bool        `json:"is_dir"`
+	Children []*treeNode `json:"children,omitempty"`
+	Mode     fs.FileMode `json:"-"`
+}
+
+// read a directory hierarchy down to maxDepth levels (0 means no limit)
+func buildTree(path string, maxDepth int, dirsOnly bool) (*treeNode, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	root := &treeNode{Name: path, IsDir: info.IsDir(), Mode: info.Mode()}
+	if root.IsDir {
+		err = fillTree(root, path, 1, maxDepth, dirsOnly)
+	}
+	return root, err
+}
+
+// add the entries of dir to node, recursing into subdirectories
+func fillTree(node *treeNode, dir string, depth int, maxDepth int, dirsOnly bool) error {
+	if maxDepth > 0 && depth > maxDepth {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if dirsOnly && !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		child := &treeNode{Name: entry.Name(), IsDir: entry.IsDir(), Mode: info.Mode()}
+		node.Children = append(node.Children, child)
+		if child.IsDir {
+			if err := fillTree(child, filepath.Join(dir, entry.Name()), depth+1, maxDepth, dirsOnly); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// print a tree with branch characters and return the directory and file counts
+func printTree(w *os.File, root *treeNode) (dirs int, files int) {
+	fmt.Fprintln(w, paint(w, modeColor(root.Mode), root.Name))
+	var walk func(node *treeNode, prefix string)
+	walk = func(node *treeNode, prefix string) {
+		for i, child := range node.Children {
+			branch, indent := "├── ", "│   "
+			if i == len(node.Children)-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Fprintln(w, prefix+branch+paint(w, modeColor(child.Mode), child.Name))
+			if child.IsDir {
+				dirs++
+				walk(child, prefix+indent)
+			} else {
+				files++
+			}
+		}
+	}
+	walk(root, "")
+	return dirs, files
+}
+
+// render directory hierarchies
+func runTree(args []string) error {
+	flags := newFlagSet("tree")
+	maxDepth := flags.Int("max-depth", 0, "Descend at most N levels (0 means no limit)")
+	dirsOnly := flags.Bool("dirs-only", false, "Show directories only")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return fail("building tree", err)
+	}
+
+	var trees []*treeNode
+	for _, path := range paths {
+		root, err := buildTree(path, *maxDepth, *dirsOnly)
+		if err != nil {
+			return fail("building tree", err)
+		}
+		if opts.JSON {
+			trees = append(trees, root)
+			continue
+		}
+		dirs, files := printTree(os.Stdout, root)
+		if *dirsOnly {
+			fmt.Print("\n" + tr("%d directories\n", dirs))
+		} else {
+			fmt.Print("\n" + tr("%d directories, %d files\n", dirs, files))
+		}
+	}
+	if opts.JSON {
+		printJSON(trees)
+	}
+	return nil
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+
+	"cmdline/fileops"
+)
+
+// how much of a file the viewer shows
+const (
+	previewLines = 2000
+	previewBytes = 1 << 20
+)
+
+// key help shown on the bottom line
+const tuiHelp = "Tab pane  Space select  Enter open  v view  c copy  m move  r rename  n mkdir  d delete  u undo  . hidden  q quit"
+
+// one row of a pane; ".." is the parent directory
+type tuiEntry struct {
+	name string
+	info fs.FileInfo
+}
+
+// one side of the file manager
+type tuiPane struct {
+	dir      string
+	entries  []tuiEntry
+	cursor   int
+	top      int
+	selected map[string]bool
+}
+
+// the two-pane file manager started by the tui command
+type fileManager struct {
+	screen     tcell.Screen
+	panes      [2]*tuiPane
+	active     int
+	showHidden bool
+	status     string
+}
+
+// read the pane's directory again, directories first, keeping the cursor on
+// the same name when it is still there and on the same row when it is not
+func (p *tuiPane) load(showHidden bool) error {
+	list, err := os.ReadDir(p.dir)
+	if err != nil {
+		return err
+	}
+	current := ""
+	if p.cursor < len(p.entries) {
+		current = p.entries[p.cursor].name
+	}
+
+	p.entries = p.entries[:0]
+	if parent := filepath.Dir(p.dir); parent != p.dir {
+		p.entries = append(p.entries, tuiEntry{name: ".."})
+	}
+	var rest []tuiEntry
+	for _, d := range list {
+		if !showHidden && isHidden(filepath.Join(p.dir, d.Name())) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			// removed since ReadDir; it will not be shown
+			continue
+		}
+		rest = append(rest, tuiEntry{name: d.Name(), info: info})
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		if rest[i].info.IsDir() != rest[j].info.IsDir() {
+			return rest[i].info.IsDir()
+		}
+		return rest[i].name < rest[j].name
+	})
+	p.entries = append(p.entries, rest...)
+
+	present := make(map[string]bool, len(p.entries))
+	p.cursor = max(0, min(p.cursor, len(p.entries)-1))
+	for i, e := range p.entries {
+		present[e.name] = true
+		if e.name == current {
+			p.cursor = i
+		}
+	}
+	for name := range p.selected {
+		if !present[name] {
+			delete(p.selected, name)
+		}
+	}
+	return nil
+}
+
+// the entry under the cursor, if any
+func (p *tuiPane) current() (tuiEntry, bool) {
+	if p.cursor >= len(p.entries) {
+		return tuiEntry{}, false
+	}
+	return p.entries[p.cursor], true
+}
+
+// paths an operation acts on: the selection, or else the entry under the cursor
+func (p *tuiPane) targets() []string {
+	var paths []string
+	for _, e := range p.entries {
+		if p.selected[e.name] {
+			paths = append(paths, filepath.Join(p.dir, e.name))
+		}
+	}
+	if len(paths) == 0 {
+		if e, ok := p.current(); ok && e.name != ".." {
+			paths = append(paths, filepath.Join(p.dir, e.name))
+		}
+	}
+	return paths
+}
+
+// move the cursor by n rows, keeping it inside the list
+func (p *tuiPane) move(n int) {
+	p.cursor = max(0, min(p.cursor+n, len(p.entries)-1))
+}
+
+// draw text at x, y, cut to width cells; returns the cells used
+func drawText(s tcell.Screen, x, y, width int, style tcell.Style, text string) int {
+	used := 0
+	for _, r := range text {
+		if r == '\t' {
+			r = ' '
+		} else if r < ' ' || r == 0x7f {
+			r = '?'
+		}
+		w := runewidth.RuneWidth(r)
+		if used+w > width {
+			break
+		}
+		s.SetContent(x+used, y, r, nil, style)
+		used += w
+	}
+	return used
+}
+
+// fill a row from x with spaces in the given style
+func clearRow(s tcell.Screen, x, y, width int, style tcell.Style) {
+	for i := 0; i < width; i++ {
+		s.SetContent(x+i, y, ' ', nil, style)
+	}
+}
+
+// draw one pane in the columns [x, x+width)
+func (fm *fileManager) drawPane(i, x, width, height int) {
+	p := fm.panes[i]
+	header := tcell.StyleDefault.Bold(true)
+	if i == fm.active {
+		header = header.Reverse(true)
+	}
+	clearRow(fm.screen, x, 0, width, header)
+	title := p.dir
+	if n := len(p.selected); n > 0 {
+		title += tr(" [%d selected]", n)
+	}
+	drawText(fm.screen, x, 0, width, header, title)
+
+	rows := height - 3
+	if p.cursor < p.top {
+		p.top = p.cursor
+	}
+	if p.cursor >= p.top+rows {
+		p.top = p.cursor - rows + 1
+	}
+	for row := 0; row < rows; row++ {
+		y := row + 1
+		n := p.top + row
+		style := tcell.StyleDefault
+		if n == p.cursor && i == fm.active {
+			style = style.Reverse(true)
+		}
+		clearRow(fm.screen, x, y, width, style)
+		if n >= len(p.entries) {
+			continue
+		}
+		e := p.entries[n]
+		name, size := e.name, ""
+		switch {
+		case e.info == nil:
+			size = "<UP>"
+		case e.info.IsDir():
+			name += "/"
+			size = "<DIR>"
+		case e.info.Mode()&fs.ModeSymlink != 0:
+			name += "@"
+		default:
+			size = humanSize(e.info.Size())
+		}
+		if p.selected[e.name] {
+			style = style.Foreground(tcell.ColorYellow).Bold(true)
+			name = "*" + name
+		} else {
+			name = " " + name
+		}
+		drawText(fm.screen, x, y, width-len(size)-1, style, name)
+		drawText(fm.screen, x+width-len(size)-1, y, len(size), style, size)
+	}
+}
+
+// redraw the whole screen
+func (fm *fileManager) draw() {
+	s := fm.screen
+	s.Clear()
+	width, height := s.Size()
+	left := width / 2
+	fm.drawPane(0, 0, left, height)
+	fm.drawPane(1, left+1, width-left-1, height)
+	for y := 0; y < height-2; y++ {
+		s.SetContent(left, y, tcell.RuneVLine, nil, tcell.StyleDefault)
+	}
+	drawText(s, 0, height-2, width, tcell.StyleDefault.Bold(true), fm.status)
+	clearRow(s, 0, height-1, width, tcell.StyleDefault.Reverse(true))
+	drawText(s, 0, height-1, width, tcell.StyleDefault.Reverse(true), tr(tuiHelp))
+	s.Show()
+}
+
+// read a line typed on the status row; false when cancelled with Esc
+func (fm *fileManager) ask(prompt string, initial string) (string, bool) {
+	input := []rune(initial)
+	for {
+		fm.status = prompt + string(input) + "_"
+		fm.draw()
+		ev, ok := fm.screen.PollEvent().(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch ev.Key() {
+		case tcell.KeyEnter:
+			fm.status = ""
+			return string(input), true
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			fm.status = ""
+			return "", false
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		case tcell.KeyRune:
+			input = append(input, ev.Rune())
+		}
+	}
+}
+
+// ask a yes or no question on the status row
+func (fm *fileManager) confirm(question string) bool {
+	fm.status = question + " " + tr("[y/N]")
+	fm.draw()
+	for {
+		if ev, ok := fm.screen.PollEvent().(*tcell.EventKey); ok {
+			fm.status = ""
+			return ev.Key() == tcell.KeyRune && (ev.Rune() == 'y' || ev.Rune() == 'Y')
+		}
+	}
+}
+
+// show the start of a file full screen until q or Esc
+func (fm *fileManager) view(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = copyHead(&buf, io.LimitReader(file, previewBytes), previewLines)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	text := buf.String()
+	var lines []string
+	if strings.IndexByte(text, 0) >= 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		lines = []string{tr("%s is a binary file of %s", path, humanSize(info.Size()))}
+	} else {
+		lines = strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n")
+	}
+
+	top := 0
+	for {
+		s := fm.screen
+		s.Clear()
+		width, height := s.Size()
+		rows := height - 1
+		top = max(0, min(top, len(lines)-rows))
+		for row := 0; row < rows && top+row < len(lines); row++ {
+			drawText(s, 0, row, width, tcell.StyleDefault, lines[top+row])
+		}
+		bar := tcell.StyleDefault.Reverse(true)
+		clearRow(s, 0, height-1, width, bar)
+		drawText(s, 0, height-1, width, bar, tr("%s  line %d of %d  (q to close)", path, top+1, len(lines)))
+		s.Show()
+
+		ev, ok := s.PollEvent().(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case ev.Key() == tcell.KeyEscape, ev.Key() == tcell.KeyRune && ev.Rune() == 'q':
+			return nil
+		case ev.Key() == tcell.KeyUp, ev.Key() == tcell.KeyRune && ev.Rune() == 'k':
+			top--
+		case ev.Key() == tcell.KeyDown, ev.Key() == tcell.KeyRune && ev.Rune() == 'j', ev.Key() == tcell.KeyEnter:
+			top++
+		case ev.Key() == tcell.KeyPgUp:
+			top -= rows
+		case ev.Key() == tcell.KeyPgDn, ev.Key() == tcell.KeyRune && ev.Rune() == ' ':
+			top += rows
+		case ev.Key() == tcell.KeyHome:
+			top = 0
+		case ev.Key() == tcell.KeyEnd:
+			top = len(lines)
+		}
+	}
+}
+
+// ask before replacing an existing destination; the journal keeps the old one for undo
+func (fm *fileManager) allowReplace(dest string) bool {
+	return !exists(dest) || fm.confirm(tr("%s exists. Replace it?", dest))
+}
+
+// copy or move the selection into the other pane's directory
+func (fm *fileManager) transfer(move bool) error {
+	srcs := fm.panes[fm.active].targets()
+	destDir := fm.panes[1-fm.active].dir
+	if len(srcs) == 0 {
+		return nil
+	}
+	// whole messages for each, so they translate
+	question, doing, summary := "Copy %s to %s?", "Copying %s...", "Copied %d of %d"
+	if move {
+		question, doing, summary = "Move %s to %s?", "Moving %s...", "Moved %d of %d"
+	}
+	if !fm.confirm(tr(question, describeTargets(srcs), destDir)) {
+		return nil
+	}
+	done := 0
+	for _, src := range srcs {
+		target := filepath.Join(destDir, filepath.Base(src))
+		if target == src {
+			return errors.New(tr("%s is already in %s", src, destDir))
+		}
+		if !fm.allowReplace(target) {
+			continue
+		}
+		fm.status = tr(doing, src)
+		fm.draw()
+		var err error
+		if move {
+			var entry *journalEntry
+			if entry, err = journalPrepare("rename", src, target); err != nil {
+				return err
+			}
+			err = journalFinish(entry, moveFile(src, target))
+		} else {
+			var entry *journalEntry
+			if entry, err = journalPrepare("copy", src, target); err != nil {
+				return err
+			}
+			c := treeCopier{Journal: entry}
+			err = journalFinish(entry, c.copy(src, target))
+		}
+		if err != nil {
+			return err
+		}
+		done++
+	}
+	clear(fm.panes[fm.active].selected)
+	fm.status = tr(summary, done, len(srcs))
+	return nil
+}
+
+// delete the selection; it stays in the journal, so u brings it back
+func (fm *fileManager) remove() error {
+	paths := fm.panes[fm.active].targets()
+	if len(paths) == 0 || !fm.confirm(tr("Delete %s?", describeTargets(paths))) {
+		return nil
+	}
+	for _, path := range paths {
+		if err := deleteJournaled(path, true); err != nil {
+			return err
+		}
+	}
+	clear(fm.panes[fm.active].selected)
+	fm.status = tr("Deleted %s (u to undo)", describeTargets(paths))
+	return nil
+}
+
+// rename the entry under the cursor within its directory
+func (fm *fileManager) rename() error {
+	p := fm.panes[fm.active]
+	e, ok := p.current()
+	if !ok || e.name == ".." {
+		return nil
+	}
+	name, ok := fm.ask(tr("Rename to: "), e.name)
+	if !ok || name == "" || name == e.name {
+		return nil
+	}
+	if strings.ContainsRune(name, filepath.Separator) {
+		return errors.New(tr("the new name cannot contain a path separator"))
+	}
+	src, dest := filepath.Join(p.dir, e.name), filepath.Join(p.dir, name)
+	if !fm.allowReplace(dest) {
+		return nil
+	}
+	entry, err := journalPrepare("rename", src, dest)
+	if err != nil {
+		return err
+	}
+	if err := journalFinish(entry, fileops.Rename(cmdCtx, fsys, src, dest)); err != nil {
+		return err
+	}
+	p.entries[p.cursor].name = name
+	fm.status = tr("Renamed %s to %s", e.name, name)
+	return nil
+}
+
+// create a directory in the active pane
+func (fm *fileManager) mkdir() error {
+	name, ok := fm.ask(tr("New directory: "), "")
+	if !ok || name == "" {
+		return nil
+	}
+	path := filepath.Join(fm.panes[fm.active].dir, name)
+	entry, err := journalPrepare("mkdir", path, "")
+	if err != nil {
+		return err
+	}
+	if err := journalFinish(entry, fileops.Mkdir(cmdCtx, fsys, path, fileops.MkdirOptions{Perm: 0755})); err != nil {
+		return err
+	}
+	fm.status = tr("Created %s", path)
+	return nil
+}
+
+// roll back the last journaled operation, from this session or before
+func (fm *fileManager) undo() error {
+	entries, err := undoableEntries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New(tr("nothing to undo"))
+	}
+	entry := entries[0]
+	if !fm.confirm(tr("Undo %s of %s?", entry.Op, entry.Path)) {
+		return nil
+	}
+	if err := undoEntry(entry); err != nil {
+		return err
+	}
+	fm.status = tr("Undid %s of %s", entry.Op, entry.Path)
+	return nil
+}
+
+// "name" for one path, "N items" for several
+func describeTargets(paths []string) string {
+	if len(paths) == 1 {
+		return filepath.Base(paths[0])
+	}
+	return tr("%d items", len(paths))
+}
+
+// open the entry under the cursor: enter a directory, view a file
+func (fm *fileManager) open() error {
+	p := fm.panes[fm.active]
+	e, ok := p.current()
+	if !ok {
+		return nil
+	}
+	if e.name == ".." {
+		return fm.up()
+	}
+	path := filepath.Join(p.dir, e.name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fm.view(path)
+	}
+	previous := p.dir
+	p.dir, p.cursor, p.top = path, 0, 0
+	clear(p.selected)
+	if err := p.load(fm.showHidden); err != nil {
+		p.dir = previous
+		return err
+	}
+	return nil
+}
+
+// go to the parent directory, with the cursor on the one just left
+func (fm *fileManager) up() error {
+	p := fm.panes[fm.active]
+	parent := filepath.Dir(p.dir)
+	if parent == p.dir {
+		return nil
+	}
+	left := filepath.Base(p.dir)
+	p.dir, p.top = parent, 0
+	p.entries = []tuiEntry{{name: left}}
+	p.cursor = 0
+	clear(p.selected)
+	return p.load(fm.showHidden)
+}
+
+// handle one key; false ends the program
+func (fm *fileManager) handleKey(ev *tcell.EventKey) (bool, error) {
+	p := fm.panes[fm.active]
+	_, height := fm.screen.Size()
+	page := max(1, height-4)
+	key, r := ev.Key(), rune(0)
+	if key == tcell.KeyRune {
+		r = ev.Rune()
+	}
+	switch {
+	case key == tcell.KeyF10, key == tcell.KeyCtrlC, r == 'q':
+		return false, nil
+	case key == tcell.KeyUp, r == 'k':
+		p.move(-1)
+	case key == tcell.KeyDown, r == 'j':
+		p.move(1)
+	case key == tcell.KeyPgUp:
+		p.move(-page)
+	case key == tcell.KeyPgDn:
+		p.move(page)
+	case key == tcell.KeyHome:
+		p.cursor = 0
+	case key == tcell.KeyEnd:
+		p.cursor = max(0, len(p.entries)-1)
+	case key == tcell.KeyTab:
+		fm.active = 1 - fm.active
+	case key == tcell.KeyEnter, key == tcell.KeyRight, r == 'l':
+		return true, fm.open()
+	case key == tcell.KeyBackspace, key == tcell.KeyBackspace2, key == tcell.KeyLeft, r == 'h':
+		return true, fm.up()
+	case r == ' ', key == tcell.KeyInsert:
+		if e, ok := p.current(); ok && e.name != ".." {
+			if p.selected[e.name] {
+				delete(p.selected, e.name)
+			} else {
+				p.selected[e.name] = true
+			}
+		}
+		p.move(1)
+	case r == 'v', key == tcell.KeyF3:
+		if paths := p.targets(); len(paths) > 0 {
+			if info, err := os.Stat(paths[0]); err == nil && !info.IsDir() {
+				return true, fm.view(paths[0])
+			}
+		}
+	case r == 'c', key == tcell.KeyF5:
+		return true, fm.transfer(false)
+	case r == 'm', key == tcell.KeyF6:
+		return true, fm.transfer(true)
+	case r == 'r', key == tcell.KeyF2:
+		return true, fm.rename()
+	case r == 'n', key == tcell.KeyF7:
+		return true, fm.mkdir()
+	case r == 'd', key == tcell.KeyF8, key == tcell.KeyDelete:
+		return true, fm.remove()
+	case r == 'u':
+		return true, fm.undo()
+	case r == '.':
+		fm.showHidden = !fm.showHidden
+	case r == '=':
+		// show the active pane's directory in the other pane too
+		other := fm.panes[1-fm.active]
+		other.dir, other.cursor, other.top = p.dir, 0, 0
+		clear(other.selected)
+	}
+	return true, nil
+}
+
+// browse and manage files in a two-pane terminal interface
+func runTUI(args []string) error {
+	flags := newFlagSet("tui")
+	flags.Parse(args)
+	if flags.NArg() > 2 {
+		flags.Usage()
+		return errUsage
+	}
+	if opts.JSON || opts.DryRun {
+		return usageError("starting file manager", errors.New("-json and -dry-run cannot be used with tui"))
+	}
+	if opts.Root != "" {
+		// the panes can browse anywhere, so they cannot be confined
+		return usageError("starting file manager", errors.New("-root cannot be used with tui"))
+	}
+
+	// the panes start in the given directories, or both in the current one
+	fm := &fileManager{}
+	for i := range fm.panes {
+		dir := flags.Arg(min(i, flags.NArg()-1))
+		if dir == "" {
+			dir = "."
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fail("starting file manager", err)
+		}
+		fm.panes[i] = &tuiPane{dir: abs, selected: map[string]bool{}}
+		if err := fm.panes[i].load(false); err != nil {
+			return fail("starting file manager", err)
+		}
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fail("starting file manager", err)
+	}
+	if err := screen.Init(); err != nil {
+		return fail("starting file manager", err)
+	}
+	defer screen.Fini()
+	fm.screen = screen
+
+	for {
+		for _, p := range fm.panes {
+			// other programs may have changed the directories; a pane whose
+			// directory is gone moves up to one that exists
+			for p.load(fm.showHidden) != nil && filepath.Dir(p.dir) != p.dir {
+				p.dir = filepath.Dir(p.dir)
+			}
+		}
+		fm.draw()
+		switch ev := screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventKey:
+			fm.status = ""
+			running, err := fm.handleKey(ev)
+			if err != nil {
+				fm.status = tr("Error: %s", err)
+			}
+			if !running {
+				return nil
+			}
+		}
+	}
+}
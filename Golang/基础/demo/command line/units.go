@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// multipliers for the size suffixes accepted on the command line
+var sizeUnits = map[string]int64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"t":  1 << 40,
+	"tb": 1 << 40,
+}
+
+// parse a size such as 512, 10K, 100MB or 1.5G into bytes
+func parseSize(text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	i := strings.IndexFunc(text, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(text)
+	}
+	number, unit := text[:i], strings.ToLower(strings.TrimSpace(text[i:]))
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size %q (use a number with an optional K, M, G or T suffix)", text)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", text)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// parse an age such as 30d, 12h or 90m, or an absolute date or RFC 3339
+// timestamp, into the point in time it refers to
+func parseTimeSpec(text string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	age, err := parseAge(text)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-age), nil
+}
+
+// parse a duration that may also use d for days and w for weeks
+func parseAge(text string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(text, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %q", text)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	age, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age or time %q (use e.g. 30d, 12h or 2024-01-02)", text)
+	}
+	return age, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// set when building a release, e.g.
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// anything left empty is taken from the build info Go embeds in the binary
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// what was built and how, returned by version
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// version details from the ldflags, falling back to the module version and
+// VCS stamp recorded by the Go toolchain
+func buildVersion() versionInfo {
+	info := versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+// one line such as: fileutil v1.4.0 (commit 1a2b3c4d5e6f, built 2026-01-02T15:04:05Z, go1.23.2 linux/amd64)
+func (v versionInfo) String() string {
+	details := []string{}
+	if v.Commit != "" {
+		c := v.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if v.Modified {
+			c += "-dirty"
+		}
+		details = append(details, "commit "+c)
+	}
+	if v.BuildDate != "" {
+		details = append(details, "built "+v.BuildDate)
+	}
+	details = append(details, v.GoVersion+" "+v.Platform)
+	return fmt.Sprintf("fileutil %s (%s)", v.Version, strings.Join(details, ", "))
+}
+
+// print the version, commit, build date and Go version
+func runVersion(args []string) error {
+	flags := newFlagSet("version")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	info := buildVersion()
+	if opts.JSON {
+		printJSON(info)
+		return nil
+	}
+	fmt.Println(info)
+	return nil
+}
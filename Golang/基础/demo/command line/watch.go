@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// a filesystem change reported by watch
+type watchEvent struct {
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+}
+
+// debounce window used with -exec or -hash-check when none is given
+const defaultExecDebounce = 100 * time.Millisecond
+
+// what to watch and how to group the events
+type watchOptions struct {
+	Recursive bool
+	Include   string
+	Debounce  time.Duration
+	// drop modify events of files whose content is what it was
+	HashCheck bool
+}
+
+// what -hash-check knows of a file
+type watchDigest struct {
+	ModTime time.Time
+	Size    int64
+	Sum     string
+}
+
+// the digests of the watched files, taken when watching starts and kept
+// up to date by the events, so -hash-check can tell a real change from a
+// file written again with the same content
+type watchSnapshot map[string]watchDigest
+
+// record the files under root, and below it when recursive, that include
+// lets through
+func (s watchSnapshot) add(root string, recursive bool, include string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root && !recursive {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() && watchIncluded(include, path) {
+			s.changed(path)
+		}
+		return nil
+	})
+}
+
+// record the current state of path and report whether its content
+// differs from the state recorded before; a file whose time and size are
+// unchanged is not read again
+func (s watchSnapshot) changed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		delete(s, path)
+		return true
+	}
+	old, known := s[path]
+	if known && old.ModTime.Equal(info.ModTime()) && old.Size == info.Size() {
+		return false
+	}
+	sum, err := hashFile(path, cfg.HashAlgo)
+	if err != nil {
+		delete(s, path)
+		return true
+	}
+	s[path] = watchDigest{info.ModTime(), info.Size(), sum}
+	return !known || old.Sum != sum
+}
+
+// report whether include, a glob that may be empty, matches a file's name
+func watchIncluded(include string, path string) bool {
+	if include == "" {
+		return true
+	}
+	ok, _ := filepath.Match(include, filepath.Base(path))
+	return ok
+}
+
+// short name for an fsnotify operation, or "" for ones watch ignores
+func watchOpName(op fsnotify.Op) string {
+	switch {
+	case op.Has(fsnotify.Create):
+		return "create"
+	case op.Has(fsnotify.Write):
+		return "modify"
+	case op.Has(fsnotify.Remove):
+		return "delete"
+	case op.Has(fsnotify.Rename):
+		return "rename"
+	default:
+		return ""
+	}
+}
+
+// the op a path's pending event takes when another arrives within the
+// debounce window: a new file stays a create however often it is written,
+// and a file removed and created again was replaced; otherwise the latest
+// op wins, so a file removed at the end is a delete
+func mergeWatchOps(pending string, next string) string {
+	switch {
+	case pending == "create" && next == "modify":
+		return "create"
+	case (pending == "delete" || pending == "rename") && next == "create":
+		return "modify"
+	}
+	return next
+}
+
+// add a directory, and its subdirectories when recursive, to the watcher
+func addWatch(watcher *fsnotify.Watcher, root string, recursive bool) error {
+	if !recursive {
+		return watcher.Add(root)
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// watch root and call handle with each batch of events until ctx is
+// canceled; with a debounce window, events are collected until the path has
+// been quiet that long and repeated events for the same path collapse into
+// one, as mergeWatchOps decides
+func watchPaths(ctx context.Context, root string, o watchOptions, handle func([]watchEvent)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := addWatch(watcher, root, o.Recursive); err != nil {
+		return err
+	}
+
+	var snapshot watchSnapshot
+	if o.HashCheck {
+		snapshot = watchSnapshot{}
+		if err := snapshot.add(root, o.Recursive, o.Include); err != nil {
+			return err
+		}
+	}
+
+	pending := map[string]watchEvent{}
+	var flush <-chan time.Time
+	// the content is compared once the path is quiet, not halfway through
+	// being written
+	emit := func() {
+		batch := make([]watchEvent, 0, len(pending))
+		for _, event := range pending {
+			// every event updates the snapshot, but only a modify is dropped
+			if snapshot != nil && !snapshot.changed(event.Path) && event.Op == "modify" {
+				continue
+			}
+			batch = append(batch, event)
+		}
+		sort.Slice(batch, func(i, j int) bool { return batch[i].Time.Before(batch[j].Time) })
+		clear(pending)
+		if len(batch) > 0 {
+			handle(batch)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) && o.Recursive {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatch(watcher, event.Name, true)
+				}
+			}
+			op := watchOpName(event.Op)
+			if op == "" {
+				continue
+			}
+			if !watchIncluded(o.Include, event.Name) {
+				continue
+			}
+			if earlier, ok := pending[event.Name]; ok {
+				op = mergeWatchOps(earlier.Op, op)
+			}
+			pending[event.Name] = watchEvent{Op: op, Path: event.Name, Time: time.Now()}
+			if o.Debounce <= 0 {
+				emit()
+				continue
+			}
+			flush = time.After(o.Debounce)
+		case <-flush:
+			flush = nil
+			emit()
+		case <-ctx.Done():
+			// hand over what is still waiting for the debounce window
+			if len(pending) > 0 {
+				emit()
+			}
+			// Ctrl-C is the usual way to stop watching; -timeout is not
+			if err := context.Cause(ctx); !errors.Is(err, errInterrupted) {
+				return err
+			}
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// print filesystem events as they happen
+func runWatch(args []string) error {
+	flags := newFlagSet("watch")
+	var o watchOptions
+	flags.BoolVar(&o.Recursive, "recursive", false, "Watch subdirectories too")
+	flags.StringVar(&o.Include, "include", "", "Only report files whose name matches this glob, e.g. *.go")
+	flags.DurationVar(&o.Debounce, "debounce", 0, "Collect events until the files have been quiet this long, e.g. 200ms")
+	flags.BoolVar(&o.HashCheck, "hash-check", false, "Report a file as modified only when its content changed, comparing checksums")
+	command := flags.String("exec", "", "Command to run on changes; {} is replaced by the changed path")
+	throttle := flags.Duration("throttle", time.Second, "Minimum time between runs of the -exec command")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if err := requireFlags(flags, "throttle", "exec"); err != nil {
+		return usageError("watching files", err)
+	}
+	if o.Include != "" {
+		if _, err := filepath.Match(o.Include, ""); err != nil {
+			return usageError("watching files", fmt.Errorf("bad -include pattern: %w", err))
+		}
+	}
+
+	var runner *execRunner
+	if *command != "" {
+		runner = newExecRunner(*command, *throttle)
+		// a burst of saves should trigger a single run
+		if o.Debounce == 0 {
+			o.Debounce = defaultExecDebounce
+		}
+	}
+
+	// a file is compared once it is written in full, not when it has just
+	// been truncated
+	if o.HashCheck && o.Debounce == 0 {
+		o.Debounce = defaultExecDebounce
+	}
+
+	if err := confine(flags.Arg(0)); err != nil {
+		return fail("watching files", err)
+	}
+	err := watchPaths(cmdCtx, flags.Arg(0), o, func(batch []watchEvent) {
+		if runner != nil {
+			runner.trigger(batch)
+			return
+		}
+		for _, event := range batch {
+			if opts.JSON {
+				printJSONLine(event)
+				continue
+			}
+			fmt.Printf("%s %-6s %s\n", event.Time.Format(time.TimeOnly), event.Op, event.Path)
+		}
+	})
+	if err != nil {
+		return fail("watching files", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watch dir with o, run change, and return the events reported until the
+// watcher has been quiet for a while after it
+func watchEvents(t *testing.T, dir string, o watchOptions, change func()) []watchEvent {
+	t.Helper()
+	var mu sync.Mutex
+	var events []watchEvent
+	watchEventsTo(t, dir, o, func(batch []watchEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, batch...)
+	}, change)
+	mu.Lock()
+	defer mu.Unlock()
+	return events
+}
+
+// watch dir with o, run change, and hand the batches reported to handle
+// until the watcher has been quiet for a while after it
+func watchEventsTo(t *testing.T, dir string, o watchOptions, handle func([]watchEvent), change func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watchPaths(ctx, dir, o, handle)
+	}()
+	// let the watcher start before anything changes
+	time.Sleep(200 * time.Millisecond)
+	change()
+	time.Sleep(500 * time.Millisecond)
+	cancel(errInterrupted)
+	if err := <-done; err != nil {
+		t.Fatalf("watchPaths: %v", err)
+	}
+}
+
+func TestWatchHashCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		modified bool
+	}{
+		{"same content", "hello\n", false},
+		{"new content", "changed\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "file.txt")
+			if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			o := watchOptions{HashCheck: true, Debounce: 50 * time.Millisecond}
+			events := watchEvents(t, dir, o, func() {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Error(err)
+				}
+			})
+			modified := false
+			for _, event := range events {
+				if event.Path == path && event.Op == "modify" {
+					modified = true
+				}
+			}
+			if modified != tt.modified {
+				t.Errorf("modify event reported = %v, want %v (events: %v)", modified, tt.modified, events)
+			}
+		})
+	}
+}
+
+// a file written again with the same content runs -exec only without
+// -hash-check
+func TestWatchHashCheckExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the -exec command is a shell command line")
+	}
+	for _, hashCheck := range []bool{true, false} {
+		t.Run(fmt.Sprintf("hash-check=%v", hashCheck), func(t *testing.T) {
+			dir := t.TempDir()
+			watched := filepath.Join(dir, "watched")
+			if err := os.Mkdir(watched, 0755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(watched, "file.txt")
+			if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			marker := filepath.Join(dir, "ran")
+			runner := newExecRunner("echo {} >> "+shellQuote(marker), 0)
+			o := watchOptions{HashCheck: hashCheck, Debounce: 50 * time.Millisecond}
+			watchEventsTo(t, watched, o, runner.trigger, func() {
+				if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+					t.Error(err)
+				}
+			})
+			// give a run that was triggered time to finish
+			ran := false
+			for deadline := time.Now().Add(time.Second); !ran && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+				_, err := os.Stat(marker)
+				ran = err == nil
+			}
+			if ran == hashCheck {
+				t.Errorf("-exec ran = %v, want %v", ran, !hashCheck)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// counts of one file reported by wc
+type wordCount struct {
+	Path          string `json:"path"`
+	Lines         int64  `json:"lines"`
+	Words         int64  `json:"words"`
+	Bytes         int64  `json:"bytes"`
+	Chars         int64  `json:"chars"`
+	MaxLineLength int64  `json:"max_line_length"`
+}
+
+// add the counts of c to the total t; the longest line is the longest of both
+func (t *wordCount) add(c wordCount) {
+	t.Lines += c.Lines
+	t.Words += c.Words
+	t.Bytes += c.Bytes
+	t.Chars += c.Chars
+	t.MaxLineLength = max(t.MaxLineLength, c.MaxLineLength)
+}
+
+// count the lines, words, bytes and characters of r as wc does: lines are
+// newlines, words runs of non-space characters and characters valid UTF-8
+// sequences, so bytes of other encodings are not counted as characters
+func countText(r io.Reader) (wordCount, error) {
+	var c wordCount
+	reader := bufio.NewReaderSize(r, streamBufferSize)
+	inWord := false
+	var lineLength int64
+	for {
+		ch, size, err := reader.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return c, err
+		}
+		c.Bytes += int64(size)
+		if ch == utf8.RuneError && size == 1 {
+			inWord = true
+			continue
+		}
+		c.Chars++
+		if ch == '\n' {
+			c.Lines++
+			c.MaxLineLength = max(c.MaxLineLength, lineLength)
+			lineLength = 0
+		} else {
+			lineLength++
+		}
+		if unicode.IsSpace(ch) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			c.Words++
+		}
+	}
+	c.MaxLineLength = max(c.MaxLineLength, lineLength)
+	return c, nil
+}
+
+// count a file, or stdin when path is empty
+func countFile(path string) (wordCount, error) {
+	var r io.Reader = os.Stdin
+	if path != "" {
+		file, err := fsys.Open(path)
+		if err != nil {
+			return wordCount{}, err
+		}
+		defer file.Close()
+		r = file
+	}
+	c, err := countText(interruptible(cmdCtx, r))
+	c.Path = path
+	if path == "" {
+		c.Path = "-"
+	}
+	return c, err
+}
+
+// count lines, words, bytes and characters of files
+func runWc(args []string) error {
+	flags := newFlagSet("wc")
+	lines := flags.Bool("l", false, "Show the number of lines")
+	words := flags.Bool("w", false, "Show the number of words")
+	bytes := flags.Bool("c", false, "Show the number of bytes")
+	chars := flags.Bool("m", false, "Show the number of characters")
+	longest := flags.Bool("L", false, "Show the length of the longest line, in characters")
+	flags.Parse(args)
+
+	var paths []string
+	if flags.NArg() > 0 {
+		var err error
+		if paths, err = expandPaths(flags.Args()); err != nil {
+			return fail("counting words", err)
+		}
+	}
+	if len(paths) == 0 {
+		// read stdin, as with no arguments or -
+		paths = []string{""}
+	}
+	counts := []wordCount{}
+	total := wordCount{Path: "total"}
+	for _, path := range paths {
+		if path == "-" {
+			path = ""
+		}
+		c, err := countFile(path)
+		if err != nil {
+			return fail("counting words", err)
+		}
+		counts = append(counts, c)
+		total.add(c)
+	}
+	if opts.JSON {
+		printJSON(struct {
+			Files []wordCount `json:"files"`
+			Total wordCount   `json:"total"`
+		}{counts, total})
+		return nil
+	}
+
+	// all of them unless some are picked, in the order of the flags
+	all := !*lines && !*words && !*bytes && !*chars && !*longest
+	columns := func(c wordCount) []int64 {
+		var values []int64
+		for _, column := range []struct {
+			shown bool
+			value int64
+		}{{*lines, c.Lines}, {*words, c.Words}, {*bytes, c.Bytes}, {*chars, c.Chars}, {*longest, c.MaxLineLength}} {
+			if all || column.shown {
+				values = append(values, column.value)
+			}
+		}
+		return values
+	}
+	width := len(fmt.Sprint(max(total.Bytes, total.Chars, total.Lines, total.Words, total.MaxLineLength)))
+	printRow := func(c wordCount, name string) {
+		var fields []string
+		for _, value := range columns(c) {
+			fields = append(fields, fmt.Sprintf("%*d", width, value))
+		}
+		if name != "" {
+			fields = append(fields, name)
+		}
+		fmt.Println(strings.Join(fields, " "))
+	}
+	for _, c := range counts {
+		name := c.Path
+		if flags.NArg() == 0 {
+			// stdin alone is not named
+			name = ""
+		}
+		printRow(c, name)
+	}
+	if len(counts) > 1 {
+		printRow(total, tr("total"))
+	}
+	return nil
+}
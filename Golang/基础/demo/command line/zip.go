@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// report whether a file is a zip archive, by its name or its first bytes
+func isZip(path string) bool {
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return true
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, 4)
+	_, err = io.ReadFull(file, header)
+	return err == nil && bytes.Equal(header, []byte("PK\x03\x04"))
+}
+
+// write the given paths into a zip stream; archive/zip switches to zip64
+// on its own for entries and archives over 4GB
+func writeZip(w io.Writer, paths []string, o archiveOptions) (int, error) {
+	zw := zip.NewWriter(w)
+	count := 0
+	err := walkArchiveInput(paths, o, func(name string, path string, info fs.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		count++
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			// zip stores a symlink as a file whose contents are the target
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(entry, link)
+			return err
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(entry, throttle(o.Progress.reader(interruptible(cmdCtx, file))))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, zw.Close()
+}
+
+// call fn for every entry of a zip archive, with a reader over its contents
+func eachZipEntry(path string, fn func(archiveEntry, io.Reader) error) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		info := f.FileInfo()
+		entry := archiveEntry{
+			Name:    strings.TrimSuffix(f.Name, "/"),
+			Mode:    info.Mode().Perm(),
+			Size:    int64(f.UncompressedSize64),
+			ModTime: f.Modified,
+		}
+		switch {
+		case info.IsDir():
+			entry.Type = entryDir
+		case info.Mode()&fs.ModeSymlink != 0:
+			entry.Type = entrySymlink
+		case info.Mode().IsRegular():
+			entry.Type = entryFile
+		default:
+			continue
+		}
+		if entry.Mode == 0 {
+			// archives made on Windows often carry no Unix permissions
+			entry.Mode = 0644
+			if entry.Type == entryDir {
+				entry.Mode = 0755
+			}
+		}
+
+		err := func() error {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			var r io.Reader = rc
+			if entry.Type == entrySymlink {
+				link, err := io.ReadAll(io.LimitReader(rc, 4096))
+				if err != nil {
+					return err
+				}
+				entry.Link = string(link)
+				r = bytes.NewReader(nil)
+			}
+			entry.Perm = entryPerm(entry)
+			return fn(entry, r)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}